@@ -4,41 +4,94 @@ import (
 	"bytes"
 	_ "embed"
 	"fmt"
+	"strings"
 	"text/template"
 )
 
 type initTemplateParam struct {
-	Index int
-	Name  string
-	Type  string
-	Unit  string
-	Desc  string
-	Min   any
-	Max   any
-	Def   any
+	Index     int
+	Name      string
+	Type      string
+	Unit      string
+	Desc      string
+	Min       any
+	Max       any
+	MinLen    any
+	MaxLen    any
+	Def       any
+	Variadic  bool
+	Func      bool // whether the parameter is a callback that takes function values
+	Values    []string
+	Consts    []initTemplateConst // maps Values to Go constants, empty if the values are passed as is
+	GoType    string              // Go type the value is converted to, if it differs from Type
+	Validator string              // wrapper calling the Go function that checks the value, see @Validate
+	Fields    []initTemplateParam // fields of a struct parameter
+	GoName    string              // name of the Go struct field, for the fields of struct parameters
+}
+
+type initTemplateConst struct {
+	Value string
+	Const string
 }
 
 type initTemplateFunc struct {
-	OrgName string
-	Name    string
-	Desc    string
-	Params  []initTemplateParam
-	Returns []initTemplateParam
+	OrgName  string
+	Name     string
+	Desc     string
+	Params   []initTemplateParam
+	Returns  []initTemplateParam
+	Results  []string // result variables when the function returns more than one value
+	HasError bool     // whether the function returns an error as last value
+	NoValue  bool     // whether the function returns nothing but (optionally) an error
+	Injected []string // values supplied by the runtime before the script arguments
+	Examples []initTemplateExample
+	Doc      *initTemplateDoc // nil if the function has no documentation annotations
+	Aliases  []string
+	Prefix   string // qualifies the runtime's identifiers in library mode, e.g. "godsl."
+}
+
+type initTemplateDoc struct {
+	Category    string
+	Since       string
+	Deprecated  bool
+	Deprecation string
+}
+
+// newInitTemplateDoc returns the template data of the annotations, or nil if there are none.
+func newInitTemplateDoc(doc metaDoc) *initTemplateDoc {
+	if doc == (metaDoc{}) {
+		return nil
+	}
+	return &initTemplateDoc{
+		Category:    doc.category,
+		Since:       doc.since,
+		Deprecated:  doc.deprecated,
+		Deprecation: doc.deprecation,
+	}
+}
+
+type initTemplateExample struct {
+	Func   string
+	Expr   string
+	Result string
 }
 
 type initTemplateVar struct {
-	OrgName string
-	Name    string
-	Type    string
-	Unit    string
-	Desc    string
-	Min     any
-	Max     any
-	Def     any
+	OrgName  string
+	Name     string
+	Type     string
+	Unit     string
+	Desc     string
+	Min      any
+	Max      any
+	Def      any
+	ReadOnly bool
+	Doc      *initTemplateDoc // nil if the variable has no documentation annotations
 }
 
 type initTemplate struct {
 	Package      string
+	Runtime      string // import path of the runtime, empty if it's copied into the package
 	Imports      []string
 	ID           string
 	Name         string
@@ -65,19 +118,41 @@ func (data *initTemplate) generateVarRegistrations(variables []metaVar) (require
 			requiredImports = append(requiredImports, "image/color")
 		}
 		data.VarRegistry = append(data.VarRegistry, initTemplateVar{
-			OrgName: v.orgName,
-			Name:    v.name,
-			Type:    v.typ,
-			Unit:    fnCheckNil(v.unit),
-			Desc:    v.desc,
-			Min:     fnCheckNil(v.min),
-			Max:     fnCheckNil(v.max),
-			Def:     fnCheckNil(v.def),
+			OrgName:  v.orgName,
+			Name:     v.name,
+			Type:     v.typ,
+			Unit:     fnCheckNil(v.unit),
+			Desc:     v.desc,
+			Min:      fnCheckNil(v.min),
+			Max:      fnCheckNil(v.max),
+			Def:      fnCheckNil(v.def),
+			ReadOnly: v.readOnly,
+			Doc:      newInitTemplateDoc(v.doc),
 		})
 	}
 	return
 }
 
+// validator returns a wrapper that casts the value of the parameter before
+// passing it to the Go function fn.
+func (p initTemplateParam) validator(fn, prefix string) string {
+	cast := "castAs"
+	if prefix != "" {
+		cast = prefix + "CastAs"
+	}
+	arg := "x"
+	if p.GoType != "" && len(p.Consts) == 0 {
+		arg = p.GoType + "(x)"
+	}
+	return fmt.Sprintf("func(v any) error {\n"+
+		"                    x, err := %s[%s](v, %q)\n"+
+		"                    if err != nil {\n"+
+		"                        return err\n"+
+		"                    }\n"+
+		"                    return %s(%s)\n"+
+		"                }", cast, p.Type, p.Type, fn, arg)
+}
+
 func (data *initTemplate) generateFuncRegistrations(functions []metaFunc) (requiredImports []string) {
 	data.FuncRegistry = []initTemplateFunc{}
 	for _, fn := range functions {
@@ -87,6 +162,37 @@ func (data *initTemplate) generateFuncRegistrations(functions []metaFunc) (requi
 			Desc:    fn.desc,
 			Params:  []initTemplateParam{},
 			Returns: []initTemplateParam{},
+			Doc:     newInitTemplateDoc(fn.doc),
+			Aliases: fn.aliases,
+		}
+		if data.Runtime != "" {
+			tmplData.Prefix = "godsl."
+		}
+		tmplData.HasError = fn.hasError
+		tmplData.NoValue = len(fn.results) == 0
+		for _, kind := range fn.injected {
+			switch kind {
+			case "context":
+				if data.Runtime != "" {
+					tmplData.Injected = append(tmplData.Injected, "l.Context()")
+				} else {
+					tmplData.Injected = append(tmplData.Injected, "l.context()")
+				}
+			case "progress":
+				if data.Runtime != "" {
+					tmplData.Injected = append(tmplData.Injected, fmt.Sprintf("l.Progress(%q)", fn.name))
+				} else {
+					tmplData.Injected = append(tmplData.Injected, fmt.Sprintf("l.progress(%q)", fn.name))
+				}
+			}
+		}
+		if len(fn.results) > 1 {
+			for i := range fn.results {
+				tmplData.Results = append(tmplData.Results, fmt.Sprintf("r%d", i))
+			}
+		}
+		for _, ex := range fn.examples {
+			tmplData.Examples = append(tmplData.Examples, initTemplateExample{Func: fn.name, Expr: ex.expr, Result: ex.result})
 		}
 		for i, param := range fn.params {
 			switch param.typ {
@@ -95,17 +201,59 @@ func (data *initTemplate) generateFuncRegistrations(functions []metaFunc) (requi
 			case "color.RGBA", "color.RGBA64", "color.NRGBA", "color.NRGBA64":
 				requiredImports = append(requiredImports, "image/color")
 			}
+			// callbacks name the types of their signature, i.e. "func(*image.NRGBA) *image.NRGBA"
+			if strings.HasPrefix(param.typ, "func(") && strings.Contains(param.typ, "image.") {
+				requiredImports = append(requiredImports, "image")
+			}
+			if strings.HasPrefix(param.typ, "func(") && strings.Contains(param.typ, "color.") {
+				requiredImports = append(requiredImports, "image/color")
+			}
 
-			tmplData.Params = append(tmplData.Params, initTemplateParam{
-				Index: i,
-				Name:  param.name,
-				Type:  param.typ,
-				Unit:  param.unit,
-				Desc:  param.desc,
-				Min:   param.min,
-				Max:   param.max,
-				Def:   param.def,
-			})
+			tmplParam := initTemplateParam{
+				Index:    i,
+				Name:     param.name,
+				Type:     param.typ,
+				Unit:     param.unit,
+				Desc:     param.desc,
+				Min:      param.min,
+				Max:      param.max,
+				MinLen:   param.minLen,
+				MaxLen:   param.maxLen,
+				Def:      param.def,
+				Variadic: param.variadic,
+				Func:     strings.HasPrefix(param.typ, "func("),
+				GoType:   param.goType,
+			}
+			for _, f := range param.fields {
+				field := initTemplateParam{
+					Name:   f.name,
+					GoName: f.goName,
+					Type:   f.typ,
+					Unit:   f.unit,
+					Desc:   f.desc,
+					Min:    f.min,
+					Max:    f.max,
+					MinLen: f.minLen,
+					MaxLen: f.maxLen,
+					Def:    f.def,
+				}
+				for _, v := range f.values {
+					field.Values = append(field.Values, v.value)
+				}
+				tmplParam.Fields = append(tmplParam.Fields, field)
+			}
+			for _, v := range fn.validators {
+				if v.param == param.name {
+					tmplParam.Validator = tmplParam.validator(v.fn, tmplData.Prefix)
+				}
+			}
+			for _, v := range param.values {
+				tmplParam.Values = append(tmplParam.Values, v.value)
+				if v.constant != "" {
+					tmplParam.Consts = append(tmplParam.Consts, initTemplateConst{Value: v.value, Const: v.constant})
+				}
+			}
+			tmplData.Params = append(tmplData.Params, tmplParam)
 		}
 		for i, ret := range fn.returns {
 			switch ret.typ {
@@ -134,6 +282,15 @@ func (data *initTemplate) generateFuncRegistrations(functions []metaFunc) (requi
 //go:embed init.tmpl
 var tmplInit string
 
+//go:embed lib.tmpl
+var tmplLib string
+
+//go:embed call.tmpl
+var tmplCall string
+
+//go:embed examples.tmpl
+var tmplExamples string
+
 func getUniqueStrings(slice []string) []string {
 	seen := make(map[string]struct{})
 	result := []string{}
@@ -146,14 +303,25 @@ func getUniqueStrings(slice []string) []string {
 	return result
 }
 
-func genInitCode(id string, name string, desc string, version string, extension string, pkg string, fns []metaFunc, vars []metaVar) string {
-	tmpl, err := template.New("init").Parse(tmplInit)
+// genInitCode generates the registration code of the language. If runtime is
+// empty, the code registers with the copied runtime (copy mode), otherwise
+// it imports the runtime from that path (library mode).
+func genInitCode(id string, name string, desc string, version string, extension string, pkg string, fns []metaFunc, vars []metaVar, pkgImports []string, runtime string) string {
+	src := tmplInit
+	if runtime != "" {
+		src = tmplLib
+	}
+	tmpl, err := template.New("init").Parse(src)
 	if err != nil {
 		panic(err)
 	}
+	if _, err := tmpl.Parse(tmplCall); err != nil {
+		panic(err)
+	}
 
 	data := initTemplate{
 		Package:     pkg,
+		Runtime:     runtime,
 		Imports:     []string{},
 		ID:          id,
 		Name:        name,
@@ -161,7 +329,7 @@ func genInitCode(id string, name string, desc string, version string, extension
 		Version:     version,
 		Extension:   extension,
 	}
-	imports := []string{}
+	imports := append([]string{}, pkgImports...)
 	imports = append(imports, data.generateVarRegistrations(vars)...)
 	imports = append(imports, data.generateFuncRegistrations(fns)...)
 	data.Imports = getUniqueStrings(imports)
@@ -173,3 +341,29 @@ func genInitCode(id string, name string, desc string, version string, extension
 
 	return buf.String()
 }
+
+// genExamplesTestCode generates a test that runs the @Example annotations of
+// all functions, it returns an empty string if there are no examples.
+func genExamplesTestCode(pkg string, fns []metaFunc, runtime string) string {
+	tmpl, err := template.New("examples").Parse(tmplExamples)
+	if err != nil {
+		panic(err)
+	}
+
+	data := initTemplate{Package: pkg}
+	data.generateFuncRegistrations(fns)
+	examples := []initTemplateExample{}
+	for _, fn := range data.FuncRegistry {
+		examples = append(examples, fn.Examples...)
+	}
+	if len(examples) == 0 {
+		return ""
+	}
+
+	var buf bytes.Buffer
+	if err := tmpl.Execute(&buf, map[string]any{"Package": pkg, "Runtime": runtime, "Examples": examples}); err != nil {
+		panic(err)
+	}
+
+	return buf.String()
+}
@@ -2,6 +2,7 @@ package main
 
 import (
 	"embed"
+	"flag"
 	"fmt"
 	"go/parser"
 	"go/token"
@@ -27,6 +28,10 @@ func cloneSourceFromFS(fs embed.FS, src, dst, pkg string) {
 		// don't copy test files
 		return
 	}
+	if strings.HasPrefix(filepath.Base(src), "api") {
+		// the exported API (api*.go) is only needed when the runtime is imported
+		return
+	}
 	clone, err := fs.ReadFile(src)
 	if err != nil {
 		log.Fatal(err)
@@ -83,87 +88,135 @@ func cleanupOldFiles(basePath string) {
 }
 
 func main() {
-	if len(os.Args) < 6 {
-		fmt.Println("Usage: go run main.go [id] [name] [description] [version] [extension] [package 1] [package 2] ... [package N]")
+	merge := flag.String("merge", "", "merge all packages into one language that is generated in this directory, names are qualified with the package name (`img.blur`)")
+	unqualified := flag.String("import", "", "comma separated list of merged packages whose functions can also be called without qualifying them")
+	copyMode := flag.Bool("copy", false, "copy the runtime into the package (dsl_*.go files), the default unless -runtime is given")
+	runtime := flag.String("runtime", "", "import path of the runtime used by the generated language (library mode), e.g. `github.com/toxyl/go-dsl/app/parser`")
+	flag.Usage = func() {
+		fmt.Println("Usage: go run main.go [-copy | -runtime path] [-merge dir [-import pkg1,pkg2]] [id] [name] [description] [version] [extension] [package 1] [package 2] ... [package N]")
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+	args := flag.Args()
+	if len(args) < 5 {
+		flag.Usage()
 		os.Exit(1)
 	}
 
-	id := os.Args[1]
-	name := os.Args[2]
-	description := os.Args[3]
-	version := os.Args[4]
-	extension := os.Args[5]
-	packages := os.Args[6:]
+	id := args[0]
+	name := args[1]
+	description := args[2]
+	version := args[3]
+	extension := args[4]
+	packages := args[5:]
+	if *copyMode {
+		*runtime = ""
+	}
+
+	if *merge != "" {
+		fmt.Printf("Generating merged parser for %s\n", strings.Join(packages, ", "))
+		pkgName, functions, variables, imports := mergePackages(*merge, packages, strings.Split(*unqualified, ","))
+		checkNames(functions, variables)
+		generateLanguage(*merge, pkgName, id, name, description, version, extension, functions, variables, imports, *runtime)
+		return
+	}
 
 	for _, pkg := range packages {
 		fmt.Printf("Generating parser for %s package\n", pkg)
-		pkg = strings.TrimSpace(pkg)
-		// read all files in the package
-		files, err := filepath.Glob(pkg + "/*.go")
+		pkgName, basePath, functions, variables := parsePackage(pkg)
+		checkNames(functions, variables)
+		generateLanguage(basePath, pkgName, id, name, description, version, extension, functions, variables, nil, *runtime)
+	}
+}
+
+// parsePackage extracts the annotated functions and variables of a package.
+func parsePackage(pkg string) (pkgName, basePath string, functions []metaFunc, variables []metaVar) {
+	pkg = strings.TrimSpace(pkg)
+	// read all files in the package
+	files, err := filepath.Glob(pkg + "/*.go")
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	// parse each file, struct parameters are resolved once all types are known
+	options := map[string][]metaParam{}
+	for _, file := range files {
+		if strings.HasPrefix(filepath.Base(file), "dsl_") {
+			continue // generated files
+		}
+		fmt.Println("Parsing file:", file)
+		fset := token.NewFileSet()
+		node, err := parser.ParseFile(fset, file, nil, parser.ParseComments)
 		if err != nil {
 			log.Fatal(err)
 		}
-
-		var functions []metaFunc
-		var variables []metaVar
-
-		basePath := ""
-		pkgName := ""
-
-		// parse each file
-		for _, file := range files {
-			fmt.Println("Parsing file:", file)
-			fset := token.NewFileSet()
-			node, err := parser.ParseFile(fset, file, nil, parser.ParseComments)
-			if err != nil {
-				log.Fatal(err)
-			}
-			if pkgName == "" {
-				pkgName = node.Name.Name
-			}
-			if basePath == "" {
-				basePath = strings.TrimPrefix(filepath.Dir(file), ".")
-			}
-			variables = extractVariableMeta(node, variables)
-			functions = extractFunctionMeta(node, functions)
+		if pkgName == "" {
+			pkgName = node.Name.Name
+		}
+		if basePath == "" {
+			basePath = strings.TrimPrefix(filepath.Dir(file), ".")
 		}
+		variables = extractVariableMeta(node, variables)
+		functions = extractFunctionMeta(node, functions)
+		extractOptions(node, options)
+	}
+	resolveOptions(functions, options)
+	return pkgName, basePath, functions, variables
+}
 
-		// Clean up old files before generating new ones
-		cleanupOldFiles(basePath)
+// generateLanguage writes the registration code of the language to basePath.
+// If runtime is empty, the runtime is copied to basePath as well, otherwise
+// the generated code imports it from that path.
+func generateLanguage(basePath, pkgName, id, name, description, version, extension string, functions []metaFunc, variables []metaVar, imports []string, runtime string) {
+	// Clean up old files before generating new ones
+	cleanupOldFiles(basePath)
 
-		// Get embedded files
-		fs := getParserFS()
+	if runtime == "" {
+		copyRuntime(basePath, pkgName)
+	}
 
-		// List all files in the parser directory
-		entries, err := fs.ReadDir("parser")
-		if err != nil {
+	// generate the registry code
+	code := genInitCode(id, name, description, version, extension, pkgName, functions, variables, imports, runtime)
+
+	// write to registry.go
+	if err := flo.File(basePath + "/dsl_init.go").StoreString(code); err != nil {
+		log.Fatal(err)
+	}
+
+	// generate a test for the @Example annotations
+	if code := genExamplesTestCode(pkgName, functions, runtime); code != "" {
+		if err := flo.File(basePath + "/dsl_examples_test.go").StoreString(code); err != nil {
 			log.Fatal(err)
 		}
+	}
+}
 
-		for _, entry := range entries {
-			if entry.IsDir() {
-				continue
-			}
-
-			path := filepath.Join("parser", entry.Name())
+// copyRuntime copies the sources of the runtime to basePath (copy mode).
+func copyRuntime(basePath, pkgName string) {
+	// Get embedded files
+	fs := getParserFS()
 
-			// Handle Go files - prefix with dsl_
-			if strings.HasSuffix(entry.Name(), ".go") {
-				cloneSourceFromFS(fs, path, basePath+"/dsl_"+entry.Name(), pkgName)
-			}
+	// List all files in the parser directory
+	entries, err := fs.ReadDir("parser")
+	if err != nil {
+		log.Fatal(err)
+	}
 
-			// Handle template files - they already have template_ prefix
-			if strings.HasSuffix(entry.Name(), ".tmpl") {
-				cloneSourceFromFS(fs, path, basePath+"/"+entry.Name(), pkgName)
-			}
+	for _, entry := range entries {
+		if entry.IsDir() {
+			continue
 		}
 
-		// generate the registry code
-		code := genInitCode(id, name, description, version, extension, pkgName, functions, variables)
+		path := filepath.Join("parser", entry.Name())
 
-		// write to registry.go
-		if err := flo.File(basePath + "/dsl_init.go").StoreString(code); err != nil {
-			log.Fatal(err)
+		// Handle Go files - prefix with dsl_
+		if strings.HasSuffix(entry.Name(), ".go") {
+			cloneSourceFromFS(fs, path, basePath+"/dsl_"+entry.Name(), pkgName)
+		}
+
+		// Handle template files - they already have template_ prefix
+		if strings.HasSuffix(entry.Name(), ".tmpl") {
+			cloneSourceFromFS(fs, path, basePath+"/"+entry.Name(), pkgName)
 		}
 	}
 }
@@ -0,0 +1,142 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"testing"
+)
+
+// testPackage is an annotated package the generator is run on, the
+// placeholders are the import of the runtime and the qualifier of its
+// ProgressReporter, which are empty in copy mode.
+const testPackage = `package calc
+
+import (
+	"context"%s
+)
+
+var (
+	// @Name:  last
+	// @Desc:  The last result
+	// @Range: -
+	// @Unit:  -
+	last = 0.0
+
+	// @Name:  steps
+	// @Desc:  The number of steps
+	// @Range: 1..100
+	steps int32 = 3
+
+	// @Name:  ratio
+	// @Desc:  The ratio of the steps
+	// @Range: 0..1
+	ratio float32 = 0.5
+
+	// @Name:  label
+	// @Desc:  The label of the result
+	// @Range: 1..10
+	label = "sum"
+)
+
+// @Name: add
+// @Desc: Adds two numbers
+// @Param: x - 0..10 0 The first number
+// @Param: y - 0..10 0 The second number
+// @Returns: result - 0..20 0 The sum
+// @Example: add(1 2) => 3
+func add(x, y float64) (result float64, err error) {
+	last = x + y
+	return last, nil
+}
+
+// @Name: double
+// @Desc: Doubles a number
+// @Param: x - - 0 The number
+// @Returns: result - - 0 The doubled number
+// @Example: double(4) => 8
+func double(x float64) float64 {
+	return x * 2
+}
+
+// @Name: reset
+// @Desc: Resets the last result
+// @Example: reset()
+func reset() {
+	last = 0
+}
+
+// @Name: count
+// @Desc: Counts to n, unless the context is canceled
+// @Param: n - 0.. 0 The number to count to
+// @Returns: result - - 0 The number counted to
+// @Example: count(3) => 3
+func count(ctx context.Context, progress %sProgressReporter, n int) (int, error) {
+	for i := 1; i <= n; i++ {
+		if err := ctx.Err(); err != nil {
+			return 0, err
+		}
+		progress.Report(float64(i), float64(n))
+	}
+	return n, nil
+}
+`
+
+// generate runs the generator on a package with the given source, in copy
+// mode if runtime is empty, and returns the directory of the package. The
+// source is formatted with the import of the runtime and the qualifier of its
+// identifiers, see testPackage. The package is created in testdata, so that
+// it's part of the module but not of ./...
+func generate(t *testing.T, src, runtime string) string {
+	t.Helper()
+	if err := os.MkdirAll("testdata", 0755); err != nil {
+		t.Fatal(err)
+	}
+	dir, err := os.MkdirTemp("testdata", "gen")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		os.RemoveAll(dir)
+		os.Remove("testdata") // only if no other package is generated
+	})
+	imp, qualifier := "", ""
+	if runtime != "" {
+		imp, qualifier = fmt.Sprintf("\n\n\tgodsl %q", runtime), "godsl."
+	}
+	src = fmt.Sprintf(src, imp, qualifier)
+	if err := os.WriteFile(filepath.Join(dir, "calc.go"), []byte(src), 0644); err != nil {
+		t.Fatal(err)
+	}
+	pkgName, basePath, functions, variables := parsePackage(dir)
+	checkNames(functions, variables)
+	generateLanguage(basePath, pkgName, "calc", "Calc", "A calculator", "1.0.0", "calc", functions, variables, nil, runtime)
+	return dir
+}
+
+func TestGenerate(t *testing.T) {
+	t.Run("Generate", func(t *testing.T) {
+		type TestCase struct {
+			name    string
+			runtime string
+		}
+		c := func(name, runtime string) TestCase {
+			return TestCase{name, runtime}
+		}
+		tests := []TestCase{
+			c("copy mode", ""),
+			c("library mode", "go-dsl/app/parser"),
+		}
+		for _, tt := range tests {
+			t.Run(tt.name, func(t *testing.T) {
+				dir := generate(t, testPackage, tt.runtime)
+				// builds the package and runs the test of its examples
+				out, err := exec.Command("go", "test", "./"+dir).CombinedOutput()
+				if err != nil {
+					t.Errorf("generated package fails: %v\n%s", err, out)
+				}
+			})
+		}
+	})
+}
@@ -0,0 +1,231 @@
+package main
+
+import (
+	"go/ast"
+	"go/parser"
+	"go/token"
+	"log"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"strings"
+)
+
+// mergePackages parses the packages for a language generated in dir. Names are
+// qualified with the package name (`img.blur`, `img.radius`), functions of the
+// unqualified packages can also be called by their plain names (`blur`).
+// Merged functions, variables and types must be exported since they are used
+// from another package.
+func mergePackages(dir string, packages, unqualified []string) (pkgName string, functions []metaFunc, variables []metaVar, imports []string) {
+	plain := map[string]bool{}
+	for _, ns := range unqualified {
+		if ns = strings.TrimSpace(ns); ns != "" {
+			plain[ns] = true
+		}
+	}
+
+	seen := map[string]string{}
+	for _, pkg := range packages {
+		ns, basePath, fns, vars := parsePackage(pkg)
+		if ns == "" {
+			log.Fatalf("%s does not contain any Go files", pkg)
+		}
+		if other, ok := seen[ns]; ok {
+			log.Fatalf("%s and %s are both named %s, merged packages need unique names", other, pkg, ns)
+		}
+		seen[ns] = pkg
+		imports = append(imports, importPath(basePath))
+
+		for _, fn := range fns {
+			functions = append(functions, qualifyFunc(ns, fn, fns, plain[ns]))
+		}
+		for _, v := range vars {
+			if !ast.IsExported(v.orgName) {
+				log.Fatalf("%s.%s must be exported to be merged", ns, v.orgName)
+			}
+			v.orgName = ns + "." + v.orgName
+			v.name = ns + "." + v.name
+			if v.doc.category == "" {
+				v.doc.category = ns
+			}
+			variables = append(variables, v)
+		}
+		delete(plain, ns)
+	}
+	for ns := range plain {
+		log.Fatalf("-import %s does not match any of the merged packages", ns)
+	}
+
+	return packageName(dir), functions, variables, imports
+}
+
+// qualifyFunc qualifies the name, aliases and Go types of fn with the namespace ns.
+// If unqualified is true, the plain names are kept as aliases.
+func qualifyFunc(ns string, fn metaFunc, fns []metaFunc, unqualified bool) metaFunc {
+	if !ast.IsExported(fn.orgName) {
+		log.Fatalf("%s.%s must be exported to be merged", ns, fn.orgName)
+	}
+	fn.orgName = ns + "." + fn.orgName
+
+	names := append([]string{fn.name}, fn.aliases...)
+	aliases := []string{}
+	for _, alias := range fn.aliases {
+		aliases = append(aliases, ns+"."+alias)
+	}
+	if unqualified {
+		aliases = append(aliases, names...)
+	}
+	fn.name = ns + "." + fn.name
+	fn.aliases = aliases
+
+	params := []metaParam{}
+	for _, param := range fn.params {
+		param.typ = qualifyType(ns, param.typ)
+		param.goType = qualifyType(ns, param.goType)
+		values := []metaEnumValue{}
+		for _, v := range param.values {
+			if v.constant != "" && !strings.Contains(v.constant, ".") {
+				v.constant = ns + "." + v.constant
+			}
+			values = append(values, v)
+		}
+		param.values = values
+		fields := []metaParam{}
+		for _, f := range param.fields {
+			f.typ = qualifyType(ns, f.typ)
+			fields = append(fields, f)
+		}
+		param.fields = fields
+		params = append(params, param)
+	}
+	fn.params = params
+
+	validators := []metaValidator{}
+	for _, v := range fn.validators {
+		if !strings.Contains(v.fn, ".") {
+			if !ast.IsExported(v.fn) {
+				log.Fatalf("%s.%s must be exported to be merged", ns, v.fn)
+			}
+			v.fn = ns + "." + v.fn
+		}
+		validators = append(validators, v)
+	}
+	fn.validators = validators
+
+	if fn.doc.category == "" {
+		fn.doc.category = ns
+	}
+
+	// examples must call the functions by names that exist in the merged language
+	if !unqualified {
+		examples := []metaExample{}
+		for _, ex := range fn.examples {
+			for _, other := range fns {
+				for _, name := range append([]string{other.name}, other.aliases...) {
+					ex.expr = qualifyCall(ex.expr, ns, name)
+				}
+			}
+			examples = append(examples, ex)
+		}
+		fn.examples = examples
+	}
+	return fn
+}
+
+// qualifyType qualifies types declared in the package ns, e.g. `*Rect` becomes `*img.Rect`
+// and `map[string]Rect` becomes `map[string]img.Rect`.
+func qualifyType(ns, typ string) string {
+	if strings.HasPrefix(typ, "map[string]") {
+		return "map[string]" + qualifyType(ns, strings.TrimPrefix(typ, "map[string]"))
+	}
+	prefix := ""
+	for _, p := range []string{"...", "[]", "*"} {
+		if strings.HasPrefix(typ, p) {
+			prefix += p
+			typ = strings.TrimPrefix(typ, p)
+		}
+	}
+	switch {
+	case typ == "", strings.Contains(typ, "."), isBasicType(typ), typ == "any", typ == "error":
+		return prefix + typ
+	}
+	return prefix + ns + "." + typ
+}
+
+// qualifyCall replaces calls of the function name in a script with calls of `ns.name`.
+func qualifyCall(script, ns, name string) string {
+	re := regexp.MustCompile(`(^|[^A-Za-z0-9_.\-])` + regexp.QuoteMeta(name) + `\(`)
+	return re.ReplaceAllString(script, "${1}"+ns+"."+name+"(")
+}
+
+// importPath returns the import path of the package in dir, based on the nearest go.mod.
+func importPath(dir string) string {
+	abs, err := filepath.Abs(dir)
+	if err != nil {
+		log.Fatal(err)
+	}
+	module := regexp.MustCompile(`(?m)^module\s+(\S+)`)
+	for root := abs; ; root = filepath.Dir(root) {
+		if data, err := os.ReadFile(filepath.Join(root, "go.mod")); err == nil {
+			m := module.FindSubmatch(data)
+			if m == nil {
+				log.Fatalf("%s/go.mod does not declare a module", root)
+			}
+			rel, err := filepath.Rel(root, abs)
+			if err != nil {
+				log.Fatal(err)
+			}
+			return path.Join(string(m[1]), filepath.ToSlash(rel))
+		}
+		if root == filepath.Dir(root) {
+			log.Fatalf("could not find the go.mod of %s", dir)
+		}
+	}
+}
+
+// packageName returns the name of the package in dir, or the name of dir if
+// it doesn't contain any Go files yet.
+func packageName(dir string) string {
+	files, err := filepath.Glob(filepath.Join(dir, "*.go"))
+	if err != nil {
+		log.Fatal(err)
+	}
+	for _, file := range files {
+		if strings.HasPrefix(filepath.Base(file), "dsl_") {
+			continue
+		}
+		node, err := parser.ParseFile(token.NewFileSet(), file, nil, parser.PackageClauseOnly)
+		if err != nil {
+			log.Fatal(err)
+		}
+		return node.Name.Name
+	}
+	abs, err := filepath.Abs(dir)
+	if err != nil {
+		log.Fatal(err)
+	}
+	return filepath.Base(abs)
+}
+
+// checkNames stops the generator if a name is used by more than one function or variable.
+func checkNames(functions []metaFunc, variables []metaVar) {
+	funcs := map[string]string{}
+	for _, fn := range functions {
+		for _, name := range append([]string{fn.name}, fn.aliases...) {
+			if other, ok := funcs[name]; ok && other != fn.orgName {
+				log.Fatalf("function name %s is used by both %s and %s, rename one of them, change its @Alias or remove its package from -import", name, other, fn.orgName)
+			} else if ok {
+				log.Fatalf("function name %s is used more than once by %s", name, fn.orgName)
+			}
+			funcs[name] = fn.orgName
+		}
+	}
+	vars := map[string]string{}
+	for _, v := range variables {
+		if other, ok := vars[v.name]; ok {
+			log.Fatalf("variable name %s is used by both %s and %s", v.name, other, v.orgName)
+		}
+		vars[v.name] = v.orgName
+	}
+}
@@ -2,38 +2,102 @@ package main
 
 import (
 	"go/ast"
+	"go/token"
 	"log"
+	"reflect"
 	"strconv"
 	"strings"
 )
 
 type metaVar struct {
-	orgName string
-	name    string
-	typ     string
-	unit    string
-	min     any
-	max     any
-	def     any
-	desc    string
+	orgName  string
+	name     string
+	typ      string
+	unit     string
+	min      any
+	max      any
+	def      any
+	desc     string
+	readOnly bool // Go constants and vars annotated with @Const or @ReadOnly
+	doc      metaDoc
+}
+
+// metaDoc holds the @Category, @Since and @Deprecated annotations.
+type metaDoc struct {
+	category    string
+	since       string
+	deprecated  bool
+	deprecation string
+}
+
+// parse sets the annotation if key is one of the documentation annotations,
+// it returns false otherwise. A bare `@Deprecated` is passed with an empty value.
+func (d *metaDoc) parse(key, value string) bool {
+	switch key {
+	case "Category":
+		d.category = value
+	case "Since":
+		d.since = value
+	case "Deprecated":
+		d.deprecated = true
+		d.deprecation = value
+	default:
+		return false
+	}
+	return true
 }
 
 type metaFunc struct {
-	orgName string
-	name    string
-	desc    string
-	params  []metaParam
-	returns []metaParam
+	orgName    string
+	name       string
+	desc       string
+	params     []metaParam
+	returns    []metaParam
+	results    []string // types of the Go results, excluding the trailing error
+	hasError   bool     // whether the last Go result is an error
+	injected   []string // leading parameters supplied by the runtime: "context" or "progress"
+	examples   []metaExample
+	doc        metaDoc
+	aliases    []string // other names the function can be called by, see @Alias
+	validators []metaValidator
+}
+
+// metaValidator is parsed from `@Validate: radius checkRadius`, checkRadius
+// receives the argument converted to the parameter type and returns an error
+// if it's invalid.
+type metaValidator struct {
+	param string
+	fn    string
+}
+
+// metaExample is parsed from `@Example: blur(img radius=3) => image`,
+// result is empty if the example has no expected result.
+type metaExample struct {
+	expr   string
+	result string
 }
 
 type metaParam struct {
-	name string
-	typ  string
-	min  any
-	max  any
-	def  any
-	unit string
-	desc string
+	name     string
+	typ      string
+	min      any // minimum value, of the elements for slices or "WxH" for images
+	max      any // maximum value, of the elements for slices or "WxH" for images
+	minLen   any // minimum length of slices and strings, see parseRange
+	maxLen   any // maximum length of slices and strings, see parseRange
+	def      any
+	unit     string
+	desc     string
+	variadic bool
+	values   []metaEnumValue // allowed values, see @Enum
+	goType   string          // Go type the script value is converted to, if it differs from typ
+	fields   []metaParam     // fields of a struct parameter, see extractOptions
+	goName   string          // name of the Go struct field, for the fields of struct parameters
+}
+
+// metaEnumValue is an allowed value of a parameter, optionally mapped to a Go constant.
+type metaEnumValue struct {
+	value    string
+	constant string
 }
 
 func extractFunctionMeta(node *ast.File, functions []metaFunc) []metaFunc {
@@ -54,7 +118,7 @@ func extractFunctionMeta(node *ast.File, functions []metaFunc) []metaFunc {
 						continue
 					}
 					switch strings.TrimSpace(parts[0]) {
-					case "Name", "Desc", "Param", "Returns":
+					case "Name", "Desc", "Param", "Returns", "Enum", "Values", "Example", "Alias":
 						isAnnotated = true
 					}
 				}
@@ -67,35 +131,58 @@ func extractFunctionMeta(node *ast.File, functions []metaFunc) []metaFunc {
 			}
 
 			types := map[string]string{}
+			injected := []string{}
+			injectedNames := map[string]bool{}
 			if fn.Type != nil && fn.Type.Params != nil && fn.Type.Params.List != nil {
 				for _, param := range fn.Type.Params.List {
+					typ := extractTypeString(param.Type)
 					for _, name := range param.Names {
-						types[name.Name] = extractTypeString(param.Type)
+						// leading context and progress parameters are supplied by the runtime
+						if kind := injectedParam(typ); kind != "" && len(types) == 0 {
+							injected = append(injected, kind)
+							injectedNames[name.Name] = true
+							continue
+						}
+						types[name.Name] = typ
 					}
 				}
 			}
+			results := []metaParam{} // in declaration order, so unnamed results can be matched by position
 			if fn.Type != nil && fn.Type.Results != nil && fn.Type.Results.List != nil {
 				for _, result := range fn.Type.Results.List {
+					typ := extractTypeString(result.Type)
 					for _, name := range result.Names {
-						if name != nil {
-							types[name.Name] = extractTypeString(result.Type)
-						} else {
-							types["result"] = extractTypeString(result.Type)
-						}
+						types[name.Name] = typ
+						results = append(results, metaParam{name: name.Name, typ: typ})
 					}
 					if len(result.Names) == 0 {
-						types["result"] = extractTypeString(result.Type)
+						results = append(results, metaParam{typ: typ})
 					}
 				}
 			}
 
+			// allowed values must be known before parsing the params,
+			// enums of named types are passed as strings and converted by the wrapper
+			enums, goTypes := extractEnums(fn.Doc.List, types)
+
 			meta := metaFunc{
-				orgName: fn.Name.Name,
+				orgName:  fn.Name.Name,
+				hasError: len(results) > 0 && results[len(results)-1].typ == "error",
+				injected: injected,
+			}
+			for _, result := range results {
+				if result.typ != "error" {
+					meta.results = append(meta.results, result.typ)
+				}
 			}
 
 			// parse doc comments
 			for _, comment := range fn.Doc.List {
 				text := strings.TrimSpace(strings.TrimPrefix(comment.Text, "//"))
+				if text == "@Deprecated" {
+					meta.doc.parse("Deprecated", "")
+					continue
+				}
 
 				if strings.HasPrefix(text, "@") {
 					parts := strings.SplitN(text[1:], ":", 2)
@@ -105,15 +192,45 @@ func extractFunctionMeta(node *ast.File, functions []metaFunc) []metaFunc {
 
 					key := strings.TrimSpace(parts[0])
 					value := strings.TrimSpace(parts[1])
+					if meta.doc.parse(key, value) {
+						continue
+					}
 					switch key {
 					case "Name":
 						meta.name = value
 					case "Desc":
 						meta.desc = value
 					case "Param":
-						meta.params = append(meta.params, parseParam(value, types))
+						if fields := strings.Fields(value); len(fields) > 0 && injectedNames[fields[0]] {
+							continue
+						}
+						param := parseParam(value, types)
+						param.values = enums[param.name]
+						param.goType = goTypes[param.name]
+						meta.params = append(meta.params, param)
 					case "Returns":
-						meta.returns = append(meta.returns, parseParam(value, types))
+						meta.returns = append(meta.returns, parseParam(value, resultTypes(value, results, len(meta.returns))))
+					case "Alias":
+						meta.aliases = append(meta.aliases, strings.Fields(strings.ReplaceAll(value, ",", " "))...)
+					case "Validate":
+						fields := strings.Fields(value)
+						if len(fields) != 2 {
+							log.Fatalf("%s: @Validate expects a parameter and a function, got %q", meta.orgName, value)
+						}
+						meta.validators = append(meta.validators, metaValidator{param: fields[0], fn: fields[1]})
+					case "Example":
+						meta.examples = append(meta.examples, parseExample(value))
+					}
+				}
+			}
+
+			for i, v := range meta.validators {
+				if !meta.hasParam(v.param) {
+					log.Fatalf("%s: @Validate refers to the unknown parameter %s", meta.orgName, v.param)
+				}
+				for _, prev := range meta.validators[:i] {
+					if prev.param == v.param {
+						log.Fatalf("%s: parameter %s has more than one @Validate", meta.orgName, v.param)
 					}
 				}
 			}
@@ -126,6 +243,135 @@ func extractFunctionMeta(node *ast.File, functions []metaFunc) []metaFunc {
 	return functions
 }
 
+// parseExample splits an @Example into the script and its expected result at
+// the last `=>` outside of parentheses, braces, brackets and strings, the
+// arrows of lambdas (`map({1 2} (x) => mul(x 2)) => {2 4}`) are part of the script.
+func parseExample(value string) metaExample {
+	var (
+		depth   int
+		quote   rune
+		escaped bool
+		split   = -1
+	)
+	for i, r := range value {
+		switch {
+		case escaped:
+			escaped = false
+		case quote != 0:
+			escaped = r == '\\' && quote == '"'
+			if r == quote {
+				quote = 0
+			}
+		case r == '"' || r == '`':
+			quote = r
+		case r == '(' || r == '{' || r == '[':
+			depth++
+		case r == ')' || r == '}' || r == ']':
+			depth--
+		case r == '=' && depth == 0 && strings.HasPrefix(value[i:], "=>"):
+			split = i
+		}
+	}
+	if split < 0 {
+		return metaExample{expr: value}
+	}
+	return metaExample{
+		expr:   strings.TrimSpace(value[:split]),
+		result: strings.TrimSpace(value[split+2:]),
+	}
+}
+
+// hasParam returns true if the function has a parameter with the given name.
+func (fn *metaFunc) hasParam(name string) bool {
+	for _, p := range fn.params {
+		if p.name == name {
+			return true
+		}
+	}
+	return false
+}
+
+// extractEnums parses the @Enum (or @Values) annotations of a function:
+//
+//	@Enum: mode normal multiply screen
+//	@Enum: mode normal=BlendNormal multiply=BlendMultiply
+//
+// Params mapped to constants or of a named type are exposed as strings,
+// their types are changed accordingly and the Go types are returned as goTypes.
+func extractEnums(comments []*ast.Comment, types map[string]string) (enums map[string][]metaEnumValue, goTypes map[string]string) {
+	enums = map[string][]metaEnumValue{}
+	goTypes = map[string]string{}
+	for _, comment := range comments {
+		text := strings.TrimSpace(strings.TrimPrefix(comment.Text, "//"))
+		key, value, ok := strings.Cut(strings.TrimPrefix(text, "@"), ":")
+		if !strings.HasPrefix(text, "@") || !ok {
+			continue
+		}
+		if key = strings.TrimSpace(key); key != "Enum" && key != "Values" {
+			continue
+		}
+		fields := strings.Fields(value)
+		if len(fields) < 2 {
+			log.Fatalf("@%s needs a parameter name and at least one value: %s", key, text)
+		}
+		name, mapped := fields[0], false
+		for _, f := range fields[1:] {
+			v, c, _ := strings.Cut(f, "=")
+			enums[name] = append(enums[name], metaEnumValue{value: v, constant: c})
+			mapped = mapped || c != ""
+		}
+		if typ, ok := types[name]; ok && !strings.HasPrefix(typ, "...") && (mapped || !isBasicType(typ)) {
+			goTypes[name] = typ
+			types[name] = "string"
+		}
+	}
+	return enums, goTypes
+}
+
+// isBasicType returns true for the builtin types scripts can pass directly.
+func isBasicType(typ string) bool {
+	switch typ {
+	case "bool", "string",
+		"int", "int8", "int16", "int32", "int64",
+		"uint", "uint8", "uint16", "uint32", "uint64",
+		"float32", "float64":
+		return true
+	}
+	return false
+}
+
+// injectedParam returns the kind of value the runtime injects for
+// parameters of the given type, or an empty string if it's a regular parameter.
+// In library mode the ProgressReporter is qualified with the runtime's package name.
+func injectedParam(typ string) string {
+	switch {
+	case typ == "context.Context":
+		return "context"
+	case typ == "ProgressReporter", strings.HasSuffix(typ, ".ProgressReporter"):
+		return "progress"
+	}
+	return ""
+}
+
+// resultTypes maps the name used in a @Returns annotation to the type of the
+// matching result. Named results are matched by name, unnamed ones by the
+// position of the annotation.
+func resultTypes(value string, results []metaParam, index int) map[string]string {
+	fields := strings.Fields(value)
+	if len(fields) == 0 {
+		return map[string]string{}
+	}
+	for _, result := range results {
+		if result.name == fields[0] {
+			return map[string]string{fields[0]: result.typ}
+		}
+	}
+	if index < len(results) {
+		return map[string]string{fields[0]: results[index].typ}
+	}
+	return map[string]string{}
+}
+
 func extractTypeString(expr ast.Expr) string {
 	switch pt := expr.(type) {
 	case *ast.StarExpr:
@@ -142,21 +388,161 @@ func extractTypeString(expr ast.Expr) string {
 	case *ast.ArrayType:
 		eltType := extractTypeString(pt.Elt)
 		return "[]" + eltType
+	case *ast.Ellipsis:
+		return "..." + extractTypeString(pt.Elt)
+	case *ast.MapType:
+		return "map[" + extractTypeString(pt.Key) + "]" + extractTypeString(pt.Value)
+	case *ast.FuncType:
+		return extractFuncTypeString(pt)
 	case *ast.Ident:
 		return pt.Name
 	}
 	return "any"
 }
 
+// extractFuncTypeString returns the type of a callback parameter the way
+// reflect prints it, without parameter names, i.e. "func(float64) float64"
+// or "func(float64, float64) (float64, error)".
+func extractFuncTypeString(ft *ast.FuncType) string {
+	fieldTypes := func(list *ast.FieldList) []string {
+		types := []string{}
+		if list == nil {
+			return types
+		}
+		for _, field := range list.List {
+			typ := extractTypeString(field.Type)
+			types = append(types, typ)
+			for i := 1; i < len(field.Names); i++ {
+				types = append(types, typ)
+			}
+		}
+		return types
+	}
+	res := "func(" + strings.Join(fieldTypes(ft.Params), ", ") + ")"
+	switch results := fieldTypes(ft.Results); len(results) {
+	case 0:
+	case 1:
+		res += " " + results[0]
+	default:
+		res += " (" + strings.Join(results, ", ") + ")"
+	}
+	return res
+}
+
+// extractOptions collects the structs of a file that have fields tagged `dsl`.
+// Parameters of such a type take the fields as named arguments. The tags use
+// the same format as the runtime's ParamsFromTags:
+//
+//	type BlurOptions struct {
+//		Radius float64 `dsl:"radius,min=0,max=10,default=1,unit=px,desc=Blur radius"`
+//		Edge   string  `dsl:"edge,values=clamp|wrap,default=clamp"`
+//	}
+func extractOptions(node *ast.File, options map[string][]metaParam) {
+	for _, decl := range node.Decls {
+		gdecl, ok := decl.(*ast.GenDecl)
+		if !ok || gdecl.Tok != token.TYPE {
+			continue
+		}
+		for _, spec := range gdecl.Specs {
+			tspec := spec.(*ast.TypeSpec)
+			st, ok := tspec.Type.(*ast.StructType)
+			if !ok {
+				continue
+			}
+			fields, tagged := []metaParam{}, false
+			for _, field := range st.Fields.List {
+				tag := ""
+				if field.Tag != nil {
+					raw, _ := strconv.Unquote(field.Tag.Value)
+					var ok bool
+					tag, ok = reflect.StructTag(raw).Lookup("dsl")
+					tagged = tagged || ok
+				}
+				for _, name := range field.Names {
+					if tag == "-" || !name.IsExported() {
+						continue
+					}
+					fields = append(fields, parseFieldTag(tspec.Name.Name+"."+name.Name, name.Name, extractTypeString(field.Type), tag))
+				}
+			}
+			if tagged {
+				options[tspec.Name.Name] = fields
+			}
+		}
+	}
+}
+
+// parseFieldTag parses the `dsl` tag of a struct field, see extractOptions.
+func parseFieldTag(field, goName, typ, tag string) metaParam {
+	name, opts, _ := strings.Cut(tag, ",")
+	if name == "" {
+		name = strings.ToLower(goName)
+	}
+	param := metaParam{name: name, typ: typ, goName: goName}
+	for opts != "" {
+		var opt string
+		if strings.HasPrefix(opts, "desc=") {
+			opt, opts = opts, ""
+		} else {
+			opt, opts, _ = strings.Cut(opts, ",")
+		}
+		key, value, _ := strings.Cut(strings.TrimSpace(opt), "=")
+		switch key {
+		case "desc":
+			param.desc = value
+		case "unit":
+			param.unit = value
+		case "values":
+			for _, v := range strings.Split(value, "|") {
+				param.values = append(param.values, metaEnumValue{value: v})
+			}
+		case "default":
+			param.def = parseValue(value)
+			if typ == "string" {
+				param.def = value
+			}
+		case "min":
+			param.min = parseValue(value)
+		case "max":
+			param.max = parseValue(value)
+		case "minlen":
+			param.minLen = parseValue(value)
+		case "maxlen":
+			param.maxLen = parseValue(value)
+		default:
+			log.Fatalf("%s: unknown tag option %q", field, key)
+		}
+	}
+	return param
+}
+
+// resolveOptions adds the fields to the struct parameters of the functions,
+// options maps the struct types to their fields, see extractOptions.
+func resolveOptions(functions []metaFunc, options map[string][]metaParam) {
+	for _, fn := range functions {
+		for i, param := range fn.params {
+			if fields, ok := options[param.typ]; ok {
+				fn.params[i].fields = fields
+				fn.params[i].def = nil // the fields have the defaults
+			}
+		}
+	}
+}
+
 func extractVariableMeta(node *ast.File, variables []metaVar) []metaVar {
 	var err error
 	for _, decl := range node.Decls {
-		if vspec, ok := decl.(*ast.GenDecl); ok {
-			for _, spec := range vspec.Specs {
+		if gdecl, ok := decl.(*ast.GenDecl); ok {
+			for _, spec := range gdecl.Specs {
 				if vspec, ok := spec.(*ast.ValueSpec); ok {
-					if vspec.Doc != nil {
+					if vspec.Doc == nil && !gdecl.Lparen.IsValid() {
+						// single declarations without parentheses, e.g. `const maxSize = 8192`
+						vspec.Doc = gdecl.Doc
+					}
+					if vspec.Doc != nil && len(vspec.Values) > 0 {
 						meta := metaVar{
-							orgName: vspec.Names[0].Name,
+							orgName:  vspec.Names[0].Name,
+							readOnly: gdecl.Tok == token.CONST,
 						}
 						switch vspec.Values[0].(type) {
 						case *ast.BasicLit:
@@ -204,9 +590,21 @@ func extractVariableMeta(node *ast.File, variables []metaVar) []metaVar {
 						default:
 							meta.typ = "any"
 						}
+						if vspec.Type != nil {
+							// the declared type wins over the literal, e.g. `var n int32 = 3`
+							meta.typ = extractTypeString(vspec.Type)
+						}
 
 						for _, comment := range vspec.Doc.List {
 							text := strings.TrimSpace(strings.TrimPrefix(comment.Text, "//"))
+							if text == "@Const" || text == "@ReadOnly" {
+								meta.readOnly = true
+								continue
+							}
+							if text == "@Deprecated" {
+								meta.doc.parse("Deprecated", "")
+								continue
+							}
 							if strings.HasPrefix(text, "@") {
 								parts := strings.SplitN(text[1:], ":", 2)
 								if len(parts) < 2 {
@@ -214,13 +612,16 @@ func extractVariableMeta(node *ast.File, variables []metaVar) []metaVar {
 								}
 								key := strings.TrimSpace(parts[0])
 								value := strings.TrimSpace(parts[1])
+								if meta.doc.parse(key, value) {
+									continue
+								}
 								switch key {
 								case "Name":
 									meta.name = value
 								case "Desc":
 									meta.desc = value
 								case "Range":
-									if meta.typ == "bool" || meta.typ == "string" {
+									if meta.typ == "bool" {
 										continue
 									}
 									el := strings.Split(value, "..")
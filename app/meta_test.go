@@ -0,0 +1,86 @@
+package main
+
+import (
+	"fmt"
+	"go/parser"
+	"go/token"
+	"testing"
+)
+
+func TestExamples(t *testing.T) {
+	t.Run("Examples", func(t *testing.T) {
+		type TestCase struct {
+			name    string
+			example string
+			want    metaExample
+		}
+		c := func(name, example string, want metaExample) TestCase {
+			return TestCase{name, example, want}
+		}
+		tests := []TestCase{
+			c("result", `add(1 2) => 3`, metaExample{`add(1 2)`, `3`}),
+			c("type", `blur(img radius=3) => image`, metaExample{`blur(img radius=3)`, `image`}),
+			c("no result", `add(1 2)`, metaExample{`add(1 2)`, ``}),
+			c("lambda", `map({1 2} (x) => mul(x 2)) => {2 4}`, metaExample{`map({1 2} (x) => mul(x 2))`, `{2 4}`}),
+			c("lambda without result", `map({1 2} (x) => mul(x 2))`, metaExample{`map({1 2} (x) => mul(x 2))`, ``}),
+			c("lambda in braces", `apply({ f: (x) => x } 1) => 1`, metaExample{`apply({ f: (x) => x } 1)`, `1`}),
+			c("arrow in string", `concat("a => " "b") => "a => b"`, metaExample{`concat("a => " "b")`, `"a => b"`}),
+			c("escaped quote in string", `concat("\" => " "b") => string`, metaExample{`concat("\" => " "b")`, `string`}),
+		}
+		for _, tt := range tests {
+			t.Run(tt.name, func(t *testing.T) {
+				src := fmt.Sprintf("package test\n\n// @Name: f\n// @Example: %s\nfunc f() {}\n", tt.example)
+				node, err := parser.ParseFile(token.NewFileSet(), "test.go", src, parser.ParseComments)
+				if err != nil {
+					t.Fatal(err)
+				}
+				functions := extractFunctionMeta(node, nil)
+				if len(functions) != 1 || len(functions[0].examples) != 1 {
+					t.Fatalf("extractFunctionMeta() = %+v, want one function with one example", functions)
+				}
+				if got := functions[0].examples[0]; got != tt.want {
+					t.Errorf("example = %+v, want %+v", got, tt.want)
+				}
+			})
+		}
+	})
+}
+
+func TestVariables(t *testing.T) {
+	t.Run("Variables", func(t *testing.T) {
+		type TestCase struct {
+			name string
+			decl string
+			want metaVar
+		}
+		c := func(name, decl string, want metaVar) TestCase {
+			return TestCase{name, decl, want}
+		}
+		tests := []TestCase{
+			c("literal type", `v = 3`, metaVar{typ: "int", def: 3}),
+			c("declared int32", `v int32 = 3`, metaVar{typ: "int32", def: 3}),
+			c("declared float32", `v float32 = 0.5`, metaVar{typ: "float32", def: 0.5}),
+			c("declared float64 of an int", `v float64 = 1`, metaVar{typ: "float64", def: 1}),
+			c("number range", "// @Range: 0..10\n\tv = 3", metaVar{typ: "int", def: 3, min: 0, max: 10}),
+			c("string range", "// @Range: 1..5\n\tv = \"abc\"", metaVar{typ: "string", def: `"abc"`, min: 1, max: 5}),
+			c("no bool range", "// @Range: 0..1\n\tv = true", metaVar{typ: "bool", def: true}),
+		}
+		for _, tt := range tests {
+			t.Run(tt.name, func(t *testing.T) {
+				src := fmt.Sprintf("package test\n\nvar (\n\t// @Name: v\n\t%s\n)\n", tt.decl)
+				node, err := parser.ParseFile(token.NewFileSet(), "test.go", src, parser.ParseComments)
+				if err != nil {
+					t.Fatal(err)
+				}
+				variables := extractVariableMeta(node, nil)
+				if len(variables) != 1 {
+					t.Fatalf("extractVariableMeta() = %+v, want one variable", variables)
+				}
+				got := variables[0]
+				if got.typ != tt.want.typ || got.def != tt.want.def || got.min != tt.want.min || got.max != tt.want.max {
+					t.Errorf("variable = %+v, want %+v", got, tt.want)
+				}
+			})
+		}
+	})
+}
@@ -0,0 +1,388 @@
+package parser
+
+import (
+	"context"
+	"sync"
+)
+
+// Language is a DSL that can be embedded in Go programs. Functions and
+// variables are added with RegisterFunc and RegisterVar, usually by the
+// `dsl_init.go` that go-dsl generates from annotated Go code.
+//
+// A Language can be used by several goroutines, but runs one script at a
+// time: concurrent calls of Run, RunContext and Program.Run wait for each
+// other, and each script runs with its own context.
+type Language struct {
+	dsl *dslCollection
+}
+
+// ParamMeta describes a parameter or return value of a function.
+type ParamMeta struct {
+	Name     string
+	Type     string
+	Default  any
+	Min      any // minimum value, of the elements for slices or "WxH" for images
+	Max      any // maximum value, of the elements for slices or "WxH" for images
+	MinLen   any // minimum length of slices and strings
+	MaxLen   any // maximum length of slices and strings
+	Unit     string
+	Desc     string
+	Variadic bool                  // only the last parameter can be variadic
+	Values   []string              // allowed values, empty if any value is allowed
+	Validate func(value any) error // custom check of the converted argument, can be nil
+	Fields   []ParamMeta           // fields of a struct parameter, the argument is passed as Options
+}
+
+// Example is a usage example of a function. Result is the expected value or
+// type of the result, see Matches.
+type Example struct {
+	Expr   string
+	Result string
+}
+
+// FuncMeta describes a function registered with RegisterFunc.
+type FuncMeta struct {
+	Desc        string
+	Params      []ParamMeta
+	Returns     []ParamMeta
+	Examples    []Example
+	Aliases     []string
+	Category    string
+	Since       string
+	Deprecated  bool
+	Deprecation string // what to use instead, e.g. "use blur instead"
+}
+
+// VarMeta describes a variable registered with RegisterVar.
+type VarMeta struct {
+	Type        string
+	Unit        string
+	Desc        string
+	Min         any
+	Max         any
+	Default     any
+	ReadOnly    bool // only used by RegisterVar, RegisterVarFunc uses a nil setter instead
+	Category    string
+	Since       string
+	Deprecated  bool
+	Deprecation string
+}
+
+// Args are the named arguments of a script, they are passed to Run among
+// the positional ones and referenced by the script as $name, i.e.
+// `l.Run("resize($1 $width)", img, parser.Args{"width": 800})`.
+type Args = dslArgs
+
+// Program is a compiled script that can be run repeatedly without parsing it again.
+type Program struct {
+	l    *Language
+	prog *dslProgram
+}
+
+// New creates a language without any functions or variables.
+func New(id, name, description, version, extension string) *Language {
+	l := &Language{dsl: &dslCollection{mu: &sync.Mutex{}}}
+	l.dsl.initDSL(id, name, description, version, extension, nil)
+	return l
+}
+
+// RegisterFunc adds a function to the language. fn is either a wrapper
+// `func(args ...any) (any, error)` that receives one argument per parameter,
+// converted to the parameter's type and with defaults applied, or any other
+// Go function whose parameters and results are derived with reflection (see
+// reflectFunc). The optional meta describes the function, it can be built
+// with Describe or with ParamsFromTags.
+//
+// Parameters of func type receive the function values passed by scripts.
+// Callbacks without an error result, like `func(float64) float64`, report
+// errors by panicking, which is recovered when fn returns. They must only be
+// called synchronously by fn, not from other goroutines or after fn returned;
+// give them an error result, like `func(float64) (float64, error)`, to call
+// them asynchronously.
+func (l *Language) RegisterFunc(name string, fn any, meta ...FuncMeta) error {
+	if name == "" {
+		return errors.REG_INVALID("function", name, "the name is empty")
+	}
+	if fn == nil {
+		return errors.REG_INVALID("function", name, "the function is nil")
+	}
+	if len(meta) > 1 {
+		return errors.REG_INVALID("function", name, "more than one FuncMeta given")
+	}
+	m := FuncMeta{}
+	if len(meta) == 1 {
+		m = meta[0]
+	}
+	wrapper, ok := fn.(func(args ...any) (any, error))
+	if !ok {
+		var err error
+		if wrapper, m, err = l.reflectFunc(name, fn, m); err != nil {
+			return err
+		}
+	}
+	return l.registerFunc(name, wrapper, m)
+}
+
+func (l *Language) registerFunc(name string, fn func(args ...any) (any, error), meta FuncMeta) error {
+	params := make([]dslParamMeta, len(meta.Params))
+	for i, p := range meta.Params {
+		if p.Variadic && i < len(meta.Params)-1 {
+			return errors.REG_INVALID("function", name, "only the last parameter can be variadic")
+		}
+		params[i] = p.meta()
+	}
+	returns := make([]dslParamMeta, len(meta.Returns))
+	for i, r := range meta.Returns {
+		returns[i] = r.meta()
+	}
+
+	l.dsl.funcs.register(name, meta.Desc, params, returns, fn)
+	for _, ex := range meta.Examples {
+		l.dsl.funcs.addExamples(name, dslExample{expr: ex.Expr, result: ex.Result})
+	}
+	l.dsl.funcs.document(name, dslDocMeta{
+		category:    meta.Category,
+		since:       meta.Since,
+		deprecated:  meta.Deprecated,
+		deprecation: meta.Deprecation,
+	})
+	if len(meta.Aliases) > 0 {
+		l.dsl.funcs.alias(name, meta.Aliases...)
+	}
+	return nil
+}
+
+// RegisterVar adds a variable to the language that is bound to ptr, which must
+// be a non-nil pointer. Its type is derived from the pointer, values assigned
+// by scripts are converted to it. Set meta.ReadOnly for constants.
+func (l *Language) RegisterVar(name string, ptr any, meta ...VarMeta) error {
+	if len(meta) > 1 {
+		return errors.REG_INVALID("variable", name, "more than one VarMeta given")
+	}
+	m := VarMeta{}
+	if len(meta) == 1 {
+		m = meta[0]
+	}
+	get, set, m, err := l.reflectVar(name, ptr, m)
+	if err != nil {
+		return err
+	}
+	return l.RegisterVarFunc(name, get, set, m)
+}
+
+// RegisterVarFunc adds a variable to the language that is read with get and
+// assigned with set. Values are converted to meta.Type and validated before
+// set is called, errors returned by set are reported to the script.
+// Variables without a setter (set is nil) are constants that scripts can
+// read but not assign.
+func (l *Language) RegisterVarFunc(name string, get func() any, set func(value any) error, meta VarMeta) error {
+	if name == "" {
+		return errors.REG_INVALID("variable", name, "the name is empty")
+	}
+	if get == nil {
+		return errors.REG_INVALID("variable", name, "the getter is nil")
+	}
+	l.dsl.vars.register(name, meta.Type, meta.Unit, meta.Desc, meta.Min, meta.Max, meta.Default, get, set)
+	l.dsl.vars.document(name, dslDocMeta{
+		category:    meta.Category,
+		since:       meta.Since,
+		deprecated:  meta.Deprecated,
+		deprecation: meta.Deprecation,
+	})
+	return nil
+}
+
+// AddValidator adds a custom check to the parameter param of the function fn.
+// validator receives the argument converted to the parameter type, its error
+// is reported to the script.
+func (l *Language) AddValidator(fn, param string, validator func(value any) error) error {
+	if validator == nil {
+		return errors.REG_INVALID("validator", fn+"."+param, "the validator is nil")
+	}
+	return l.dsl.funcs.addValidator(fn, param, validator)
+}
+
+// Run executes a script and returns the value of its last statement.
+// The args can be referenced by the script as $1, $2, etc. and, if they are
+// passed as Args, by name. Arguments declared by the script header
+// (`/// @arg ...`) are converted and validated before the script runs.
+func (l *Language) Run(script string, args ...any) (any, error) {
+	return l.RunContext(context.Background(), script, args...)
+}
+
+// RunContext is like Run, but the script stops with the context's error
+// once ctx is canceled. Functions that declare a leading context.Context
+// parameter receive ctx.
+func (l *Language) RunContext(ctx context.Context, script string, args ...any) (any, error) {
+	res, err := l.dsl.runContext(ctx, script, "", nil, false, args...)
+	if res == nil {
+		return nil, err
+	}
+	return res.value, err
+}
+
+// Compile parses a script, so that it can be run repeatedly.
+func (l *Language) Compile(script string) (*Program, error) {
+	l.dsl.mu.Lock()
+	defer l.dsl.mu.Unlock()
+	prog, err := l.dsl.compile(script, "", nil)
+	if err != nil {
+		return nil, err
+	}
+	return &Program{l: l, prog: prog}, nil
+}
+
+// Run executes the program and returns the value of its last statement.
+func (p *Program) Run(args ...any) (any, error) {
+	return p.RunContext(context.Background(), args...)
+}
+
+// RunContext is like Run, but the program stops with the context's error once ctx is canceled.
+func (p *Program) RunContext(ctx context.Context, args ...any) (any, error) {
+	p.l.dsl.mu.Lock()
+	defer p.l.dsl.mu.Unlock()
+	res, err := p.l.dsl.execute(ctx, p.prog, false, args...)
+	if res == nil {
+		return nil, err
+	}
+	return res.value, err
+}
+
+// Args returns the arguments declared by the program's script, by its params
+// block, i.e. `params { width int 1..4096 = 800 "Output width" }`, and by doc
+// comments, i.e. `/// @arg $1 *image.NRGBA The image`. The names of
+// positional arguments are their numbers.
+func (p *Program) Args() []ParamMeta {
+	params := make([]ParamMeta, len(p.prog.args))
+	for i, arg := range p.prog.args {
+		params[i] = ParamMeta{Name: arg.name, Type: arg.typ, Default: arg.def, Min: arg.min, Max: arg.max, Desc: arg.desc}
+	}
+	return params
+}
+
+// Shell starts an interactive shell for the language.
+func (l *Language) Shell() {
+	l.dsl.shell()
+}
+
+// Docs returns the documentation of the language as "markdown", "html" or "text".
+func (l *Language) Docs(format string) string {
+	switch format {
+	case "html":
+		return l.dsl.docHTML()
+	case "text":
+		return l.dsl.docText()
+	}
+	return l.dsl.docMarkdown()
+}
+
+// DocScript returns the documentation of the macros, function values and
+// variables of a script that have doc comments (`/// ...`) as "markdown",
+// "html" or "text".
+func (l *Language) DocScript(script, format string) string {
+	return l.dsl.docScript(script, format)
+}
+
+// ExportVSCodeExtension writes a VSCode extension for the language to path.
+func (l *Language) ExportVSCodeExtension(path string) error {
+	return l.dsl.exportVSCodeExtension(path)
+}
+
+// StoreState remembers the current variables and functions,
+// RestoreState removes everything that was added after it.
+func (l *Language) StoreState() {
+	l.dsl.storeState()
+}
+
+// RestoreState removes the variables and functions added since the last StoreState.
+func (l *Language) RestoreState() {
+	l.dsl.restoreState()
+}
+
+// SetProgressHandler sets the handler that receives progress reports of functions.
+func (l *Language) SetProgressHandler(handler func(fn string, done, total float64)) {
+	l.dsl.setProgressHandler(handler)
+}
+
+// SetWarningHandler sets the handler that receives warnings, e.g. about
+// deprecated functions. By default warnings are printed to stderr.
+func (l *Language) SetWarningHandler(handler func(msg string)) {
+	l.dsl.setWarningHandler(handler)
+}
+
+// Context returns the context of the script that is currently executed,
+// it's passed to functions that declare a leading context.Context parameter.
+func (l *Language) Context() context.Context {
+	return l.dsl.context()
+}
+
+// Progress returns the ProgressReporter passed to the function with the given name.
+func (l *Language) Progress(fn string) ProgressReporter {
+	return l.dsl.progress(fn)
+}
+
+// Cast converts a script value to the given type, e.g. "int" or "*image.NRGBA".
+// Numbers outside the range of the type are reported, i.e. 300 for "uint8".
+func (l *Language) Cast(value any, typ string) (any, error) {
+	return l.dsl.castInRange(value, typ)
+}
+
+// Examples returns the examples of all functions.
+func (l *Language) Examples() []Example {
+	examples := []Example{}
+	for _, name := range l.dsl.funcs.names() {
+		for _, ex := range l.dsl.funcs.get(name).meta.examples {
+			examples = append(examples, Example{Expr: ex.expr, Result: ex.result})
+		}
+	}
+	return examples
+}
+
+// Matches returns true if value is the expected result of the example.
+func (ex Example) Matches(value any) bool {
+	return (&dslExample{expr: ex.Expr, result: ex.Result}).matches(value)
+}
+
+// CastAs converts a value to T, typ is the name of T used by the language,
+// see Language.Cast.
+func CastAs[T any](value any, typ string) (T, error) {
+	return castAs[T](value, typ)
+}
+
+// CastVariadic converts the arguments of a variadic parameter to a slice of T.
+func CastVariadic[T any](value any) []T {
+	return castVariadic[T](value)
+}
+
+// CastOption returns the field name of the Options passed to a struct parameter as T.
+func CastOption[T any](value any, name string) T {
+	return castOption[T](value, name)
+}
+
+// CastFunc converts the function value passed to a parameter of function type to T.
+func CastFunc[T any](value any) T {
+	return castFunc[T](value)
+}
+
+func (p ParamMeta) meta() dslParamMeta {
+	meta := dslParamMeta{
+		name:     p.Name,
+		typ:      p.Type,
+		def:      p.Default,
+		min:      p.Min,
+		max:      p.Max,
+		minLen:   p.MinLen,
+		maxLen:   p.MaxLen,
+		unit:     p.Unit,
+		desc:     p.Desc,
+		variadic: p.Variadic,
+		values:   p.Values,
+	}
+	if p.Validate != nil {
+		meta.validators = append(meta.validators, p.Validate)
+	}
+	for _, f := range p.Fields {
+		meta.fields = append(meta.fields, f.meta())
+	}
+	return meta
+}
@@ -0,0 +1,141 @@
+package parser
+
+import (
+	"bytes"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"strings"
+)
+
+// argFlag is the flag.Value of a named argument declared by a script, the
+// flag is converted to the argument type, checked against its range and
+// stored in the Args passed to the script.
+type argFlag struct {
+	param dslParamMeta
+	args  Args
+}
+
+func (f *argFlag) String() string {
+	if f == nil || f.args == nil {
+		return ""
+	}
+	if v, ok := f.args[f.param.name]; ok {
+		return fmt.Sprint(v)
+	}
+	if f.param.def != nil {
+		return fmt.Sprint(f.param.def)
+	}
+	return ""
+}
+
+func (f *argFlag) Set(s string) error {
+	v, err := f.param.cast(s)
+	if err != nil {
+		return err
+	}
+	if err := validateLimits("argument", "-"+f.param.name, f.param.min, f.param.max, nil, nil, v); err != nil {
+		return err
+	}
+	f.args[f.param.name] = v
+	return nil
+}
+
+// IsBoolFlag lets bool arguments be set without a value, i.e. `-verbose`.
+func (f *argFlag) IsBoolFlag() bool {
+	return f.param.typ == "bool"
+}
+
+// AddFlags defines a flag on fs for each named argument declared by the
+// program's script, i.e. `-width 1024` for `params { width int 1..4096 = 800 }`.
+// Flags are converted and validated when fs is parsed and stored in the
+// returned Args, which are passed to Run among the positional arguments:
+// `prog.Run(fs.Args()[0], args)`. Flags that aren't given take the default
+// of the declaration.
+func (p *Program) AddFlags(fs *flag.FlagSet) Args {
+	args := Args{}
+	for _, param := range p.prog.args {
+		if !param.isNamedArg() {
+			continue
+		}
+		usage := param.desc
+		if bounds := param.bounds(); bounds != "" {
+			usage = strings.TrimSpace(fmt.Sprintf("%s (%s)", usage, bounds))
+		}
+		fs.Var(&argFlag{param: param, args: args}, param.name, usage)
+	}
+	return args
+}
+
+// Schema returns a JSON schema of the named arguments declared by the
+// program's script, so that hosts can render a form for them. The
+// properties are in the order of the declarations, arguments without a
+// default are required.
+func (p *Program) Schema() ([]byte, error) {
+	var (
+		props    []string
+		required = []string{}
+	)
+	for _, param := range p.prog.args {
+		if !param.isNamedArg() {
+			continue
+		}
+		prop := map[string]any{}
+		if typ := schemaType(param.typ); typ != "" {
+			prop["type"] = typ
+		}
+		if param.min != nil {
+			prop["minimum"] = param.min
+		}
+		if param.max != nil {
+			prop["maximum"] = param.max
+		}
+		if param.def != nil {
+			prop["default"] = param.def
+		} else {
+			required = append(required, param.name)
+		}
+		if param.desc != "" {
+			prop["description"] = param.desc
+		}
+		name, err := json.Marshal(param.name)
+		if err != nil {
+			return nil, err
+		}
+		value, err := json.Marshal(prop)
+		if err != nil {
+			return nil, err
+		}
+		props = append(props, string(name)+":"+string(value))
+	}
+	req, err := json.Marshal(required)
+	if err != nil {
+		return nil, err
+	}
+	// the properties are joined by hand, maps would sort them by name
+	schema := `{"type":"object","properties":{` + strings.Join(props, ",") + `},"required":` + string(req) + `}`
+	var buf bytes.Buffer
+	if err := json.Indent(&buf, []byte(schema), "", "  "); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// schemaType returns the JSON schema type of a Go type, or an empty string
+// if values of the type can't be entered in a form, i.e. images.
+func schemaType(typ string) string {
+	switch typ {
+	case "int", "int8", "int16", "int32", "int64", "uint", "uint8", "uint16", "uint32", "uint64":
+		return "integer"
+	case "float32", "float64":
+		return "number"
+	case "bool":
+		return "boolean"
+	case "string":
+		return "string"
+	}
+	if strings.HasPrefix(typ, "[]") {
+		return "array"
+	}
+	return ""
+}
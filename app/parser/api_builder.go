@@ -0,0 +1,129 @@
+package parser
+
+// FuncBuilder builds the metadata of a function step by step. Default, Range,
+// Length, Validate, Unit and Values describe the parameter or return value
+// that was added last:
+//
+//	meta := parser.Describe("Blurs an image").
+//		Param("img", "The image to blur").
+//		Param("radius", "Blur radius").Default(1.0).Range(0.0, 10.0).Unit("px").
+//		Returns("res", "The blurred image").
+//		Example("blur(img 2)", "image").
+//		Meta()
+type FuncBuilder struct {
+	meta FuncMeta
+	last *[]ParamMeta // Params or Returns, whichever was added to last
+}
+
+// Describe starts the metadata of a function with its description.
+func Describe(desc string) *FuncBuilder {
+	return &FuncBuilder{meta: FuncMeta{Desc: desc}}
+}
+
+// Param adds a parameter. Its type is derived from the function by RegisterFunc.
+func (b *FuncBuilder) Param(name, desc string) *FuncBuilder {
+	b.meta.Params = append(b.meta.Params, ParamMeta{Name: name, Desc: desc})
+	b.last = &b.meta.Params
+	return b
+}
+
+// Returns adds a return value. Its type is derived from the function by RegisterFunc.
+func (b *FuncBuilder) Returns(name, desc string) *FuncBuilder {
+	b.meta.Returns = append(b.meta.Returns, ParamMeta{Name: name, Desc: desc})
+	b.last = &b.meta.Returns
+	return b
+}
+
+// Default sets the default value of the last parameter.
+func (b *FuncBuilder) Default(value any) *FuncBuilder {
+	if p := b.current(); p != nil {
+		p.Default = value
+	}
+	return b
+}
+
+// Range sets the minimum and maximum of the last parameter, nil means unbounded.
+func (b *FuncBuilder) Range(min, max any) *FuncBuilder {
+	if p := b.current(); p != nil {
+		p.Min, p.Max = min, max
+	}
+	return b
+}
+
+// Length sets the minimum and maximum length of the last parameter, for
+// slices and strings, nil means unbounded.
+func (b *FuncBuilder) Length(min, max any) *FuncBuilder {
+	if p := b.current(); p != nil {
+		p.MinLen, p.MaxLen = min, max
+	}
+	return b
+}
+
+// Validate sets a custom check of the last parameter.
+func (b *FuncBuilder) Validate(validator func(value any) error) *FuncBuilder {
+	if p := b.current(); p != nil {
+		p.Validate = validator
+	}
+	return b
+}
+
+// Unit sets the unit of the last parameter.
+func (b *FuncBuilder) Unit(unit string) *FuncBuilder {
+	if p := b.current(); p != nil {
+		p.Unit = unit
+	}
+	return b
+}
+
+// Values sets the allowed values of the last parameter.
+func (b *FuncBuilder) Values(values ...string) *FuncBuilder {
+	if p := b.current(); p != nil {
+		p.Values = values
+	}
+	return b
+}
+
+// Example adds a usage example, see Example.Matches for the result.
+func (b *FuncBuilder) Example(expr, result string) *FuncBuilder {
+	b.meta.Examples = append(b.meta.Examples, Example{Expr: expr, Result: result})
+	return b
+}
+
+// Alias adds names the function can also be called by.
+func (b *FuncBuilder) Alias(aliases ...string) *FuncBuilder {
+	b.meta.Aliases = append(b.meta.Aliases, aliases...)
+	return b
+}
+
+// Category sets the category the function is listed under in the docs.
+func (b *FuncBuilder) Category(category string) *FuncBuilder {
+	b.meta.Category = category
+	return b
+}
+
+// Since sets the version that added the function.
+func (b *FuncBuilder) Since(version string) *FuncBuilder {
+	b.meta.Since = version
+	return b
+}
+
+// Deprecated marks the function as deprecated, msg tells what to use instead.
+func (b *FuncBuilder) Deprecated(msg string) *FuncBuilder {
+	b.meta.Deprecated = true
+	b.meta.Deprecation = msg
+	return b
+}
+
+// Meta returns the metadata to pass to RegisterFunc.
+func (b *FuncBuilder) Meta() FuncMeta {
+	return b.meta
+}
+
+// current returns the parameter or return value that was added last,
+// or nil if there is none yet.
+func (b *FuncBuilder) current() *ParamMeta {
+	if b.last == nil || len(*b.last) == 0 {
+		return nil
+	}
+	return &(*b.last)[len(*b.last)-1]
+}
@@ -0,0 +1,444 @@
+package parser
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+	"strconv"
+	"strings"
+)
+
+var (
+	reflectContextType  = reflect.TypeOf((*context.Context)(nil)).Elem()
+	reflectProgressType = reflect.TypeOf((*ProgressReporter)(nil)).Elem()
+)
+
+// reflectType returns the type name the language uses for t.
+func reflectType(t reflect.Type) string {
+	switch {
+	case t.Kind() == reflect.Interface && t.NumMethod() == 0:
+		return "any"
+	case t.Kind() == reflect.Slice:
+		return "[]" + reflectType(t.Elem())
+	case t.Kind() == reflect.Map && t.Key().Kind() == reflect.String:
+		return "map[string]" + reflectType(t.Elem())
+	}
+	return t.String()
+}
+
+// reflectFunc wraps a Go function, so that it can be called by scripts.
+// Leading context.Context and ProgressReporter parameters are injected like
+// in generated code, all other parameters are script parameters. A trailing
+// error result is returned as the error of the call, multiple other results
+// are returned as Tuple. The parameters and returns described by meta must
+// match the function, missing names and types are derived from it.
+func (l *Language) reflectFunc(name string, fn any, meta FuncMeta) (func(args ...any) (any, error), FuncMeta, error) {
+	fv := reflect.ValueOf(fn)
+	ft := fv.Type()
+	if ft.Kind() != reflect.Func {
+		return nil, meta, errors.REG_INVALID("function", name, fmt.Sprintf("expected a function, got %s", ft))
+	}
+
+	// leading parameters supplied by the runtime
+	injected := 0
+	for ; injected < ft.NumIn(); injected++ {
+		t := ft.In(injected)
+		if t != reflectContextType && t != reflectProgressType {
+			break
+		}
+	}
+
+	types := []reflect.Type{}
+	for i := injected; i < ft.NumIn(); i++ {
+		types = append(types, ft.In(i))
+	}
+	variadic := ft.IsVariadic() && len(types) > 0
+	if len(meta.Params) == 0 {
+		meta.Params = make([]ParamMeta, len(types))
+	}
+	if len(meta.Params) != len(types) {
+		return nil, meta, errors.REG_INVALID("function", name, fmt.Sprintf("the function has %d parameters, but %d are described", len(types), len(meta.Params)))
+	}
+	params := make([]ParamMeta, len(types))
+	for i, t := range types {
+		p := meta.Params[i]
+		if p.Name == "" {
+			p.Name = fmt.Sprintf("p%d", i+1)
+		}
+		if variadic && i == len(types)-1 {
+			t = t.Elem()
+			p.Variadic = true
+		} else if p.Variadic {
+			return nil, meta, errors.REG_INVALID("function", name, "only the last parameter can be variadic")
+		}
+		if len(p.Fields) == 0 {
+			fields, err := reflectOptions(t)
+			if err != nil {
+				return nil, meta, err
+			}
+			p.Fields = fields
+		}
+		if err := reflectMeta("function", name, &p, t); err != nil {
+			return nil, meta, err
+		}
+		if p.Default == nil && !p.Variadic && len(p.Fields) == 0 {
+			p.Default = reflectZero(t)
+		}
+		params[i] = p
+	}
+	meta.Params = params
+
+	results := []reflect.Type{}
+	hasError := ft.NumOut() > 0 && ft.Out(ft.NumOut()-1) == reflectErrorType
+	for i := 0; i < ft.NumOut(); i++ {
+		if hasError && i == ft.NumOut()-1 {
+			break
+		}
+		results = append(results, ft.Out(i))
+	}
+	if len(meta.Returns) == 0 {
+		meta.Returns = make([]ParamMeta, len(results))
+	}
+	if len(meta.Returns) != len(results) {
+		return nil, meta, errors.REG_INVALID("function", name, fmt.Sprintf("the function returns %d values, but %d are described", len(results), len(meta.Returns)))
+	}
+	returns := make([]ParamMeta, len(results))
+	for i, t := range results {
+		r := meta.Returns[i]
+		if r.Name == "" {
+			r.Name = "result"
+			if len(results) > 1 {
+				r.Name = fmt.Sprintf("r%d", i+1)
+			}
+		}
+		if err := reflectMeta("function", name, &r, t); err != nil {
+			return nil, meta, err
+		}
+		if r.Default == nil {
+			r.Default = reflectZero(t)
+		}
+		returns[i] = r
+	}
+	meta.Returns = returns
+
+	wrapper := func(args ...any) (any, error) {
+		in := make([]reflect.Value, 0, ft.NumIn())
+		for i := 0; i < injected; i++ {
+			if ft.In(i) == reflectContextType {
+				in = append(in, reflect.ValueOf(l.Context()))
+			} else {
+				in = append(in, reflect.ValueOf(l.Progress(name)))
+			}
+		}
+		for i, t := range types {
+			var arg any
+			if i < len(args) {
+				arg = args[i]
+			}
+			v, err := reflectValue(params[i].Name, arg, t)
+			if err != nil {
+				return nil, err
+			}
+			in = append(in, v)
+		}
+
+		var out []reflect.Value
+		if variadic {
+			out = fv.CallSlice(in)
+		} else {
+			out = fv.Call(in)
+		}
+
+		if hasError {
+			if err, _ := out[len(out)-1].Interface().(error); err != nil {
+				return nil, err
+			}
+			out = out[:len(out)-1]
+		}
+		switch len(out) {
+		case 0:
+			return nil, nil
+		case 1:
+			return out[0].Interface(), nil
+		}
+		res := Tuple{}
+		for _, v := range out {
+			res = append(res, v.Interface())
+		}
+		return res, nil
+	}
+	return wrapper, meta, nil
+}
+
+// reflectVar returns the accessors of the variable ptr points to.
+func (l *Language) reflectVar(name string, ptr any, meta VarMeta) (get func() any, set func(value any) error, _ VarMeta, _ error) {
+	pv := reflect.ValueOf(ptr)
+	if pv.Kind() != reflect.Pointer || pv.IsNil() {
+		return nil, nil, meta, errors.REG_INVALID("variable", name, fmt.Sprintf("expected a non-nil pointer, got %T", ptr))
+	}
+	v := pv.Elem()
+	t := v.Type()
+	p := ParamMeta{Type: meta.Type, Min: meta.Min, Max: meta.Max, Default: meta.Default}
+	if err := reflectMeta("variable", name, &p, t); err != nil {
+		return nil, nil, meta, err
+	}
+	meta.Type, meta.Min, meta.Max, meta.Default = p.Type, p.Min, p.Max, p.Default
+	if meta.Default == nil {
+		meta.Default = v.Interface()
+	}
+
+	get = func() any { return v.Interface() }
+	if !meta.ReadOnly {
+		set = func(value any) error {
+			r, err := reflectValue(name, value, t)
+			if err != nil {
+				return err
+			}
+			v.Set(r)
+			return nil
+		}
+	}
+	return get, set, meta, nil
+}
+
+// reflectMeta derives the type of p from t, or checks that it matches t if it's
+// already set. The default is converted to t, e.g. 1 to 1.0 for float64, min
+// and max to the type of the numbers they limit.
+func reflectMeta(kind, name string, p *ParamMeta, t reflect.Type) error {
+	typ := reflectType(t)
+	if p.Type == "" {
+		p.Type = typ
+	} else if p.Type != typ {
+		return errors.REG_INVALID(kind, name, fmt.Sprintf("%s is %s, but described as %s", p.Name, typ, p.Type))
+	}
+	if p.Default != nil {
+		r, err := reflectValue(p.Name, p.Default, t)
+		if err != nil {
+			return err
+		}
+		p.Default = r.Interface()
+	}
+
+	// min and max limit the elements of slices, they are only converted for
+	// numbers since they are lengths for strings and sizes for images
+	elem := t
+	for elem.Kind() == reflect.Slice {
+		elem = elem.Elem()
+	}
+	if numberKind(reflect.Zero(elem)) == reflect.Invalid {
+		return nil
+	}
+	for _, v := range []*any{&p.Min, &p.Max} {
+		if *v == nil {
+			continue
+		}
+		r, err := reflectValue(p.Name, *v, elem)
+		if err != nil {
+			return err
+		}
+		*v = r.Interface()
+	}
+	return nil
+}
+
+// reflectValue converts a script value to t.
+func reflectValue(name string, value any, t reflect.Type) (reflect.Value, error) {
+	if value == nil {
+		return reflect.Zero(t), nil
+	}
+	v := reflect.ValueOf(value)
+	switch {
+	case v.Type().AssignableTo(t):
+		return v, nil
+	case v.Kind() == reflect.Slice && t.Kind() == reflect.Slice:
+		res := reflect.MakeSlice(t, v.Len(), v.Len())
+		for i := 0; i < v.Len(); i++ {
+			e, err := reflectValue(name, v.Index(i).Interface(), t.Elem())
+			if err != nil {
+				return v, err
+			}
+			res.Index(i).Set(e)
+		}
+		return res, nil
+	case t.Kind() == reflect.Func && v.Type() == reflect.TypeOf(&Func{}):
+		return value.(*Func).as(t), nil
+	case t.Kind() == reflect.Struct && v.Type() == reflect.TypeOf(Options{}):
+		// the fields of a struct parameter, see reflectOptions
+		res := reflect.New(t).Elem()
+		for i := 0; i < t.NumField(); i++ {
+			tag, ok := fieldTag(t.Field(i))
+			field, _, _ := strings.Cut(tag, ",")
+			fv, set := value.(Options)[field]
+			if !ok || !set {
+				continue
+			}
+			f, err := reflectValue(name+"."+field, fv, t.Field(i).Type)
+			if err != nil {
+				return v, err
+			}
+			res.Field(i).Set(f)
+		}
+		return res, nil
+	case t.Kind() == reflect.String && v.Kind() != reflect.String:
+		// Go converts numbers to strings as runes, that's never what a script wants
+	case v.Type().ConvertibleTo(t):
+		return v.Convert(t), nil
+	}
+	return v, errors.REG_VALIDATION_WRONG_TYPE("parameter", name, t.String(), value)
+}
+
+// reflectZero returns the zero value of t, or nil for pointers, slices and
+// other types whose zero value is nil.
+func reflectZero(t reflect.Type) any {
+	switch t.Kind() {
+	case reflect.Pointer, reflect.Slice, reflect.Map, reflect.Interface, reflect.Func, reflect.Chan:
+		return nil
+	}
+	return reflect.Zero(t).Interface()
+}
+
+// ParamsFromTags describes parameters with the fields of the struct v, in the
+// order of the fields. The `dsl` tag of a field holds the name followed by
+// comma separated options, desc must be the last since it can contain commas:
+//
+//	type blurParams struct {
+//		Img    *image.NRGBA `dsl:"img,desc=The image to blur"`
+//		Radius float64      `dsl:"radius,min=0,max=10,default=1,unit=px,desc=Blur radius"`
+//		Mode   string       `dsl:"mode,values=box|gauss,default=box"`
+//		Layers []int        `dsl:"layers,min=0,max=9,minlen=1,variadic"`
+//		Mask   *image.NRGBA `dsl:"mask,min=1x1,max=4096x4096"`
+//	}
+//
+// Fields without a tag use their lowercased name, fields tagged `dsl:"-"` are
+// skipped. The type is that of the field, the element type for variadic fields.
+// min and max limit numbers, the elements of slices, the length of strings and
+// the size of images, minlen and maxlen the length of slices and strings.
+func ParamsFromTags(v any) ([]ParamMeta, error) {
+	t := reflect.TypeOf(v)
+	if t != nil && t.Kind() == reflect.Pointer {
+		t = t.Elem()
+	}
+	if t == nil || t.Kind() != reflect.Struct {
+		return nil, errors.REG_INVALID("parameters", fmt.Sprintf("%T", v), "expected a struct")
+	}
+
+	params := []ParamMeta{}
+	for i := 0; i < t.NumField(); i++ {
+		tag, ok := fieldTag(t.Field(i))
+		if !ok {
+			continue
+		}
+
+		name, opts, _ := strings.Cut(tag, ",")
+		field := t.Field(i)
+		p := ParamMeta{Name: name}
+		ft := field.Type
+		raw := map[string]string{}
+		for opts != "" {
+			var opt string
+			if strings.HasPrefix(opts, "desc=") {
+				opt, opts = opts, ""
+			} else {
+				opt, opts, _ = strings.Cut(opts, ",")
+			}
+			key, value, _ := strings.Cut(strings.TrimSpace(opt), "=")
+			switch key {
+			case "desc":
+				p.Desc = value
+			case "unit":
+				p.Unit = value
+			case "values":
+				p.Values = strings.Split(value, "|")
+			case "variadic":
+				if ft.Kind() != reflect.Slice {
+					return nil, errors.REG_INVALID("parameter", name, "variadic fields must be slices")
+				}
+				p.Variadic = true
+				ft = ft.Elem()
+			case "min", "max", "minlen", "maxlen", "default":
+				raw[key] = value
+			default:
+				return nil, errors.REG_INVALID("parameter", name, fmt.Sprintf("unknown tag option %q", key))
+			}
+		}
+		p.Type = reflectType(ft)
+
+		// min and max limit the elements of slices, the length of strings
+		// and the size of images ("WxH")
+		limit := ft
+		for limit.Kind() == reflect.Slice {
+			limit = limit.Elem()
+		}
+		switch {
+		case limit.Kind() == reflect.String:
+			limit = reflect.TypeOf(0)
+		case numberKind(reflect.Zero(limit)) == reflect.Invalid:
+			limit = reflect.TypeOf("")
+		}
+		types := map[string]reflect.Type{"min": limit, "max": limit, "minlen": reflect.TypeOf(0), "maxlen": reflect.TypeOf(0), "default": ft}
+		for key, dst := range map[string]*any{"min": &p.Min, "max": &p.Max, "minlen": &p.MinLen, "maxlen": &p.MaxLen, "default": &p.Default} {
+			value, ok := raw[key]
+			if !ok {
+				continue
+			}
+			parsed, err := parseTagValue(value, types[key])
+			if err != nil {
+				return nil, errors.REG_INVALID("parameter", name, fmt.Sprintf("invalid %s %q: %s", key, value, err))
+			}
+			*dst = parsed
+		}
+		params = append(params, p)
+	}
+	return params, nil
+}
+
+// fieldTag returns the `dsl` tag of a struct field, the lowercased field name
+// if it has none. ok is false for unexported fields and fields tagged `dsl:"-"`.
+func fieldTag(field reflect.StructField) (tag string, ok bool) {
+	tag, tagged := field.Tag.Lookup("dsl")
+	if tag == "-" || !field.IsExported() {
+		return "", false
+	}
+	if !tagged || tag == "" {
+		tag = strings.ToLower(field.Name)
+	}
+	return tag, true
+}
+
+// reflectOptions returns the fields of t if it's a struct with at least one
+// field tagged `dsl`, such structs are passed as Options by scripts.
+func reflectOptions(t reflect.Type) ([]ParamMeta, error) {
+	if t.Kind() != reflect.Struct {
+		return nil, nil
+	}
+	for i := 0; i < t.NumField(); i++ {
+		if _, ok := t.Field(i).Tag.Lookup("dsl"); ok {
+			return ParamsFromTags(reflect.Zero(t).Interface())
+		}
+	}
+	return nil, nil
+}
+
+// parseTagValue parses the value of a tag option as t.
+func parseTagValue(value string, t reflect.Type) (any, error) {
+	var v any
+	var err error
+	switch t.Kind() {
+	case reflect.String:
+		return value, nil
+	case reflect.Bool:
+		v, err = strconv.ParseBool(value)
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		v, err = strconv.ParseInt(value, 10, t.Bits())
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		v, err = strconv.ParseUint(value, 10, t.Bits())
+	case reflect.Float32, reflect.Float64:
+		v, err = strconv.ParseFloat(value, t.Bits())
+	default:
+		return nil, fmt.Errorf("%s can't be set by tags", t)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return reflect.ValueOf(v).Convert(t).Interface(), nil
+}
@@ -1,4 +1,4 @@
-package main
+package parser
 
 import (
 	"bytes"
@@ -9,6 +9,7 @@ import (
 	"os"
 	"os/exec"
 	"path/filepath"
+	"regexp"
 	"sort"
 	"strings"
 
@@ -108,37 +109,54 @@ func (dsl *dslCollection) defaultColorTheme() *dslColorTheme {
 }
 
 func (dsl *dslCollection) docMarkdown() string {
+	type docParam struct {
+		Name        string
+		Type        string
+		Default     any
+		Min         any
+		Max         any
+		Unit        string
+		Description string
+		Variadic    bool
+		Values      []string
+		Length      string
+		Field       bool // fields of struct parameters are only listed in the table
+	}
+	type docVar struct {
+		Name        string
+		Type        string
+		Default     any
+		Value       any
+		Description string
+		Since       string
+		Deprecated  bool
+		Deprecation string
+	}
+	type docFunc struct {
+		Name        string
+		Description string
+		Params      []docParam
+		Returns     []docParam
+		Examples    []dslExample
+		Aliases     []string
+		Since       string
+		Deprecated  bool
+		Deprecation string
+	}
+	type varGroup struct {
+		Category  string
+		Variables []docVar
+	}
+	type funcGroup struct {
+		Category  string
+		Functions []docFunc
+	}
 	type templateData struct {
 		Name      string
 		Version   string
-		Variables []struct {
-			Name        string
-			Type        string
-			Default     any
-			Description string
-		}
-		Functions []struct {
-			Name        string
-			Description string
-			Params      []struct {
-				Name        string
-				Type        string
-				Default     any
-				Min         any
-				Max         any
-				Unit        string
-				Description string
-			}
-			Returns []struct {
-				Name        string
-				Type        string
-				Default     any
-				Min         any
-				Max         any
-				Unit        string
-				Description string
-			}
-		}
+		Variables []varGroup
+		Constants []varGroup
+		Functions []funcGroup
 	}
 
 	data := templateData{
@@ -147,104 +165,91 @@ func (dsl *dslCollection) docMarkdown() string {
 	}
 
 	// Add variables
-	varNames := dsl.vars.names()
-	sort.Strings(varNames)
-	for _, name := range varNames {
-		v := dsl.vars.get(name)
-		if v == nil {
-			continue
+	categories, groups := dsl.vars.byCategory()
+	for _, category := range categories {
+		variables, constants := varGroup{Category: category}, varGroup{Category: category}
+		for _, name := range groups[category] {
+			v := dsl.vars.get(name)
+			if v == nil {
+				continue
+			}
+			vd := docVar{
+				Name:        name,
+				Type:        v.meta.typ,
+				Default:     v.meta.def,
+				Description: v.meta.desc,
+				Since:       v.meta.doc.since,
+				Deprecated:  v.meta.doc.deprecated,
+				Deprecation: v.meta.doc.deprecation,
+			}
+			if v.meta.readOnly {
+				vd.Value = v.get()
+				constants.Variables = append(constants.Variables, vd)
+				continue
+			}
+			variables.Variables = append(variables.Variables, vd)
+		}
+		if len(variables.Variables) > 0 {
+			data.Variables = append(data.Variables, variables)
+		}
+		if len(constants.Variables) > 0 {
+			data.Constants = append(data.Constants, constants)
 		}
-		data.Variables = append(data.Variables, struct {
-			Name        string
-			Type        string
-			Default     any
-			Description string
-		}{
-			Name:        name,
-			Type:        v.meta.typ,
-			Default:     v.meta.def,
-			Description: v.meta.desc,
-		})
 	}
 
 	// Add functions
-	fnNames := dsl.funcs.names()
-	sort.Strings(fnNames)
-	for _, name := range fnNames {
-		fn := dsl.funcs.get(name)
-		if fn == nil {
-			continue
-		}
+	categories, groups = dsl.funcs.byCategory()
+	for _, category := range categories {
+		group := funcGroup{Category: category}
+		for _, name := range groups[category] {
+			fn := dsl.funcs.get(name)
+			if fn == nil {
+				continue
+			}
 
-		funcData := struct {
-			Name        string
-			Description string
-			Params      []struct {
-				Name        string
-				Type        string
-				Default     any
-				Min         any
-				Max         any
-				Unit        string
-				Description string
+			funcData := docFunc{
+				Name:        name,
+				Description: fn.meta.desc,
+				Examples:    fn.meta.examples,
+				Aliases:     fn.meta.aliases,
+				Since:       fn.meta.doc.since,
+				Deprecated:  fn.meta.doc.deprecated,
+				Deprecation: fn.meta.doc.deprecation,
 			}
-			Returns []struct {
-				Name        string
-				Type        string
-				Default     any
-				Min         any
-				Max         any
-				Unit        string
-				Description string
+
+			// Add parameters
+			for _, param := range fn.meta.docParams() {
+				funcData.Params = append(funcData.Params, docParam{
+					Name:        param.name,
+					Type:        param.typ,
+					Default:     param.def,
+					Min:         param.min,
+					Max:         param.max,
+					Unit:        param.unit,
+					Description: param.desc,
+					Variadic:    param.variadic,
+					Values:      param.values,
+					Length:      param.length(),
+					Field:       param.field,
+				})
 			}
-		}{
-			Name:        name,
-			Description: fn.meta.desc,
-		}
 
-		// Add parameters
-		for _, param := range fn.meta.params {
-			funcData.Params = append(funcData.Params, struct {
-				Name        string
-				Type        string
-				Default     any
-				Min         any
-				Max         any
-				Unit        string
-				Description string
-			}{
-				Name:        param.name,
-				Type:        param.typ,
-				Default:     param.def,
-				Min:         param.min,
-				Max:         param.max,
-				Unit:        param.unit,
-				Description: param.desc,
-			})
-		}
+			// Add return values
+			for _, ret := range fn.meta.returns {
+				funcData.Returns = append(funcData.Returns, docParam{
+					Name:        ret.name,
+					Type:        ret.typ,
+					Default:     ret.def,
+					Min:         ret.min,
+					Max:         ret.max,
+					Unit:        ret.unit,
+					Description: ret.desc,
+				})
+			}
 
-		// Add return values
-		for _, ret := range fn.meta.returns {
-			funcData.Returns = append(funcData.Returns, struct {
-				Name        string
-				Type        string
-				Default     any
-				Min         any
-				Max         any
-				Unit        string
-				Description string
-			}{
-				Name:        ret.name,
-				Type:        ret.typ,
-				Default:     ret.def,
-				Min:         ret.min,
-				Max:         ret.max,
-				Unit:        ret.unit,
-				Description: ret.desc,
-			})
+			group.Functions = append(group.Functions, funcData)
 		}
-
-		data.Functions = append(data.Functions, funcData)
+		data.Functions = append(data.Functions, group)
 	}
 
 	tmpl, err := template.ParseFS(dslTemplates, "template_markdown.tmpl")
@@ -276,9 +281,22 @@ func (dsl *dslCollection) GetLanguageDefinition() (map[string]any, error) {
 			"name":      dsl.name,
 			"scopeName": "source." + dsl.id,
 			"patterns": []map[string]any{
+				// colors before comments, both start with #
+				{
+					"name":  "constant.numeric.color",
+					"match": "#(?:[0-9A-Fa-f]{8}|[0-9A-Fa-f]{6})(?=[\\s;)}\\]]|$)",
+				},
+				{
+					"name":  "comment.line.documentation",
+					"match": "///.*$",
+				},
+				{
+					"name":  "comment.line.double-slash",
+					"match": "//.*$",
+				},
 				{
 					"name":  "comment.block",
-					"begin": "#",
+					"begin": "(?<!\\$)#", // $# is the number of arguments
 					"end":   "#",
 					"patterns": []map[string]any{
 						{
@@ -296,10 +314,19 @@ func (dsl *dslCollection) GetLanguageDefinition() (map[string]any, error) {
 							"name":  "constant.character.escape",
 							"match": "\\\\.",
 						},
+						{
+							"name":  "meta.interpolation",
+							"match": "\\$\\{[^}]*\\}",
+						},
 					},
 				},
 				{
-					"match": "\\bfor\\b",
+					"name":  "string.quoted.other",
+					"begin": "`",
+					"end":   "`",
+				},
+				{
+					"match": "\\b(?:for|in|step|while|break|continue|try|catch)\\b",
 					"name":  "keyword.control.for",
 				},
 				{
@@ -314,9 +341,13 @@ func (dsl *dslCollection) GetLanguageDefinition() (map[string]any, error) {
 					"match": "\\bmacro\\b",
 					"name":  "keyword.control.macro",
 				},
+				{
+					"match": "\\bparams(?=\\s*\\{)",
+					"name":  "keyword.control.params",
+				},
 				{
 					"name":  "constant.numeric",
-					"match": "[-+]?\\d+(?:\\.\\d+)?",
+					"match": "[-+]?\\b(?:0[xX][0-9A-Fa-f_]+|0[bB][01_]+|0[oO][0-7_]+|\\d[\\d_]*(?:\\.\\d[\\d_]*)?(?:[eE][-+]?\\d+)?)(?:u(?:8|16|32|64)?)?\\b",
 				},
 				// Explicit assignment at line start: scopes both variable and operator
 				{
@@ -341,7 +372,11 @@ func (dsl *dslCollection) GetLanguageDefinition() (map[string]any, error) {
 				},
 				{
 					"name":  "variable.parameter",
-					"match": "\\$\\d+",
+					"match": "\\$(?:\\d+|[a-zA-Z_][a-zA-Z0-9_]*|[#@])",
+				},
+				{
+					"name":  "keyword.operator.default",
+					"match": "\\?\\?",
 				},
 				{
 					"name":  "variable.assign",
@@ -353,7 +388,15 @@ func (dsl *dslCollection) GetLanguageDefinition() (map[string]any, error) {
 				},
 				{
 					"name":  "entity.name.function",
-					"match": "[A-Za-z_][A-Za-z0-9_\\-]*(?=\\s*\\()",
+					"match": "[A-Za-z_][A-Za-z0-9_.\\-]*(?=\\s*\\()",
+				},
+				{
+					"name":  "constant.language",
+					"match": dsl.constPattern(),
+				},
+				{
+					"name":  "support.constant",
+					"match": dsl.enumPattern(),
 				},
 				{
 					"name":  "variable.other",
@@ -364,6 +407,7 @@ func (dsl *dslCollection) GetLanguageDefinition() (map[string]any, error) {
 		"configuration": map[string]any{
 			"comments": map[string]string{
 				"blockComment": "#",
+				"lineComment":  "//",
 			},
 			"brackets": [][]string{
 				{"(", ")"},
@@ -416,9 +460,19 @@ func (dsl *dslCollection) GetLanguageDefinition() (map[string]any, error) {
 			},
 			"For Loop": map[string]any{
 				"prefix":      "for",
-				"body":        []string{"for ${1:listName}[${2:i} ${3:item}]", "\t${4:# body #}", "done"},
+				"body":        []string{"for ${1:item} in ${2:listName}", "\t${3:# body #}", "done"},
 				"description": "Create a for loop",
 			},
+			"While Loop": map[string]any{
+				"prefix":      "while",
+				"body":        []string{"while ${1:condition}", "\t${2:# body #}", "done"},
+				"description": "Create a while loop",
+			},
+			"Try Catch": map[string]any{
+				"prefix":      "try",
+				"body":        []string{"try {", "\t${1:# body #}", "} catch ${2:err} {", "\t${3:# handle err.message and err.code #}", "}"},
+				"description": "Handle the errors of a block",
+			},
 			"Include": map[string]any{
 				"prefix":      "include",
 				"body":        []string{"include \"${1:path/to/file}\""},
@@ -704,9 +758,33 @@ func (dsl *dslCollection) GetLanguageDefinition() (map[string]any, error) {
 		},
 	}
 
+	// Add a snippet for each function example
+	snippets := langDef["snippets"].(map[string]any)
+	for _, name := range dsl.funcs.names() {
+		fn := dsl.funcs.get(name)
+		if fn == nil {
+			continue
+		}
+		for i, ex := range fn.meta.examples {
+			desc := fn.meta.desc
+			if ex.result != "" {
+				desc = strings.TrimSpace(desc + " ⮕ " + ex.result)
+			}
+			snippets[fmt.Sprintf("%s example %d", name, i+1)] = map[string]any{
+				"prefix":      name,
+				"body":        []string{snippetEscaper.Replace(ex.expr)},
+				"description": desc,
+			}
+		}
+	}
+
 	return langDef, nil
 }
 
+// snippetEscaper escapes the characters that have a meaning in the body of a
+// VSCode snippet, so that examples like `"\${w}px"` are inserted as they are.
+var snippetEscaper = strings.NewReplacer(`\`, `\\`, `$`, `\$`, `}`, `\}`)
+
 func (dsl *dslCollection) exportVSCodeExtension(pathToVSIXFile string) error {
 	// Get the complete language definition
 	langDef, err := dsl.GetLanguageDefinition()
@@ -898,6 +976,10 @@ export class CustomCompletionProvider implements vscode.CompletionItemProvider {
         return [...Array.from(this.functions.values()), ...Array.from(this.variables.values())];
     }
 
+    public get(name: string): vscode.CompletionItem | undefined {
+        return this.functions.get(name) || this.variables.get(name);
+    }
+
     public resolveCompletionItem(
         item: vscode.CompletionItem,
         token: vscode.CancellationToken
@@ -910,9 +992,72 @@ export class CustomCompletionProvider implements vscode.CompletionItemProvider {
 		return fmt.Errorf("failed to write completion provider: %w", err)
 	}
 
+	// Generate hover provider, it shows the doc comments of the definitions of the script
+	hoverProvider := fmt.Sprintf(`import * as vscode from 'vscode';
+import { CustomCompletionProvider } from './completionProvider';
+
+export class CustomHoverProvider implements vscode.HoverProvider {
+    constructor(private completions: CustomCompletionProvider) {}
+
+    public provideHover(
+        document: vscode.TextDocument,
+        position: vscode.Position,
+        token: vscode.CancellationToken
+    ): vscode.ProviderResult<vscode.Hover> {
+        const range = document.getWordRangeAtPosition(position, /[A-Za-z0-9_-]+/);
+        if (!range) {
+            return undefined;
+        }
+        const word = document.getText(range);
+        const doc = this.scriptDocs(document).get(word);
+        if (doc) {
+            return new vscode.Hover(doc, range);
+        }
+        const item = this.completions.get(word);
+        if (item && item.documentation) {
+            return new vscode.Hover(item.documentation, range);
+        }
+        return undefined;
+    }
+
+    // scriptDocs returns the doc comments (/// ...) of the macros, functions and
+    // variables of the document, they are right above the definitions.
+    private scriptDocs(document: vscode.TextDocument): Map<string, vscode.MarkdownString> {
+        const docComment = new RegExp(%q);
+        const definitions = [new RegExp(%q), new RegExp(%q), new RegExp(%q)];
+        const docs = new Map<string, vscode.MarkdownString>();
+        let lines: string[] = [];
+        for (let i = 0; i < document.lineCount; i++) {
+            const text = document.lineAt(i).text;
+            const comment = docComment.exec(text);
+            if (comment) {
+                lines.push(comment[1]);
+                continue;
+            }
+            for (const definition of lines.length > 0 ? definitions : []) {
+                const match = definition.exec(text);
+                if (match) {
+                    const md = new vscode.MarkdownString();
+                    md.appendCodeblock(text.trim(), '%s');
+                    md.appendMarkdown(lines.join("\n"));
+                    docs.set(match[1], md);
+                    break;
+                }
+            }
+            lines = [];
+        }
+        return docs;
+    }
+}`, reDocComment.String(), reDocMacro.String(), reDocFunc.String(), reDocVar.String(), dsl.id)
+
+	if err := flo.File(filepath.Join(tmpDir, "src", "hoverProvider.ts")).StoreString(hoverProvider); err != nil {
+		return fmt.Errorf("failed to write hover provider: %w", err)
+	}
+
 	// Generate extension.ts
 	extensionTS := fmt.Sprintf(`import * as vscode from 'vscode';
 import { CustomCompletionProvider } from './completionProvider';
+import { CustomHoverProvider } from './hoverProvider';
 
 export function activate(context: vscode.ExtensionContext) {
     const completionProvider = new CustomCompletionProvider();
@@ -921,11 +1066,15 @@ export function activate(context: vscode.ExtensionContext) {
         completionProvider,
         '(', ':', ' ', '='
     );
+    const hoverProviderDisposable = vscode.languages.registerHoverProvider(
+        '%s',
+        new CustomHoverProvider(completionProvider)
+    );
 
-    context.subscriptions.push(completionProviderDisposable);
+    context.subscriptions.push(completionProviderDisposable, hoverProviderDisposable);
 }
 
-export function deactivate() {}`, dsl.id)
+export function deactivate() {}`, dsl.id, dsl.id)
 
 	if err := flo.File(filepath.Join(tmpDir, "src", "extension.ts")).StoreString(extensionTS); err != nil {
 		return fmt.Errorf("failed to write extension.ts: %w", err)
@@ -993,22 +1142,79 @@ func (dsl *dslCollection) generateFunctionCode() string {
 
 		params := make([]string, len(fn.meta.params))
 		for i, param := range fn.meta.params {
-			params[i] = "{ name: \"" + param.name + "\", type: \"" + param.typ + "\", description: \"" + param.desc + "\" }"
+			name, typ := param.name, param.typ
+			if param.variadic {
+				name, typ = name+"...", "..."+typ
+			}
+			params[i] = "{ name: \"" + name + "\", type: \"" + typ + "\", description: \"" + param.desc + "\" }"
 		}
 
 		returnType := "any"
-		if len(fn.meta.returns) > 0 {
+		if len(fn.meta.returns) == 1 {
 			returnType = fn.meta.returns[0].typ
+		} else if len(fn.meta.returns) > 1 {
+			returnTypes := make([]string, len(fn.meta.returns))
+			for i, ret := range fn.meta.returns {
+				returnTypes[i] = ret.typ
+			}
+			returnType = "(" + strings.Join(returnTypes, ", ") + ")"
 		}
 
-		sb.WriteString("this.addFunction(\"" + name + "\", \"" + fn.meta.desc + "\", [" + strings.Join(params, ", ") + "], \"" + returnType + "\");\n")
+		for _, name := range append([]string{name}, fn.meta.aliases...) {
+			sb.WriteString("this.addFunction(\"" + name + "\", \"" + fn.meta.desc + "\", [" + strings.Join(params, ", ") + "], \"" + returnType + "\");\n")
+		}
 	}
 	return sb.String()
 }
 
+// enumPattern returns a TextMate pattern matching the allowed values of all
+// function parameters. It matches nothing if no parameter restricts its values.
+func (dsl *dslCollection) enumPattern() string {
+	seen := map[string]bool{}
+	values := []string{}
+	for _, name := range dsl.funcs.names() {
+		fn := dsl.funcs.get(name)
+		if fn == nil {
+			continue
+		}
+		for _, param := range fn.meta.params {
+			for _, v := range param.values {
+				if !seen[v] {
+					seen[v] = true
+					values = append(values, regexp.QuoteMeta(v))
+				}
+			}
+		}
+	}
+	if len(values) == 0 {
+		return "(?!x)x"
+	}
+	sort.Strings(values)
+	return "\\b(?:" + strings.Join(values, "|") + ")\\b(?!\\s*[:(])"
+}
+
+// constPattern returns a TextMate pattern matching the names of all constants.
+// It matches nothing if there are no constants.
+func (dsl *dslCollection) constPattern() string {
+	names := []string{}
+	for _, name := range dsl.vars.names() {
+		if v := dsl.vars.get(name); v != nil && v.meta.readOnly {
+			names = append(names, regexp.QuoteMeta(name))
+		}
+	}
+	if len(names) == 0 {
+		return "(?!x)x"
+	}
+	return "\\b(?:" + strings.Join(names, "|") + ")\\b(?!\\s*\\()"
+}
+
 func (dsl *dslCollection) generateVariableCode() string {
 	var sb strings.Builder
-	for name, variable := range dsl.vars.data {
+	for _, name := range dsl.vars.names() {
+		variable := dsl.vars.get(name)
+		if variable == nil {
+			continue
+		}
 		sb.WriteString("this.addVariable(\"" + name + "\", \"" + variable.meta.typ + "\", \"" + variable.meta.desc + "\");\n")
 	}
 	return sb.String()
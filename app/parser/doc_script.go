@@ -0,0 +1,162 @@
+package parser
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// dslScriptDoc is a definition of a script that is documented by the doc
+// comments (`/// ...`) right above it, i.e. `macro twice(img) { ... };`,
+// `double: (x) => mul(x 2)` or `width: 800`.
+type dslScriptDoc struct {
+	name   string
+	kind   string // "macro", "func" or "var"
+	params []string
+	desc   string
+	line   int
+}
+
+// signature returns how the definition is used, i.e. `{{ twice(img) }}` for
+// macros, `double(x)` for functions and `width` for variables.
+func (d *dslScriptDoc) signature() string {
+	switch d.kind {
+	case "macro":
+		return fmt.Sprintf("{{ %s(%s) }}", d.name, strings.Join(d.params, "; "))
+	case "func":
+		return fmt.Sprintf("%s(%s)", d.name, strings.Join(d.params, " "))
+	}
+	return d.name
+}
+
+var (
+	reDocComment = regexp.MustCompile(`^\s*///\s?(.*)$`)                                      // Match: /// text
+	reDocMacro   = regexp.MustCompile(`^\s*macro\s*([a-zA-Z0-9-]{1,})\((.*?)\)`)              // Match: macro name(params)
+	reDocFunc    = regexp.MustCompile(`^\s*([a-zA-Z_][a-zA-Z0-9_-]*)\s*:\s*\(([^)]*)\)\s*=>`) // Match: name: (params) =>
+	reDocVar     = regexp.MustCompile(`^\s*([a-zA-Z_][a-zA-Z0-9_-]*)\s*:`)                    // Match: name:
+)
+
+// parseScriptDocs returns the documented definitions of a script in the order
+// they are defined. Consecutive doc comments are joined, they must be directly
+// above the definition. Doc comments that declare arguments (`/// @arg ...`)
+// are the header of the script, not the documentation of a definition.
+func (dsl *dslCollection) parseScriptDocs(script string) []*dslScriptDoc {
+	var (
+		docs   []*dslScriptDoc
+		desc   []string
+		header bool
+	)
+	for i, line := range strings.Split(script, "\n") {
+		if m := reDocComment.FindStringSubmatch(line); m != nil {
+			if strings.HasPrefix(m[1], "@arg") {
+				header = true
+				continue
+			}
+			desc = append(desc, strings.TrimRight(m[1], " \t\r"))
+			continue
+		}
+		if len(desc) > 0 && !header {
+			if doc := dsl.parseScriptDefinition(line); doc != nil {
+				doc.desc = strings.TrimSpace(strings.Join(desc, "\n"))
+				doc.line = i + 1
+				docs = append(docs, doc)
+			}
+		}
+		desc = nil
+		header = false
+	}
+	return docs
+}
+
+// parseScriptDefinition returns the definition in line, or nil if the line
+// doesn't define a macro, function or variable.
+func (dsl *dslCollection) parseScriptDefinition(line string) *dslScriptDoc {
+	if m := reDocMacro.FindStringSubmatch(line); m != nil {
+		return &dslScriptDoc{name: m[1], kind: "macro", params: strings.Fields(m[2])}
+	}
+	if m := reDocFunc.FindStringSubmatch(line); m != nil {
+		return &dslScriptDoc{name: m[1], kind: "func", params: strings.Fields(m[2])}
+	}
+	if m := reDocVar.FindStringSubmatch(line); m != nil {
+		return &dslScriptDoc{name: m[1], kind: "var"}
+	}
+	return nil
+}
+
+// docScriptArgs returns the documentation of the arguments declared by the
+// params block and the doc comments of a script, or an empty string if it
+// declares none.
+func (dsl *dslCollection) docScriptArgs(script string) string {
+	_, params, err := dsl.scriptArgs(script)
+	if err != nil {
+		return fmt.Sprintf("## Arguments\n\n%v\n\n", err)
+	}
+	if len(params) == 0 {
+		return ""
+	}
+	var sb strings.Builder
+	sb.WriteString("## Arguments\n\n")
+	for _, param := range params {
+		details := []string{"`" + param.typ + "`"}
+		if bounds := param.bounds(); bounds != "" {
+			details = append(details, bounds)
+		}
+		if param.def != nil {
+			details = append(details, fmt.Sprintf("default `%v`", param.def))
+		} else {
+			details = append(details, "required")
+		}
+		fmt.Fprintf(&sb, "- `$%s` (%s)", param.name, strings.Join(details, ", "))
+		if param.desc != "" {
+			sb.WriteString(": " + param.desc)
+		}
+		sb.WriteString("\n")
+	}
+	sb.WriteString("\n")
+	return sb.String()
+}
+
+// docScriptMarkdown returns the documentation of the arguments and the
+// documented definitions of a script, grouped into macros, functions and
+// variables.
+func (dsl *dslCollection) docScriptMarkdown(script string) string {
+	groups := []struct {
+		kind, title string
+	}{
+		{"macro", "Macros"},
+		{"func", "Functions"},
+		{"var", "Variables"},
+	}
+	docs := dsl.parseScriptDocs(script)
+	var sb strings.Builder
+	sb.WriteString(dsl.docScriptArgs(script))
+	for _, group := range groups {
+		title := false
+		for _, doc := range docs {
+			if doc.kind != group.kind {
+				continue
+			}
+			if !title {
+				fmt.Fprintf(&sb, "## %s\n\n", group.title)
+				title = true
+			}
+			fmt.Fprintf(&sb, "### `%s`\n\n%s\n\n", doc.signature(), doc.desc)
+		}
+	}
+	if sb.Len() == 0 {
+		return "No documented definitions found.\n"
+	}
+	return sb.String()
+}
+
+// docScript returns the documentation of a script as "markdown", "html" or "text".
+func (dsl *dslCollection) docScript(script, format string) string {
+	md := dsl.docScriptMarkdown(script)
+	switch format {
+	case "html":
+		return dsl.renderMarkdownToHTML(md)
+	case "text":
+		return dsl.renderMarkdownToTerminal(md)
+	}
+	return md
+}
@@ -1,11 +1,13 @@
-package main
+package parser
 
 import (
 	"bufio"
+	"context"
 	"fmt"
 	"os"
 	"path/filepath"
 	"regexp"
+	"strconv"
 	"strings"
 	"sync"
 
@@ -24,6 +26,11 @@ func (dsl *dslCollection) initDSL(id, name, description, version, extension stri
 	dsl.version = version
 	dsl.extension = extension
 	dsl.theme = theme
+	dsl.docs = make(map[string]*dslScriptDoc)
+	dsl.exec = &dslExecState{
+		mu:        &sync.Mutex{},
+		onWarning: printWarning,
+	}
 	dsl.tokenizer = &dslTokenizer{
 		source: "",
 		pos:    0,
@@ -42,8 +49,9 @@ func (dsl *dslCollection) initDSL(id, name, description, version, extension stri
 		},
 	}
 	dsl.funcs = &dslFnRegistry{
-		mu:   &sync.Mutex{},
-		data: make(map[string]*dslFnType),
+		mu:      &sync.Mutex{},
+		data:    make(map[string]*dslFnType),
+		aliases: make(map[string]string),
 		state: &dslRegistryState{
 			data:      make(map[string]any),
 			new:       make(map[string]any),
@@ -261,9 +269,34 @@ func (dsl *dslCollection) expandMacros(script string) (string, error) {
 // The debug parameter enables verbose output of the execution process.
 // The args parameter allows passing arguments to the script.
 func (dsl *dslCollection) run(script, baseDir string, replacements map[string]string, debug bool, args ...any) (*dslResult, error) {
+	return dsl.runContext(context.Background(), script, baseDir, replacements, debug, args...)
+}
+
+// runContext is like run, but the script is executed with the given context.
+// Execution stops with the context's error once it's canceled, and functions
+// that declare a leading context.Context parameter receive ctx.
+func (dsl *dslCollection) runContext(ctx context.Context, script, baseDir string, replacements map[string]string, debug bool, args ...any) (*dslResult, error) {
 	dsl.mu.Lock()
 	defer dsl.mu.Unlock()
 
+	prog, err := dsl.compile(script, baseDir, replacements)
+	if err != nil {
+		return nil, err
+	}
+	return dsl.execute(ctx, prog, debug, args...)
+}
+
+// dslProgram is a parsed script that can be executed repeatedly.
+type dslProgram struct {
+	ast          *dslNode
+	source       string         // the preprocessed script, used for error messages
+	line, column int            // position of the tokenizer after parsing
+	args         []dslParamMeta // arguments declared by the header of the script
+}
+
+// compile preprocesses, tokenizes and parses a script.
+// The caller must hold dsl.mu.
+func (dsl *dslCollection) compile(script, baseDir string, replacements map[string]string) (*dslProgram, error) {
 	dsl.macros = make(map[string]*dslMacro)
 
 	script, err := dsl.expandIncludes(script, baseDir, nil)
@@ -271,6 +304,15 @@ func (dsl *dslCollection) run(script, baseDir string, replacements map[string]st
 		return nil, err
 	}
 
+	for _, doc := range dsl.parseScriptDocs(script) {
+		dsl.docs[doc.name] = doc
+	}
+
+	script, declared, err := dsl.scriptArgs(script)
+	if err != nil {
+		return nil, err
+	}
+
 	script, err = dsl.parseMacros(script)
 	if err != nil {
 		return nil, err
@@ -300,7 +342,7 @@ func (dsl *dslCollection) run(script, baseDir string, replacements map[string]st
 	}
 
 	dsl.trimSpace(&script)
-	dsl.load(script, args...)
+	dsl.load(script)
 
 	if err := dsl.tokenizer.tokenize(); err != nil {
 		return nil, formatErrorWithPosition(err, dsl.tokenizer.source, dsl.tokenizer.state.Line, dsl.tokenizer.state.Column)
@@ -318,6 +360,7 @@ func (dsl *dslCollection) run(script, baseDir string, replacements map[string]st
 
 	if len(dsl.parser.tokens) == 1 {
 		token := dsl.parser.tokens[0]
+		line, col := dsl.tokenPosition(token)
 		switch token.Type {
 		case tokens.argRef:
 			firstNode = &dslNode{
@@ -328,29 +371,51 @@ func (dsl *dslCollection) run(script, baseDir string, replacements map[string]st
 				argName:  "",
 			}
 		case tokens.integer:
+			val, err := dsl.parseInteger(token.Value)
+			if err != nil {
+				return nil, formatErrorWithPosition(errors.PSR_NUMBER_INVALID(token.Value), dsl.tokenizer.source, line, col)
+			}
 			firstNode = &dslNode{
 				kind:     nodes.integer,
+				data:     strconv.FormatInt(val, 10),
+				children: []*dslNode{},
+				named:    false,
+				argName:  "",
+			}
+		case tokens.uinteger:
+			if _, err := dsl.parseUnsigned(token.Value); err != nil {
+				return nil, formatErrorWithPosition(err, dsl.tokenizer.source, line, col)
+			}
+			firstNode = &dslNode{
+				kind:     nodes.uinteger,
 				data:     token.Value,
 				children: []*dslNode{},
 				named:    false,
 				argName:  "",
 			}
-		case tokens.float:
+		case tokens.color:
+			if _, err := dsl.parseColor(token.Value); err != nil {
+				return nil, formatErrorWithPosition(err, dsl.tokenizer.source, line, col)
+			}
 			firstNode = &dslNode{
-				kind:     nodes.float,
+				kind:     nodes.color,
 				data:     token.Value,
 				children: []*dslNode{},
 				named:    false,
 				argName:  "",
 			}
-		case tokens.str:
+		case tokens.float:
 			firstNode = &dslNode{
-				kind:     nodes.str,
+				kind:     nodes.float,
 				data:     token.Value,
 				children: []*dslNode{},
 				named:    false,
 				argName:  "",
 			}
+		case tokens.str:
+			if firstNode, err = dsl.parser.parseString(token); err != nil {
+				return nil, formatErrorWithPosition(err, dsl.tokenizer.source, line, col)
+			}
 		case tokens.boolean:
 			firstNode = &dslNode{
 				kind:     nodes.boolean,
@@ -359,6 +424,8 @@ func (dsl *dslCollection) run(script, baseDir string, replacements map[string]st
 				named:    false,
 				argName:  "",
 			}
+		case tokens.comment:
+			// a script that is just a comment has no statements
 		default:
 			firstNode = &dslNode{
 				kind:     nodes.varRef,
@@ -380,7 +447,8 @@ func (dsl *dslCollection) run(script, baseDir string, replacements map[string]st
 
 		node, err := dsl.parser.parseNode()
 		if err != nil {
-			return nil, formatErrorWithPosition(err, dsl.tokenizer.source, dsl.tokenizer.state.Line, dsl.tokenizer.state.Column)
+			line, col := dsl.tokenPosition(dsl.parser.curr)
+			return nil, formatErrorWithPosition(err, dsl.tokenizer.source, line, col)
 		}
 		if node != nil {
 			if firstNode == nil {
@@ -404,20 +472,56 @@ func (dsl *dslCollection) run(script, baseDir string, replacements map[string]st
 		return nil, fmt.Errorf("no nodes to evaluate: script may be empty or contain only comments")
 	}
 
+	return &dslProgram{
+		ast:    ast,
+		source: dsl.tokenizer.source,
+		line:   dsl.tokenizer.state.Line,
+		column: dsl.tokenizer.state.Column,
+		args:   declared,
+	}, nil
+}
+
+// tokenPosition returns the position of a token for errors, or the position
+// of the tokenizer if the token has none.
+func (dsl *dslCollection) tokenPosition(token *dslToken) (line, col int) {
+	if token != nil && token.Line > 0 {
+		return token.Line, token.Column
+	}
+	return dsl.tokenizer.state.Line, dsl.tokenizer.state.Column
+}
+
+// execute evaluates a compiled program with the given context and script arguments.
+// The caller must hold dsl.mu.
+func (dsl *dslCollection) execute(ctx context.Context, prog *dslProgram, debug bool, args ...any) (*dslResult, error) {
+	dsl.setContext(ctx)
+	defer dsl.setContext(nil)
+	dsl.resetWarnings()
+	args, named := dsl.splitArgs(args)
+	args, err := dsl.bindArgs(prog.args, args, named)
+	if err != nil {
+		return nil, err
+	}
+	dsl.parser.args = args
+	dsl.parser.named = named
+
 	var result *dslResult
+	ast := prog.ast
 	for ast != nil {
 		if debug {
 			fmt.Println(ast.toTree())
 		}
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
 		res, err := dsl.parser.evaluateNode(ast)
 		result = &dslResult{res, err}
 		if err != nil {
 			// Use node position if available, otherwise fall back to tokenizer state
-			line, col := dsl.tokenizer.state.Line, dsl.tokenizer.state.Column
+			line, col := prog.line, prog.column
 			if ast.Line > 0 {
 				line, col = ast.Line, ast.Column
 			}
-			result.err = formatErrorWithPosition(err, dsl.tokenizer.source, line, col)
+			result.err = formatErrorWithPosition(err, prog.source, line, col)
 			break
 		}
 		ast = ast.next
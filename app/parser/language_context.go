@@ -0,0 +1,135 @@
+package parser
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"sync"
+)
+
+// ProgressReporter is injected into functions that declare it as a leading
+// parameter, long running functions can use it to report their progress.
+// It is not exposed as a parameter to scripts.
+type ProgressReporter interface {
+	Report(done, total float64)
+}
+
+// dslExecState holds the state of the current script execution.
+// It is shared by pointer so that copies of the collection see the same state.
+// A collection executes one script at a time, execute is called with dsl.mu
+// held, so ctx, warned and depth belong to the only running execution and
+// concurrent runs wait for it instead of sharing them.
+type dslExecState struct {
+	mu         *sync.Mutex
+	ctx        context.Context
+	onProgress func(fn string, done, total float64)
+	onWarning  func(msg string)
+	warned     map[string]bool // warnings already shown during the current execution
+	depth      int             // nesting of the function value calls, see enterCall
+}
+
+// maxCallDepth limits the nesting of function value calls, so that endless
+// recursion like `f: (x) => f(x)` fails with an error instead of exhausting
+// the stack, which would crash the host.
+const maxCallDepth = 1000
+
+// dslProgressReporter forwards progress reports of a function to the
+// handler registered with setProgressHandler.
+type dslProgressReporter struct {
+	exec *dslExecState
+	fn   string
+}
+
+func (r *dslProgressReporter) Report(done, total float64) {
+	r.exec.mu.Lock()
+	handler := r.exec.onProgress
+	r.exec.mu.Unlock()
+	if handler != nil {
+		handler(r.fn, done, total)
+	}
+}
+
+// context returns the context of the script that is currently executed.
+// Functions that declare a leading context.Context parameter receive it.
+func (dsl *dslCollection) context() context.Context {
+	dsl.exec.mu.Lock()
+	defer dsl.exec.mu.Unlock()
+	if dsl.exec.ctx == nil {
+		return context.Background()
+	}
+	return dsl.exec.ctx
+}
+
+func (dsl *dslCollection) setContext(ctx context.Context) {
+	dsl.exec.mu.Lock()
+	defer dsl.exec.mu.Unlock()
+	dsl.exec.ctx = ctx
+}
+
+// enterCall counts a call of a function value, it fails if the calls are
+// nested deeper than maxCallDepth. Every successful call must be followed by
+// leaveCall.
+func (dsl *dslCollection) enterCall() error {
+	dsl.exec.mu.Lock()
+	defer dsl.exec.mu.Unlock()
+	if dsl.exec.depth >= maxCallDepth {
+		return errors.PSR_CALL_DEPTH(maxCallDepth)
+	}
+	dsl.exec.depth++
+	return nil
+}
+
+// leaveCall ends a call counted by enterCall.
+func (dsl *dslCollection) leaveCall() {
+	dsl.exec.mu.Lock()
+	defer dsl.exec.mu.Unlock()
+	dsl.exec.depth--
+}
+
+// progress returns the ProgressReporter injected into the function with the given name.
+func (dsl *dslCollection) progress(fn string) ProgressReporter {
+	return &dslProgressReporter{exec: dsl.exec, fn: fn}
+}
+
+// setProgressHandler sets the handler that receives progress reports of functions.
+// Pass nil to ignore progress reports.
+func (dsl *dslCollection) setProgressHandler(handler func(fn string, done, total float64)) {
+	dsl.exec.mu.Lock()
+	defer dsl.exec.mu.Unlock()
+	dsl.exec.onProgress = handler
+}
+
+// warn shows msg using the warning handler, each message is only shown once per execution.
+func (dsl *dslCollection) warn(msg string) {
+	dsl.exec.mu.Lock()
+	handler := dsl.exec.onWarning
+	seen := dsl.exec.warned[msg]
+	if dsl.exec.warned == nil {
+		dsl.exec.warned = map[string]bool{}
+	}
+	dsl.exec.warned[msg] = true
+	dsl.exec.mu.Unlock()
+	if handler != nil && !seen {
+		handler(msg)
+	}
+}
+
+// resetWarnings allows all warnings to be shown again, it's called when a script is executed.
+func (dsl *dslCollection) resetWarnings() {
+	dsl.exec.mu.Lock()
+	defer dsl.exec.mu.Unlock()
+	dsl.exec.warned = nil
+}
+
+// setWarningHandler sets the handler that receives warnings, e.g. about deprecated functions.
+// By default warnings are printed to stderr, pass nil to ignore them.
+func (dsl *dslCollection) setWarningHandler(handler func(msg string)) {
+	dsl.exec.mu.Lock()
+	defer dsl.exec.mu.Unlock()
+	dsl.exec.onWarning = handler
+}
+
+// printWarning is the default warning handler.
+func printWarning(msg string) {
+	fmt.Fprintf(os.Stderr, "\x1b[33mWarning: %s\x1b[0m\n", msg)
+}
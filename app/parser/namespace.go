@@ -1,7 +1,9 @@
-package main
+package parser
 
 import (
 	"fmt"
+	"reflect"
+	"strings"
 	"sync"
 )
 
@@ -35,6 +37,20 @@ var (
 		rowEnd     dslTokenType
 		forLoop    dslTokenType
 		done       dslTokenType
+		mapKey     dslTokenType
+		rangeSep   dslTokenType
+		member     dslTokenType
+		arrow      dslTokenType
+		whileLoop  dslTokenType
+		breakLoop  dslTokenType
+		contLoop   dslTokenType
+		rangeOp    dslTokenType
+		tryBlock   dslTokenType
+		catchBlock dslTokenType
+		blockStart dslTokenType
+		blockEnd   dslTokenType
+		color      dslTokenType
+		defaultOp  dslTokenType
 	}{
 		invalid:    "INVALID",
 		argRef:     "ARG_REF",
@@ -64,45 +80,88 @@ var (
 		rowEnd:     "ROW_END",
 		forLoop:    "FOR_LOOP",
 		done:       "DONE",
+		mapKey:     "MAP_KEY",
+		rangeSep:   "RANGE",
+		member:     "MEMBER",
+		arrow:      "ARROW",
+		whileLoop:  "WHILE_LOOP",
+		breakLoop:  "BREAK",
+		contLoop:   "CONTINUE",
+		rangeOp:    "RANGE_OP",
+		tryBlock:   "TRY",
+		catchBlock: "CATCH",
+		blockStart: "BLOCK_START",
+		blockEnd:   "BLOCK_END",
+		color:      "COLOR",
+		defaultOp:  "DEFAULT_OP",
 	}
 	nodes = struct {
-		call       dslNodeKind
-		arg        dslNodeKind
-		varRef     dslNodeKind
-		str        dslNodeKind
-		float      dslNodeKind
-		integer    dslNodeKind
-		boolean    dslNodeKind
-		assign     dslNodeKind
-		terminator dslNodeKind
-		argRef     dslNodeKind
-		slice      dslNodeKind
-		index      dslNodeKind
-		matrix     dslNodeKind
-		row        dslNodeKind
-		forRange   dslNodeKind
+		call        dslNodeKind
+		arg         dslNodeKind
+		varRef      dslNodeKind
+		str         dslNodeKind
+		float       dslNodeKind
+		integer     dslNodeKind
+		boolean     dslNodeKind
+		assign      dslNodeKind
+		terminator  dslNodeKind
+		argRef      dslNodeKind
+		slice       dslNodeKind
+		index       dslNodeKind
+		matrix      dslNodeKind
+		row         dslNodeKind
+		forRange    dslNodeKind
+		dict        dslNodeKind
+		indexRange  dslNodeKind
+		indexAssign dslNodeKind
+		member      dslNodeKind
+		lambda      dslNodeKind
+		whileLoop   dslNodeKind
+		breakLoop   dslNodeKind
+		contLoop    dslNodeKind
+		numRange    dslNodeKind
+		tryBlock    dslNodeKind
+		block       dslNodeKind
+		strTemplate dslNodeKind
+		uinteger    dslNodeKind
+		color       dslNodeKind
 	}{
-		call:       0,
-		arg:        1,
-		varRef:     2,
-		str:        3,
-		float:      4,
-		integer:    5,
-		boolean:    6,
-		assign:     7,
-		terminator: 8,
-		argRef:     9,
-		slice:      10,
-		index:      11,
-		matrix:     12,
-		row:        13,
-		forRange:   14,
+		call:        0,
+		arg:         1,
+		varRef:      2,
+		str:         3,
+		float:       4,
+		integer:     5,
+		boolean:     6,
+		assign:      7,
+		terminator:  8,
+		argRef:      9,
+		slice:       10,
+		index:       11,
+		matrix:      12,
+		row:         13,
+		forRange:    14,
+		dict:        15,
+		indexRange:  16,
+		indexAssign: 17,
+		member:      18,
+		lambda:      19,
+		whileLoop:   20,
+		breakLoop:   21,
+		contLoop:    22,
+		numRange:    23,
+		tryBlock:    24,
+		block:       25,
+		strTemplate: 26,
+		uinteger:    27,
+		color:       28,
 	}
 	errors = struct {
 		UNSUPPORTED_TARGET_TYPE             func(typ string) error
 		STRING_CAST                         func(str, typ string) error
 		NIL_CAST                            func() error
 		CAST_NOT_POSSIBLE                   func(source, target string) error
+		CAST_OUT_OF_RANGE                   func(value any, target string) error
 		UNSUPPORTED_SOURCE_TYPE             func(v any) error
 		TKN_ASSIGN_VALUE_MISSING            func() error
 		TKN_ASSIGN_NAME_MISSING             func() error
@@ -116,9 +175,18 @@ var (
 		TKN_UNTERMINATED_ARG                func(pos int) error
 		TKN_ASSIGN_UNEXPECTED               func(pos int) error
 		TKN_INVALID_ARG_REF                 func(pos int, reason string) error
+		TKN_MAP_KEY_MISSING                 func(pos int) error
+		TKN_INVALID_ESCAPE                  func(pos int, seq string) error
+		TKN_INTERPOLATION_EMPTY             func(pos int) error
 		REG_VALIDATION_WRONG_TYPE           func(typ, name, expected string, got any) error
 		REG_VALIDATION_OUT_OF_BOUNDS        func(typ, name string, min, max, got any) error
 		REG_VALIDATION_OUT_OF_BOUNDS_LENGTH func(typ, name string, min, max, got any) error
+		REG_VALIDATION_OUT_OF_BOUNDS_SIZE   func(typ, name string, min, max any, got string) error
+		REG_VALIDATION_FAILED               func(typ, name string, err error) error
+		REG_VALIDATION_NOT_ALLOWED          func(typ, name string, values []string, got any) error
+		REG_VAR_READ_ONLY                   func(name string) error
+		REG_INVALID                         func(typ, name, reason string) error
+		REG_VAR_ASSIGN                      func(name string, value any, err error) error
 		PSR_INPUT_EMPTY                     func() error
 		PSR_EXPECTED_ARG                    func() error
 		PSR_UNEXPECTED_TOKEN_TYPE           func(token *dslToken) error
@@ -127,22 +195,60 @@ var (
 		PSR_ASSIGN_MISSING_NAME             func() error
 		PSR_ASSIGN_MISSING_VALUE            func() error
 		PSR_ASSIGN_INVALID                  func() error
+		PSR_ASSIGN_NOT_ITERABLE             func(v any) error
+		PSR_ASSIGN_COUNT_MISMATCH           func(want, got int) error
 		PSR_ARG_REF_INVALID                 func(ref string) error
 		PSR_ARG_REF_OUT_OF_RANGE            func(id int) error
+		PSR_ARG_NAMED_UNDEFINED             func(name string) error
+		PSR_ARG_REQUIRED                    func(ref string) error
+		PSR_ARG_DECLARATION_INVALID         func(decl string) error
+		PSR_PARAMS_DECLARATION_INVALID      func(decl string) error
+		PSR_PARAMS_UNTERMINATED             func() error
+		PSR_DEFAULT_WITHOUT_ARG             func() error
+		PSR_DEFAULT_MISSING_VALUE           func() error
 		PSR_VAR_UNDEFINED                   func(name string) error
 		PSR_FUNC_UNKNOWN                    func(name string) error
 		PSR_PARAM_UNKNOWN                   func(name string) error
-		PSR_PARAM_STYLE_MISMATCH            func() error
+		PSR_PARAM_DUPLICATE                 func(name string) error
+		PSR_ARG_POSITIONAL_AFTER_NAMED      func() error
+		PSR_OPTIONS_NOT_NAMED               func() error
+		PSR_OPTIONS_WRONG_TYPE              func(name string, got any) error
 		PSR_PARAM_TOO_MANY                  func(name string) error
 		PSR_UNSUPPORTED_NODE_TYPE           func(node *dslNode) error
-		PSR_FOR_NOT_TOP_LEVEL               func() error
 		PSR_FOR_INVALID_VARS                func() error
 		PSR_FOR_TARGET_NOT_ITERABLE         func() error
+		PSR_LOOP_CONTROL_OUTSIDE            func(keyword string) error
+		PSR_LOOP_BODY_MISSING               func() error
+		PSR_WHILE_CONDITION                 func(v any) error
+		PSR_RANGE_STEP                      func(from, to, step any) error
+		PSR_RANGE_NOT_NUMERIC               func(v any) error
+		PSR_BLOCK_EXPECTED                  func(keyword string) error
+		PSR_CATCH_MISSING                   func() error
+		PSR_CATCH_WITHOUT_TRY               func() error
+		PSR_INTERPOLATION_INVALID           func(expr string) error
+		PSR_NUMBER_INVALID                  func(v string) error
+		PSR_COLOR_INVALID                   func(v string) error
+		PSR_MAP_KEY_MISSING                 func() error
+		PSR_MAP_VALUE_MISSING               func(key string) error
+		PSR_MAP_KEY_INVALID                 func(key any) error
+		PSR_MAP_KEY_UNDEFINED               func(key string) error
+		PSR_INDEX_OUT_OF_RANGE              func(index, length int) error
+		PSR_INDEX_RANGE_INVALID             func(from, to, length int) error
+		PSR_INDEX_NOT_ASSIGNABLE            func(target string) error
+		PSR_MEMBER_UNDEFINED                func(name string, v any) error
+		PSR_LAMBDA_PARAMS                   func() error
+		PSR_LAMBDA_BODY_MISSING             func() error
+		PSR_FUNC_ARGS                       func(name string, want, got int) error
+		PSR_FUNC_VALUE_NAMED                func(name string) error
+		PSR_REDUCE_EMPTY                    func() error
+		PSR_BUILTIN_ARGS                    func(usage string) error
+		PSR_CALL_DEPTH                      func(max int) error
 	}{
 		UNSUPPORTED_TARGET_TYPE:  func(typ string) error { return dslError("unsupported target type: %s", typ) },
 		STRING_CAST:              func(str, typ string) error { return dslError("cannot cast string %q to %s", str, typ) },
 		NIL_CAST:                 func() error { return dslError("cannot cast nil value") },
 		CAST_NOT_POSSIBLE:        func(source, target string) error { return dslError("cannot cast from %s to %s", source, target) },
+		CAST_OUT_OF_RANGE:        func(value any, target string) error { return dslError("%v is out of the range of %s", value, target) },
 		UNSUPPORTED_SOURCE_TYPE:  func(v any) error { return dslError("unsupported source type: %T", v) },
 		TKN_ASSIGN_VALUE_MISSING: func() error { return dslError("missing var value in assign") },
 		TKN_ASSIGN_NAME_MISSING:  func() error { return dslError("missing var name in assign") },
@@ -155,6 +261,11 @@ var (
 		TKN_UNTERMINATED_FUNC:    func(pos int) error { return dslError("unterminated function at position %d", pos) },
 		TKN_UNTERMINATED_ARG:     func(pos int) error { return dslError("unterminated argument at position %d", pos) },
 		TKN_ASSIGN_UNEXPECTED:    func(pos int) error { return dslError("unexpected variable assignment at position %d", pos) },
+		TKN_MAP_KEY_MISSING:      func(pos int) error { return dslError("missing map key at position %d", pos) },
+		TKN_INVALID_ESCAPE: func(pos int, seq string) error {
+			return dslError("invalid escape sequence \\%s at position %d", seq, pos)
+		},
+		TKN_INTERPOLATION_EMPTY: func(pos int) error { return dslError("empty interpolation ${} at position %d", pos) },
 		TKN_INVALID_ARG_REF: func(pos int, reason string) error {
 			return dslError("invalid argument reference at position %d: %s", pos, reason)
 		},
@@ -167,6 +278,22 @@ var (
 		REG_VALIDATION_OUT_OF_BOUNDS_LENGTH: func(typ, name string, min, max, got any) error {
 			return dslError("%s %s: length %v is out of bounds (%v - %v)", typ, name, got, min, max)
 		},
+		REG_VALIDATION_OUT_OF_BOUNDS_SIZE: func(typ, name string, min, max any, got string) error {
+			return dslError("%s %s: size %s is out of bounds (%v - %v)", typ, name, got, min, max)
+		},
+		REG_VALIDATION_FAILED: func(typ, name string, err error) error {
+			return dslError("%s %s: %v", typ, name, err)
+		},
+		REG_VALIDATION_NOT_ALLOWED: func(typ, name string, values []string, got any) error {
+			return dslError("%s %s: %v is not a valid choice, use one of: %s", typ, name, got, strings.Join(values, ", "))
+		},
+		REG_INVALID: func(typ, name, reason string) error {
+			return dslError("cannot register %s %q: %s", typ, name, reason)
+		},
+		REG_VAR_ASSIGN: func(name string, value any, err error) error {
+			return dslError("cannot assign %v (%T) to variable %s: %v", value, value, name, err)
+		},
+		REG_VAR_READ_ONLY:            func(name string) error { return dslError("cannot assign to constant %s", name) },
 		PSR_INPUT_EMPTY:              func() error { return dslError("input is empty") },
 		PSR_EXPECTED_ARG:             func() error { return dslError("expected argument") },
 		PSR_UNEXPECTED_TOKEN_TYPE:    func(token *dslToken) error { return dslError("unexpected token type: %s", token.Type) },
@@ -175,17 +302,72 @@ var (
 		PSR_ASSIGN_MISSING_NAME:      func() error { return dslError("missing variable name in assignment") },
 		PSR_ASSIGN_MISSING_VALUE:     func() error { return dslError("expected value after variable assignment") },
 		PSR_ASSIGN_INVALID:           func() error { return dslError("invalid variable assignment") },
+		PSR_ASSIGN_NOT_ITERABLE:      func(v any) error { return dslError("cannot destructure value of type %T", v) },
+		PSR_ASSIGN_COUNT_MISMATCH:    func(want, got int) error { return dslError("expected %d values, got %d", want, got) },
 		PSR_ARG_REF_INVALID:          func(ref string) error { return dslError("invalid argument reference: %s", ref) },
 		PSR_ARG_REF_OUT_OF_RANGE:     func(id int) error { return dslError("argument $%d out of range", id) },
-		PSR_VAR_UNDEFINED:            func(name string) error { return dslError("undefined variable: %s", name) },
-		PSR_FUNC_UNKNOWN:             func(name string) error { return dslError("unknown function: %s", name) },
-		PSR_PARAM_UNKNOWN:            func(name string) error { return dslError("unknown parameter: %s", name) },
-		PSR_PARAM_STYLE_MISMATCH:     func() error { return dslError("must use positional or named arguments, not both") },
-		PSR_PARAM_TOO_MANY:           func(name string) error { return dslError("too many arguments for function %s", name) },
-		PSR_UNSUPPORTED_NODE_TYPE:    func(node *dslNode) error { return dslError("unsupported node type: %v", node.kind) },
-		PSR_FOR_NOT_TOP_LEVEL:        func() error { return dslError("for loops are only allowed at top level") },
-		PSR_FOR_INVALID_VARS:         func() error { return dslError("invalid for loop variable declaration") },
-		PSR_FOR_TARGET_NOT_ITERABLE:  func() error { return dslError("for loop target must be a slice or matrix") },
+		PSR_ARG_NAMED_UNDEFINED:      func(name string) error { return dslError("named argument $%s is not given", name) },
+		PSR_ARG_REQUIRED:             func(ref string) error { return dslError("argument %s is required", ref) },
+		PSR_ARG_DECLARATION_INVALID: func(decl string) error {
+			return dslError("invalid argument declaration %q, like /// @arg $width int 1..4096 = 800 The output width", decl)
+		},
+		PSR_PARAMS_DECLARATION_INVALID: func(decl string) error {
+			return dslError("invalid parameter declaration %q, like params { width int 1..4096 = 800 \"Output width\" }", decl)
+		},
+		PSR_PARAMS_UNTERMINATED:   func() error { return dslError("params block without closing }") },
+		PSR_DEFAULT_WITHOUT_ARG:   func() error { return dslError("?? must follow an argument reference, like $2 ?? 10") },
+		PSR_DEFAULT_MISSING_VALUE: func() error { return dslError("expected value after ??") },
+		PSR_VAR_UNDEFINED:         func(name string) error { return dslError("undefined variable: %s", name) },
+		PSR_FUNC_UNKNOWN:          func(name string) error { return dslError("unknown function: %s", name) },
+		PSR_PARAM_UNKNOWN:         func(name string) error { return dslError("unknown parameter: %s", name) },
+		PSR_PARAM_DUPLICATE:       func(name string) error { return dslError("parameter %s is given more than once", name) },
+		PSR_ARG_POSITIONAL_AFTER_NAMED: func() error {
+			return dslError("positional arguments must come before named arguments, like blur(img radius=3)")
+		},
+		PSR_OPTIONS_NOT_NAMED:       func() error { return dslError("options must be named arguments, like (radius=3)") },
+		PSR_OPTIONS_WRONG_TYPE:      func(name string, got any) error { return dslError("parameter %s expects options, got %T", name, got) },
+		PSR_PARAM_TOO_MANY:          func(name string) error { return dslError("too many arguments for function %s", name) },
+		PSR_UNSUPPORTED_NODE_TYPE:   func(node *dslNode) error { return dslError("unsupported node type: %v", node.kind) },
+		PSR_FOR_INVALID_VARS:        func() error { return dslError("invalid for loop variable declaration") },
+		PSR_FOR_TARGET_NOT_ITERABLE: func() error { return dslError("for loop target must be a slice, matrix, map or range") },
+		PSR_LOOP_CONTROL_OUTSIDE:    func(keyword string) error { return dslError("%s outside of a loop", keyword) },
+		PSR_LOOP_BODY_MISSING:       func() error { return dslError("loop has no body, expected statements before done") },
+		PSR_WHILE_CONDITION:         func(v any) error { return dslError("while condition must be a bool, got %T", v) },
+		PSR_RANGE_STEP: func(from, to, step any) error {
+			return dslError("step %v never reaches %v from %v", step, to, from)
+		},
+		PSR_RANGE_NOT_NUMERIC: func(v any) error { return dslError("range bounds and step must be numbers, got %T", v) },
+		PSR_BLOCK_EXPECTED:    func(keyword string) error { return dslError("expected { after %s", keyword) },
+		PSR_CATCH_MISSING:     func() error { return dslError("try block without catch, like try { ... } catch err { ... }") },
+		PSR_CATCH_WITHOUT_TRY: func() error { return dslError("catch without try") },
+		PSR_INTERPOLATION_INVALID: func(expr string) error {
+			return dslError("${%s} must be a single expression, like ${w} or ${add(w 1)}", expr)
+		},
+		PSR_NUMBER_INVALID: func(v string) error {
+			return dslError("invalid number %s, expected a number like 42, 0xff, 1_000, 1e-3 or 255u8 that fits its type", v)
+		},
+		PSR_COLOR_INVALID:      func(v string) error { return dslError("invalid color %s, expected #rrggbb or #rrggbbaa", v) },
+		PSR_MAP_KEY_MISSING:    func() error { return dslError("every value of a map needs a key, like { size: 3 }") },
+		PSR_MAP_VALUE_MISSING:  func(key string) error { return dslError("missing value for map key %s", key) },
+		PSR_MAP_KEY_INVALID:    func(key any) error { return dslError("map keys must be strings or numbers, got %T", key) },
+		PSR_MAP_KEY_UNDEFINED:  func(key string) error { return dslError("undefined map key: %s", key) },
+		PSR_INDEX_OUT_OF_RANGE: func(index, length int) error { return dslError("index %d out of range for length %d", index, length) },
+		PSR_INDEX_RANGE_INVALID: func(from, to, length int) error {
+			return dslError("invalid range %d:%d for length %d", from, to, length)
+		},
+		PSR_INDEX_NOT_ASSIGNABLE: func(target string) error { return dslError("cannot assign to %s", target) },
+		PSR_MEMBER_UNDEFINED:     func(name string, v any) error { return dslError("%T has no field %s", v, name) },
+		PSR_LAMBDA_PARAMS:        func() error { return dslError("lambda parameters must be names, like (x y) => add(x y)") },
+		PSR_LAMBDA_BODY_MISSING:  func() error { return dslError("expected expression after =>") },
+		PSR_FUNC_ARGS: func(name string, want, got int) error {
+			return dslError("%s expects %d arguments, got %d", name, want, got)
+		},
+		PSR_FUNC_VALUE_NAMED: func(name string) error { return dslError("function value %s only takes positional arguments", name) },
+		PSR_REDUCE_EMPTY:     func() error { return dslError("cannot reduce an empty slice without an initial value") },
+		PSR_BUILTIN_ARGS:     func(usage string) error { return dslError("invalid arguments, usage: %s", usage) },
+		PSR_CALL_DEPTH: func(max int) error {
+			return dslError("function values can't be nested deeper than %d calls, check for endless recursion", max)
+		},
 	}
 )
 
@@ -202,6 +384,32 @@ func dslError(fmtStr string, args ...any) error {
 	return fmt.Errorf(fmtStr, args...)
 }
 
+// dslCodedError is an error of the errors registry, its code is the name of
+// the entry that created it, i.e. "PSR_VAR_UNDEFINED". Scripts read the code
+// of the errors they catch, see Error.
+type dslCodedError struct {
+	code string
+	error
+}
+
+func (e dslCodedError) Unwrap() error { return e.error }
+
+// init makes the entries of the errors registry return coded errors.
+func init() {
+	registry := reflect.ValueOf(&errors).Elem()
+	for i := 0; i < registry.NumField(); i++ {
+		code, entry := registry.Type().Field(i).Name, registry.Field(i)
+		create := reflect.ValueOf(entry.Interface())
+		entry.Set(reflect.MakeFunc(entry.Type(), func(in []reflect.Value) []reflect.Value {
+			out := create.Call(in)
+			if err, ok := out[0].Interface().(error); ok && err != nil {
+				out[0] = reflect.ValueOf(dslCodedError{code, err})
+			}
+			return out
+		}))
+	}
+}
+
 type dslMacro struct {
 	name   string
 	params []string
@@ -224,6 +432,8 @@ type dslCollection struct {
 	vars        *dslVarRegistry
 	funcs       *dslFnRegistry
 	macros      map[string]*dslMacro
+	docs        map[string]*dslScriptDoc // documented definitions of the scripts that were run
+	exec        *dslExecState
 }
 
 var dsl = dslCollection{
@@ -0,0 +1,271 @@
+package parser
+
+import (
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+var (
+	// reArgDecl matches the declaration of a script argument in the header of
+	// a script, i.e. `@arg $width int 1..4096 = 800 The output width`. The
+	// range, the default and the description are optional.
+	reArgDecl = regexp.MustCompile(`^@arg\s+\$([1-9]\d*|[a-zA-Z_]\w*)\s+(\S+)(?:\s+(-?[\w.]*?)\.\.(-?[\w.]*))?(?:\s+=\s*("(?:[^"\\]|\\.)*"|\S+))?(?:\s+(.*))?$`)
+	// reParamDecl matches the declaration of a named argument in the params
+	// block of a script, i.e. `width int 1..4096 = 800 "Output width"`.
+	reParamDecl   = regexp.MustCompile(`^([a-zA-Z_]\w*)\s+(\S+)(?:\s+(-?[\w.]*?)\.\.(-?[\w.]*))?(?:\s+=\s*("(?:[^"\\]|\\.)*"|\S+))?(?:\s+("(?:[^"\\]|\\.)*"))?$`)
+	reParamEntry  = regexp.MustCompile(`(?:"(?:[^"\\]|\\.)*"|[^;\n"])+`)                                    // Match: one declaration of a params block
+	reParamsBlock = regexp.MustCompile(`(?m)^[ \t]*params[ \t]*\{((?:"(?:[^"\\]|\\.)*"|[^"}])*)\}[ \t]*;?`) // Match: params { ... }
+	reParamsStart = regexp.MustCompile(`(?m)^[ \t]*params[ \t]*\{`)                                         // Match: params {
+)
+
+// dslArgs are the named arguments passed to a script among the positional
+// ones, i.e. `dsl.run("resize($1 $width)", "", nil, false, img, dslArgs{"width": 800})`.
+type dslArgs map[string]any
+
+// parseArgRef parses an argument reference and the value after `??` that is
+// used if the argument is missing, i.e. `$2 ?? 10`.
+func (p *dslParser) parseArgRef() (*dslNode, error) {
+	node := &dslNode{
+		kind:   nodes.argRef,
+		data:   p.curr.Value,
+		Line:   p.curr.Line,
+		Column: p.curr.Column,
+	}
+	if p.next == nil || p.next.Type != tokens.defaultOp {
+		return node, nil
+	}
+	p.advance()
+	if !p.advance() {
+		return nil, errors.PSR_DEFAULT_MISSING_VALUE()
+	}
+	fallback, err := p.parseNode()
+	if err != nil {
+		return nil, err
+	}
+	if fallback == nil {
+		return nil, errors.PSR_DEFAULT_MISSING_VALUE()
+	}
+	node.children = []*dslNode{fallback}
+	return node, nil
+}
+
+// argRef returns the value of an argument reference: $1, $2, etc. are the
+// positional arguments, $name the named ones, $# is the number of positional
+// arguments and $@ a slice of them. given is false if the argument is
+// missing, err is the error reported if there is no default for it.
+func (p *dslParser) argRef(ref string) (v any, given bool, err error) {
+	name := strings.TrimPrefix(ref, "$")
+	switch {
+	case name == "#":
+		return len(p.args), true, nil
+	case name == "@":
+		return append([]any{}, p.args...), true, nil
+	case name != "" && dsl.isNameStart(name[0]):
+		if v, ok := p.named[name]; ok {
+			return v, true, nil
+		}
+		return nil, false, errors.PSR_ARG_NAMED_UNDEFINED(name)
+	}
+	index, err := strconv.Atoi(name)
+	if err != nil {
+		return nil, true, errors.PSR_ARG_REF_INVALID(ref)
+	}
+	if index < 1 || index > len(p.args) {
+		return nil, index < 1, errors.PSR_ARG_REF_OUT_OF_RANGE(index)
+	}
+	return p.args[index-1], true, nil
+}
+
+// isSpread returns true if node is `$@`, which calls and slices expand into
+// all positional arguments, i.e. `max($@)` or `{0 $@}`.
+func (p *dslParser) isSpread(node *dslNode) bool {
+	return node.kind == nodes.argRef && node.data == "$@" && !node.named
+}
+
+// isNamedArg returns true if the parameter is a named argument of a script,
+// the names of positional arguments are their numbers.
+func (param *dslParamMeta) isNamedArg() bool {
+	_, err := strconv.Atoi(param.name)
+	return err != nil
+}
+
+// splitArgs separates the named arguments, passed as dslArgs, from the
+// positional ones. The entries of several dslArgs are merged.
+func (dsl *dslCollection) splitArgs(args []any) ([]any, map[string]any) {
+	positional := make([]any, 0, len(args))
+	named := map[string]any{}
+	for _, arg := range args {
+		if a, ok := arg.(dslArgs); ok {
+			for name, v := range a {
+				named[name] = v
+			}
+			continue
+		}
+		positional = append(positional, arg)
+	}
+	return positional, named
+}
+
+// scriptArgs returns the script without its params block and the arguments
+// declared by the block, i.e. `params { width int 1..4096 = 800 }`, and by the
+// doc comments of the script, i.e. `/// @arg $1 *image.NRGBA The image`. The
+// block is replaced with empty lines, so that errors keep their line.
+func (dsl *dslCollection) scriptArgs(script string) (string, []dslParamMeta, error) {
+	var (
+		params []dslParamMeta
+		err    error
+	)
+	script = reParamsBlock.ReplaceAllStringFunc(script, func(block string) string {
+		for _, decl := range reParamEntry.FindAllString(reParamsBlock.FindStringSubmatch(block)[1], -1) {
+			decl = strings.TrimSpace(decl)
+			if err != nil || decl == "" || strings.HasPrefix(decl, "//") {
+				continue
+			}
+			var param dslParamMeta
+			if param, err = dsl.parseParamDecl(decl); err == nil {
+				params = append(params, param)
+			}
+		}
+		return strings.Repeat("\n", strings.Count(block, "\n"))
+	})
+	if err != nil {
+		return "", nil, err
+	}
+	if reParamsStart.MatchString(script) {
+		return "", nil, errors.PSR_PARAMS_UNTERMINATED()
+	}
+	for _, line := range strings.Split(script, "\n") {
+		m := reDocComment.FindStringSubmatch(line)
+		if m == nil || !strings.HasPrefix(m[1], "@arg") {
+			continue
+		}
+		param, err := dsl.parseArgDecl(strings.TrimSpace(m[1]))
+		if err != nil {
+			return "", nil, err
+		}
+		params = append(params, param)
+	}
+	declared := map[string]bool{}
+	for _, param := range params {
+		if declared[param.name] {
+			return "", nil, errors.PSR_PARAM_DUPLICATE("$" + param.name)
+		}
+		declared[param.name] = true
+	}
+	return script, params, nil
+}
+
+// parseArgDecl parses the declaration of an argument by a doc comment.
+func (dsl *dslCollection) parseArgDecl(decl string) (dslParamMeta, error) {
+	m := reArgDecl.FindStringSubmatch(decl)
+	if m == nil {
+		return dslParamMeta{}, errors.PSR_ARG_DECLARATION_INVALID(decl)
+	}
+	return dsl.newArgParam(m, m[6], errors.PSR_ARG_DECLARATION_INVALID(decl))
+}
+
+// parseParamDecl parses the declaration of an argument by a params block,
+// its description is quoted.
+func (dsl *dslCollection) parseParamDecl(decl string) (dslParamMeta, error) {
+	m := reParamDecl.FindStringSubmatch(decl)
+	if m == nil {
+		return dslParamMeta{}, errors.PSR_PARAMS_DECLARATION_INVALID(decl)
+	}
+	desc, _ := dsl.parseArgLiteral(m[6]).(string)
+	return dsl.newArgParam(m, desc, errors.PSR_PARAMS_DECLARATION_INVALID(decl))
+}
+
+// newArgParam returns the argument of a matched declaration, the bounds and
+// the default are literals and the default is converted to the argument
+// type. invalid is returned if it can't be.
+func (dsl *dslCollection) newArgParam(m []string, desc string, invalid error) (dslParamMeta, error) {
+	param := dslParamMeta{
+		name: m[1],
+		typ:  m[2],
+		min:  dsl.parseArgLiteral(m[3]),
+		max:  dsl.parseArgLiteral(m[4]),
+		desc: desc,
+	}
+	if m[5] != "" {
+		def, err := param.cast(dsl.parseArgLiteral(m[5]))
+		if err != nil {
+			return dslParamMeta{}, invalid
+		}
+		param.def = def
+	}
+	return param, nil
+}
+
+// parseArgLiteral returns the value of a literal of an argument declaration,
+// numbers, bools and quoted strings have their type, everything else is a
+// string, i.e. the "64x64" of images. An empty literal is nil.
+func (dsl *dslCollection) parseArgLiteral(v string) any {
+	switch typ, _ := dsl.numberLiteral(v); {
+	case v == "":
+		return nil
+	case v == "true" || v == "false":
+		return v == "true"
+	case typ == tokens.integer:
+		if n, err := dsl.parseInteger(v); err == nil {
+			return n
+		}
+	case typ == tokens.float:
+		if f, err := strconv.ParseFloat(v, 64); err == nil {
+			return f
+		}
+	case dsl.isString(v[0]):
+		if s, err := strconv.Unquote(v); err == nil {
+			return s
+		}
+	}
+	return v
+}
+
+// bindArgs checks the arguments passed to a script against the arguments
+// declared by its header. Declared arguments are converted to their type and
+// must be within their bounds, missing ones take their default and are
+// required if they have none.
+func (dsl *dslCollection) bindArgs(params []dslParamMeta, args []any, named map[string]any) ([]any, error) {
+	n := len(args)
+	for _, param := range params {
+		ref := "$" + param.name
+		index, err := strconv.Atoi(param.name)
+		positional := err == nil
+		var (
+			v     any
+			given bool
+		)
+		if positional {
+			given = index <= n
+			if given {
+				v = args[index-1]
+			}
+		} else {
+			v, given = named[param.name]
+		}
+		if !given {
+			if param.def == nil {
+				return nil, errors.PSR_ARG_REQUIRED(ref)
+			}
+			v = param.def
+		}
+		v, err = param.cast(v)
+		if err != nil {
+			return nil, errors.REG_VALIDATION_FAILED("argument", ref, err)
+		}
+		if err := validateLimits("argument", ref, param.min, param.max, nil, nil, v); err != nil {
+			return nil, err
+		}
+		if !positional {
+			named[param.name] = v
+			continue
+		}
+		// missing arguments before a default are nil, i.e. $1 if only $2 is declared
+		for len(args) < index {
+			args = append(args, nil)
+		}
+		args[index-1] = v
+	}
+	return args, nil
+}
@@ -0,0 +1,275 @@
+package parser
+
+import (
+	"reflect"
+	"sort"
+)
+
+// dslBuiltin is a function of the language itself, available in every DSL.
+type dslBuiltin struct {
+	usage string                              // Shown when the arguments are invalid
+	fn    func(args []any) (any, bool, error) // Returns false if the arguments don't match usage
+}
+
+// dslBuiltins are the builtin functions, functions registered with the
+// same name take precedence.
+var dslBuiltins = map[string]dslBuiltin{
+	"len":    {usage: "len(value), value is a slice, matrix, map or string", fn: builtinLen},
+	"append": {usage: "append(slice values...)", fn: builtinAppend},
+	"map":    {usage: "map(slice fn), fn takes an element", fn: builtinMap},
+	"filter": {usage: "filter(slice fn), fn takes an element and returns a bool", fn: builtinFilter},
+	"reduce": {usage: "reduce(slice fn [initial]), fn takes the result so far and an element", fn: builtinReduce},
+	"sort":   {usage: "sort(slice [less]), less takes two elements, without it numbers and strings sort ascending", fn: builtinSort},
+	"fail":   {usage: "fail(message [code]) or fail(err) to throw a caught error again", fn: builtinFail},
+	"throw":  {usage: "throw(message [code]) or throw(err) to throw a caught error again", fn: builtinFail},
+}
+
+// evaluateBuiltin evaluates a call of a builtin function, arguments are positional.
+func (p *dslParser) evaluateBuiltin(node *dslNode, builtin dslBuiltin) (any, error) {
+	args := make([]any, 0, len(node.children))
+	for _, child := range node.children {
+		if child.named {
+			return nil, errors.PSR_BUILTIN_ARGS(builtin.usage)
+		}
+		if p.isSpread(child) {
+			args = append(args, p.args...)
+			continue
+		}
+		v, err := p.evaluateNode(child)
+		if err != nil {
+			return nil, err
+		}
+		args = append(args, v)
+	}
+	res, ok, err := builtin.fn(args)
+	if !ok {
+		return nil, errors.PSR_BUILTIN_ARGS(builtin.usage)
+	}
+	return res, err
+}
+
+// builtinLen returns the number of elements of a slice, rows of a matrix,
+// entries of a map or characters of a string.
+func builtinLen(args []any) (any, bool, error) {
+	if len(args) != 1 {
+		return nil, false, nil
+	}
+	if s, ok := args[0].(string); ok {
+		return len([]rune(s)), true, nil
+	}
+	rv := reflect.ValueOf(args[0])
+	if !rv.IsValid() || rv.Kind() != reflect.Slice && rv.Kind() != reflect.Map {
+		return nil, false, nil
+	}
+	return rv.Len(), true, nil
+}
+
+// builtinAppend returns a copy of the slice with the values appended, values
+// that are slices are appended element by element unless the slice is a matrix.
+// Values are converted to the element type, slices of mixed or unknown type,
+// i.e. `{}`, are inferred again like slice literals.
+func builtinAppend(args []any) (any, bool, error) {
+	if len(args) == 0 {
+		return nil, false, nil
+	}
+	rv := reflect.ValueOf(args[0])
+	if !rv.IsValid() || rv.Kind() != reflect.Slice {
+		return nil, false, nil
+	}
+	typ := rv.Type()
+	values := make([]any, 0, len(args)-1)
+	for _, arg := range args[1:] {
+		if av := reflect.ValueOf(arg); typ.Elem().Kind() != reflect.Slice && av.Kind() == reflect.Slice {
+			for i := 0; i < av.Len(); i++ {
+				values = append(values, av.Index(i).Interface())
+			}
+			continue
+		}
+		values = append(values, arg)
+	}
+	if _, ok := args[0].([]any); ok {
+		return dsl.inferSlice(append(append([]any{}, args[0].([]any)...), values...)), true, nil
+	}
+	res := copySlice(rv, 0, rv.Len())
+	for _, v := range values {
+		ev, err := dsl.castElem(v, typ.Elem())
+		if err != nil {
+			return nil, true, err
+		}
+		res = reflect.Append(res, ev)
+	}
+	return res.Interface(), true, nil
+}
+
+// sliceAndFunc returns the slice and the function value that the higher-order
+// builtins take as their first arguments, ok is false if they are missing.
+func sliceAndFunc(args []any) (rv reflect.Value, f *Func, ok bool) {
+	if len(args) < 2 {
+		return rv, nil, false
+	}
+	rv = reflect.ValueOf(args[0])
+	f, ok = args[1].(*Func)
+	return rv, f, ok && rv.IsValid() && rv.Kind() == reflect.Slice
+}
+
+// builtinMap returns the results of calling fn with every element of the
+// slice, their type is inferred like the elements of slice literals.
+func builtinMap(args []any) (any, bool, error) {
+	rv, f, ok := sliceAndFunc(args)
+	if !ok || len(args) != 2 {
+		return nil, false, nil
+	}
+	res := make([]any, 0, rv.Len())
+	for i := 0; i < rv.Len(); i++ {
+		v, err := f.Call(rv.Index(i).Interface())
+		if err != nil {
+			return nil, true, err
+		}
+		res = append(res, v)
+	}
+	return dsl.inferSlice(res), true, nil
+}
+
+// builtinFilter returns a copy of the slice with the elements fn returns true for.
+func builtinFilter(args []any) (any, bool, error) {
+	rv, f, ok := sliceAndFunc(args)
+	if !ok || len(args) != 2 {
+		return nil, false, nil
+	}
+	res := reflect.MakeSlice(rv.Type(), 0, rv.Len())
+	for i := 0; i < rv.Len(); i++ {
+		keep, err := callBool(f, rv.Index(i).Interface())
+		if err != nil {
+			return nil, true, err
+		}
+		if keep {
+			res = reflect.Append(res, rv.Index(i))
+		}
+	}
+	return res.Interface(), true, nil
+}
+
+// builtinReduce combines the elements of the slice from left to right by
+// calling fn with the result so far and the next element. Without an
+// initial value the first element is the initial value.
+func builtinReduce(args []any) (any, bool, error) {
+	rv, f, ok := sliceAndFunc(args)
+	if !ok || len(args) > 3 {
+		return nil, false, nil
+	}
+	start := 0
+	var acc any
+	if len(args) == 3 {
+		acc = args[2]
+	} else if rv.Len() == 0 {
+		return nil, true, errors.PSR_REDUCE_EMPTY()
+	} else {
+		acc, start = rv.Index(0).Interface(), 1
+	}
+	for i := start; i < rv.Len(); i++ {
+		v, err := f.Call(acc, rv.Index(i).Interface())
+		if err != nil {
+			return nil, true, err
+		}
+		acc = v
+	}
+	return acc, true, nil
+}
+
+// builtinSort returns a sorted copy of the slice, the order of equal elements
+// is kept. less reports whether its first argument sorts before the second.
+func builtinSort(args []any) (any, bool, error) {
+	if len(args) == 0 || len(args) > 2 {
+		return nil, false, nil
+	}
+	rv := reflect.ValueOf(args[0])
+	if !rv.IsValid() || rv.Kind() != reflect.Slice {
+		return nil, false, nil
+	}
+	res := copySlice(rv, 0, rv.Len())
+	var err error
+	less, ok := compareElems(res)
+	if len(args) == 2 {
+		f, isFunc := args[1].(*Func)
+		if !isFunc {
+			return nil, false, nil
+		}
+		less, ok = func(a, b any) bool {
+			if err != nil {
+				return false
+			}
+			var res bool
+			res, err = callBool(f, a, b)
+			return res
+		}, true
+	}
+	if !ok {
+		return nil, false, nil
+	}
+	sort.SliceStable(res.Interface(), func(i, j int) bool {
+		return less(res.Index(i).Interface(), res.Index(j).Interface())
+	})
+	if err != nil {
+		return nil, true, err
+	}
+	return res.Interface(), true, nil
+}
+
+// compareElems returns the ascending order of the elements of a slice of
+// strings or numbers, ok is false if the elements are neither.
+func compareElems(rv reflect.Value) (less func(a, b any) bool, ok bool) {
+	strs, nums := true, true
+	for i := 0; i < rv.Len(); i++ {
+		v := rv.Index(i).Interface()
+		if _, isStr := v.(string); !isStr {
+			strs = false
+		}
+		if _, err := dsl.toFloat64(v); err != nil {
+			nums = false
+		}
+	}
+	switch {
+	case strs:
+		return func(a, b any) bool { return a.(string) < b.(string) }, true
+	case nums:
+		return func(a, b any) bool {
+			fa, _ := dsl.toFloat64(a)
+			fb, _ := dsl.toFloat64(b)
+			return fa < fb
+		}, true
+	}
+	return nil, false
+}
+
+// callBool calls f and converts its result to a bool.
+func callBool(f *Func, args ...any) (bool, error) {
+	v, err := f.Call(args...)
+	if err != nil {
+		return false, err
+	}
+	return castAs[bool](v, "bool")
+}
+
+// builtinFail returns an error with the message and code, "FAIL" by default,
+// that try blocks catch. Caught errors are returned as they are.
+func builtinFail(args []any) (any, bool, error) {
+	if len(args) == 1 {
+		if err, ok := args[0].(Error); ok {
+			return nil, true, err
+		}
+	}
+	if len(args) == 0 || len(args) > 2 {
+		return nil, false, nil
+	}
+	msg, ok := args[0].(string)
+	if !ok {
+		return nil, false, nil
+	}
+	code := "FAIL"
+	if len(args) == 2 {
+		if code, ok = args[1].(string); !ok {
+			return nil, false, nil
+		}
+	}
+	return nil, true, Error{Message: msg, Code: code}
+}
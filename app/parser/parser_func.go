@@ -0,0 +1,116 @@
+package parser
+
+import (
+	"strings"
+)
+
+// dslScope holds the parameters of a lambda while its body is evaluated.
+// Parameters shadow variables and the parameters of enclosing lambdas.
+type dslScope struct {
+	parent *dslScope
+	vars   map[string]any
+}
+
+func (s *dslScope) get(name string) (any, bool) {
+	for ; s != nil; s = s.parent {
+		if v, ok := s.vars[name]; ok {
+			return v, true
+		}
+	}
+	return nil, false
+}
+
+func (s *dslScope) has(name string) bool {
+	_, ok := s.get(name)
+	return ok
+}
+
+// lambda returns the function value of a lambda, i.e. `(x) => mul(x 2)`.
+// The body is evaluated with the parameters set to the arguments of the call,
+// parameters of enclosing lambdas remain visible.
+func (p *dslParser) lambda(node *dslNode) *Func {
+	params := strings.Fields(node.data)
+	outer := p.scope
+	f := &Func{params: params}
+	f.fn = func(args ...any) (any, error) {
+		if len(args) != len(params) {
+			return nil, errors.PSR_FUNC_ARGS(f.String(), len(params), len(args))
+		}
+		if err := p.dsl.enterCall(); err != nil {
+			return nil, err
+		}
+		defer p.dsl.leaveCall()
+		scope := &dslScope{parent: outer, vars: make(map[string]any, len(params))}
+		for i, name := range params {
+			scope.vars[name] = args[i]
+		}
+		inner := *p
+		inner.scope = scope
+		return inner.evaluateNode(node.children[0])
+	}
+	return f
+}
+
+// funcRef returns a reference to the registered or builtin function name,
+// or nil if there is none. References take positional arguments only,
+// parameters that aren't given take their defaults.
+func (p *dslParser) funcRef(name string) *Func {
+	if fn := p.dsl.funcs.get(name); fn != nil {
+		if fn.meta.doc.deprecated {
+			p.dsl.warn(fn.meta.doc.warning("function", name))
+		}
+		return &Func{name: name, fn: func(args ...any) (any, error) {
+			orderedArgs := fn.meta.defaults()
+			if err := fn.meta.fill(name, orderedArgs, args); err != nil {
+				return nil, err
+			}
+			return fn.call(p.dsl.vars, orderedArgs...)
+		}}
+	}
+	if builtin, ok := dslBuiltins[name]; ok {
+		return &Func{name: name, fn: func(args ...any) (any, error) {
+			res, ok, err := builtin.fn(args)
+			if !ok {
+				return nil, errors.PSR_BUILTIN_ARGS(builtin.usage)
+			}
+			return res, err
+		}}
+	}
+	return nil
+}
+
+// funcValue returns the function value held by the lambda parameter or
+// variable name, or nil if it doesn't hold one.
+func (p *dslParser) funcValue(name string) *Func {
+	v, ok := p.scope.get(name)
+	if !ok {
+		val := p.dsl.vars.get(name)
+		if val == nil {
+			return nil
+		}
+		v = val.get()
+	}
+	f, _ := v.(*Func)
+	return f
+}
+
+// evaluateFunc evaluates a call of a function value, i.e. `double(3)`
+// after `double: (x) => mul(x 2)`, arguments are positional.
+func (p *dslParser) evaluateFunc(node *dslNode, f *Func) (any, error) {
+	args := make([]any, 0, len(node.children))
+	for _, child := range node.children {
+		if child.named {
+			return nil, errors.PSR_FUNC_VALUE_NAMED(node.data)
+		}
+		if p.isSpread(child) {
+			args = append(args, p.args...)
+			continue
+		}
+		v, err := p.evaluateNode(child)
+		if err != nil {
+			return nil, err
+		}
+		args = append(args, v)
+	}
+	return f.Call(args...)
+}
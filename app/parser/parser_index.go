@@ -0,0 +1,290 @@
+package parser
+
+import (
+	"reflect"
+	"strings"
+)
+
+// dslIndex is an evaluated part of an index: a position, i.e. the `2` of `a[2]`,
+// or a range, i.e. the `1:3` of `a[1:3]`, whose open sides are nil.
+type dslIndex struct {
+	isRange  bool
+	from, to *int
+}
+
+// resolve returns the positions [from, to) the index selects in a value of
+// the given length. Negative positions count from the end, so `a[-1]` is the
+// last element, and open sides of ranges default to the start and the end.
+func (idx dslIndex) resolve(length int) (int, int, error) {
+	if !idx.isRange {
+		i := *idx.from
+		if i < 0 {
+			i += length
+		}
+		if i < 0 || i >= length {
+			return 0, 0, errors.PSR_INDEX_OUT_OF_RANGE(*idx.from, length)
+		}
+		return i, i + 1, nil
+	}
+	from, to := 0, length
+	if idx.from != nil {
+		if from = *idx.from; from < 0 {
+			from += length
+		}
+	}
+	if idx.to != nil {
+		if to = *idx.to; to < 0 {
+			to += length
+		}
+	}
+	if from < 0 || to > length || from > to {
+		return 0, 0, errors.PSR_INDEX_RANGE_INVALID(from, to, length)
+	}
+	return from, to, nil
+}
+
+// evaluateIndexPart evaluates a part of an index node.
+func (p *dslParser) evaluateIndexPart(node *dslNode) (dslIndex, error) {
+	position := func(node *dslNode) (*int, error) {
+		if node == nil {
+			return nil, nil
+		}
+		v, err := p.evaluateNode(node)
+		if err != nil {
+			return nil, err
+		}
+		f, err := dsl.toFloat64(v)
+		if err != nil {
+			return nil, err
+		}
+		i := int(f)
+		return &i, nil
+	}
+	if node.kind != nodes.indexRange {
+		from, err := position(node)
+		return dslIndex{from: from}, err
+	}
+	from, err := position(node.children[0])
+	if err != nil {
+		return dslIndex{}, err
+	}
+	to, err := position(node.children[1])
+	return dslIndex{isRange: true, from: from, to: to}, err
+}
+
+// evaluateIndex evaluates indexing of maps, slices and matrices, i.e. `m["name"]`,
+// `a[2]`, `a[1:3]`, `m[1 2]` or `m[0:2 1]`. Ranges return copies.
+func (p *dslParser) evaluateIndex(node *dslNode) (any, error) {
+	if len(node.children) < 2 || len(node.children) > 3 {
+		return nil, errors.PSR_ASSIGN_INVALID()
+	}
+	baseVal, err := p.evaluateNode(node.children[0])
+	if err != nil {
+		return nil, err
+	}
+	if m, ok := dsl.toMap(baseVal); ok {
+		if len(node.children) != 2 {
+			return nil, errors.PSR_PARAM_TOO_MANY("index")
+		}
+		idxVal, err := p.evaluateNode(node.children[1])
+		if err != nil {
+			return nil, err
+		}
+		key, err := dsl.mapKey(idxVal)
+		if err != nil {
+			return nil, err
+		}
+		v, ok := m[key]
+		if !ok {
+			return nil, errors.PSR_MAP_KEY_UNDEFINED(key)
+		}
+		return v, nil
+	}
+
+	bv := reflect.ValueOf(baseVal)
+	if !bv.IsValid() || bv.Kind() != reflect.Slice {
+		return nil, errors.CAST_NOT_POSSIBLE("index base", "slice, matrix or map")
+	}
+	rows, err := p.evaluateIndexPart(node.children[1])
+	if err != nil {
+		return nil, err
+	}
+	rFrom, rTo, err := rows.resolve(bv.Len())
+	if err != nil {
+		return nil, err
+	}
+	if len(node.children) == 2 {
+		if rows.isRange {
+			return copySlice(bv, rFrom, rTo).Interface(), nil
+		}
+		return bv.Index(rFrom).Interface(), nil
+	}
+
+	// 2D indexing: base must be slice of slices
+	if bv.Type().Elem().Kind() != reflect.Slice {
+		return nil, errors.CAST_NOT_POSSIBLE("index base", "[][]T")
+	}
+	cols, err := p.evaluateIndexPart(node.children[2])
+	if err != nil {
+		return nil, err
+	}
+	if !rows.isRange {
+		row := bv.Index(rFrom)
+		cFrom, cTo, err := cols.resolve(row.Len())
+		if err != nil {
+			return nil, err
+		}
+		if cols.isRange {
+			return copySlice(row, cFrom, cTo).Interface(), nil
+		}
+		return row.Index(cFrom).Interface(), nil
+	}
+	// a range of rows selects a sub-matrix, or a column if cols is a position
+	res := reflect.MakeSlice(bv.Type(), 0, rTo-rFrom)
+	if !cols.isRange {
+		res = reflect.MakeSlice(reflect.SliceOf(bv.Type().Elem().Elem()), 0, rTo-rFrom)
+	}
+	for r := rFrom; r < rTo; r++ {
+		row := bv.Index(r)
+		cFrom, cTo, err := cols.resolve(row.Len())
+		if err != nil {
+			return nil, err
+		}
+		if cols.isRange {
+			res = reflect.Append(res, copySlice(row, cFrom, cTo))
+		} else {
+			res = reflect.Append(res, row.Index(cFrom))
+		}
+	}
+	return res.Interface(), nil
+}
+
+// assignIndex assigns value to an element of a slice, matrix or map,
+// i.e. `a[2]: 5`, `m[1 2]: 0.5` or `m["name"]: "box"`. The indexed value is
+// copied with the element replaced and assigned to where it was read from,
+// so constants stay read-only and validations of variables apply.
+func (p *dslParser) assignIndex(target *dslNode, value any) error {
+	if target.kind == nodes.member {
+		return errors.PSR_INDEX_NOT_ASSIGNABLE("field " + target.data)
+	}
+	base := target.children[0]
+	current, err := p.evaluateNode(base)
+	if err != nil {
+		return err
+	}
+	updated, err := p.setIndex(current, target.children[1:], value)
+	if err != nil {
+		return err
+	}
+	switch base.kind {
+	case nodes.varRef:
+		return p.dsl.vars.set(base.data, updated)
+	case nodes.index:
+		return p.assignIndex(base, updated)
+	}
+	return errors.PSR_INDEX_NOT_ASSIGNABLE(base.String())
+}
+
+// setIndex returns a copy of current with the element at the index parts set to value.
+func (p *dslParser) setIndex(current any, parts []*dslNode, value any) (any, error) {
+	if m, ok := dsl.toMap(current); ok {
+		if len(parts) != 1 {
+			return nil, errors.PSR_PARAM_TOO_MANY("index")
+		}
+		idxVal, err := p.evaluateNode(parts[0])
+		if err != nil {
+			return nil, err
+		}
+		key, err := dsl.mapKey(idxVal)
+		if err != nil {
+			return nil, err
+		}
+		res := make(Map, len(m)+1)
+		for k, v := range m {
+			res[k] = v
+		}
+		res[key] = value
+		return res, nil
+	}
+
+	bv := reflect.ValueOf(current)
+	if !bv.IsValid() || bv.Kind() != reflect.Slice {
+		return nil, errors.CAST_NOT_POSSIBLE("index base", "slice, matrix or map")
+	}
+	idx, err := p.evaluateIndexPart(parts[0])
+	if err != nil {
+		return nil, err
+	}
+	if idx.isRange {
+		return nil, errors.PSR_INDEX_NOT_ASSIGNABLE("a range")
+	}
+	i, _, err := idx.resolve(bv.Len())
+	if err != nil {
+		return nil, err
+	}
+	elem := value
+	if len(parts) > 1 {
+		if elem, err = p.setIndex(bv.Index(i).Interface(), parts[1:], value); err != nil {
+			return nil, err
+		}
+	}
+	ev, err := dsl.castElem(elem, bv.Type().Elem())
+	if err != nil {
+		return nil, err
+	}
+	res := copySlice(bv, 0, bv.Len())
+	res.Index(i).Set(ev)
+	return res.Interface(), nil
+}
+
+// memberRef returns the member accesses of a dotted name that isn't a variable,
+// i.e. `r.P1.X` for the variable r, or nil if no part of the name is a variable.
+func (p *dslParser) memberRef(name string) *dslNode {
+	for i := strings.LastIndex(name, "."); i > 0; i = strings.LastIndex(name[:i], ".") {
+		if !p.scope.has(name[:i]) && !p.dsl.vars.has(name[:i]) {
+			continue
+		}
+		node := &dslNode{kind: nodes.varRef, data: name[:i]}
+		for _, field := range strings.Split(name[i+1:], ".") {
+			node = &dslNode{kind: nodes.member, data: field, children: []*dslNode{node}}
+		}
+		return node
+	}
+	return nil
+}
+
+// member returns the field of a struct, i.e. `rect.P1` or `text.Style.Size`,
+// or the entry of a map, i.e. `box.name`. Fields are matched case-insensitively
+// if there's no exact match.
+func (dsl *dslCollection) member(v any, name string) (any, error) {
+	if m, ok := dsl.toMap(v); ok {
+		val, ok := m[name]
+		if !ok {
+			return nil, errors.PSR_MAP_KEY_UNDEFINED(name)
+		}
+		return val, nil
+	}
+	rv := reflect.ValueOf(v)
+	for rv.Kind() == reflect.Pointer || rv.Kind() == reflect.Interface {
+		if rv.IsNil() {
+			return nil, errors.PSR_MEMBER_UNDEFINED(name, v)
+		}
+		rv = rv.Elem()
+	}
+	if rv.Kind() != reflect.Struct {
+		return nil, errors.PSR_MEMBER_UNDEFINED(name, v)
+	}
+	field, ok := rv.Type().FieldByName(name)
+	if !ok {
+		field, ok = rv.Type().FieldByNameFunc(func(n string) bool { return strings.EqualFold(n, name) })
+	}
+	if !ok || !field.IsExported() {
+		return nil, errors.PSR_MEMBER_UNDEFINED(name, v)
+	}
+	return rv.FieldByIndex(field.Index).Interface(), nil
+}
+
+// copySlice returns a copy of the elements [from, to) of the slice v.
+func copySlice(v reflect.Value, from, to int) reflect.Value {
+	return reflect.AppendSlice(reflect.MakeSlice(v.Type(), 0, to-from), v.Slice(from, to))
+}
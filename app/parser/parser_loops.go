@@ -0,0 +1,194 @@
+package parser
+
+import (
+	"reflect"
+	"strings"
+)
+
+// dslLoopControl is returned as the error of break and continue statements,
+// the loop they are in stops or continues with its next iteration.
+type dslLoopControl struct {
+	kind dslNodeKind
+}
+
+func (c dslLoopControl) Error() string {
+	if c.kind == nodes.breakLoop {
+		return errors.PSR_LOOP_CONTROL_OUTSIDE("break").Error()
+	}
+	return errors.PSR_LOOP_CONTROL_OUTSIDE("continue").Error()
+}
+
+// evaluateFor evaluates a for loop. The loop variables take the last values
+// of an iteration, so a single name takes the element without its index:
+//   - numeric ranges: index and number
+//   - maps: key and value, keys are sorted
+//   - slices: index and element
+//   - matrices: index and row, or row, column and element
+func (p *dslParser) evaluateFor(node *dslNode) error {
+	names := strings.Fields(node.data)
+	if len(node.children) < 2 || len(names) == 0 {
+		return errors.PSR_FOR_INVALID_VARS()
+	}
+	body := node.children[1:]
+
+	if node.children[0].kind == nodes.numRange {
+		from, to, step, ints, err := p.evaluateRange(node.children[0])
+		if err != nil {
+			return err
+		}
+		return p.loop(names, 2, body, func(i int) ([]any, bool) {
+			v := from + float64(i)*step
+			if (step > 0 && v > to) || (step < 0 && v < to) {
+				return nil, false
+			}
+			if ints {
+				return []any{float64(i), int64(v)}, true
+			}
+			return []any{float64(i), v}, true
+		})
+	}
+
+	targetVal, err := p.evaluateNode(node.children[0])
+	if err != nil {
+		return err
+	}
+
+	if m, ok := dsl.toMap(targetVal); ok {
+		keys := m.keys()
+		return p.loop(names, 2, body, func(i int) ([]any, bool) {
+			if i >= len(keys) {
+				return nil, false
+			}
+			return []any{keys[i], m[keys[i]]}, true
+		})
+	}
+
+	target := reflect.ValueOf(targetVal)
+	if !target.IsValid() || target.Kind() != reflect.Slice {
+		return errors.PSR_FOR_TARGET_NOT_ITERABLE()
+	}
+
+	if target.Type().Elem().Kind() == reflect.Slice && len(names) == 3 {
+		row, col := 0, 0
+		return p.loop(names, 3, body, func(int) ([]any, bool) {
+			for row < target.Len() && col >= target.Index(row).Len() {
+				row, col = row+1, 0
+			}
+			if row >= target.Len() {
+				return nil, false
+			}
+			item := target.Index(row).Index(col).Interface()
+			col++
+			return []any{float64(row), float64(col - 1), item}, true
+		})
+	}
+
+	return p.loop(names, 2, body, func(i int) ([]any, bool) {
+		if i >= target.Len() {
+			return nil, false
+		}
+		return []any{float64(i), target.Index(i).Interface()}, true
+	})
+}
+
+// evaluateWhile evaluates a while loop, its condition must be a bool.
+func (p *dslParser) evaluateWhile(node *dslNode) error {
+	if len(node.children) < 2 {
+		return errors.PSR_LOOP_BODY_MISSING()
+	}
+	for {
+		v, err := p.evaluateNode(node.children[0])
+		if err != nil {
+			return err
+		}
+		cond, ok := v.(bool)
+		if !ok {
+			return errors.PSR_WHILE_CONDITION(v)
+		}
+		if !cond {
+			return nil
+		}
+		if brk, err := p.evaluateBody(node.children[1:]); err != nil || brk {
+			return err
+		}
+	}
+}
+
+// loop evaluates the body of a for loop once per iteration. next returns the
+// values of the i-th iteration, or false after the last one. An iteration
+// has width values, the loop variables take the last of them.
+func (p *dslParser) loop(names []string, width int, body []*dslNode, next func(i int) ([]any, bool)) error {
+	if len(names) > width {
+		return errors.PSR_FOR_INVALID_VARS()
+	}
+	for i := 0; ; i++ {
+		values, ok := next(i)
+		if !ok {
+			return nil
+		}
+		if err := p.setLoopVars(names, values[len(values)-len(names):]...); err != nil {
+			return err
+		}
+		if brk, err := p.evaluateBody(body); err != nil || brk {
+			return err
+		}
+	}
+}
+
+// evaluateBody evaluates the statements of a loop body once, brk is true if
+// a break statement stops the loop. A continue statement skips the rest of
+// the body. Loops stop when the context of the script is canceled.
+func (p *dslParser) evaluateBody(body []*dslNode) (brk bool, err error) {
+	if err := p.dsl.context().Err(); err != nil {
+		return false, err
+	}
+	for _, stmt := range body {
+		if _, err := p.evaluateNode(stmt); err != nil {
+			if ctrl, ok := err.(dslLoopControl); ok {
+				return ctrl.kind == nodes.breakLoop, nil
+			}
+			return false, err
+		}
+	}
+	return false, nil
+}
+
+// evaluateRange returns the bounds and the step of a numeric range, both
+// bounds are included. ints is true if all of them are whole numbers. The
+// step defaults to 1, or -1 if the range counts down.
+func (p *dslParser) evaluateRange(node *dslNode) (from, to, step float64, ints bool, err error) {
+	values := make([]float64, 0, len(node.children))
+	ints = true
+	for _, child := range node.children {
+		v, err := p.evaluateNode(child)
+		if err != nil {
+			return 0, 0, 0, false, err
+		}
+		f, err := dsl.toFloat64(v)
+		if err != nil {
+			return 0, 0, 0, false, errors.PSR_RANGE_NOT_NUMERIC(v)
+		}
+		ints = ints && f == float64(int64(f))
+		values = append(values, f)
+	}
+	from, to, step = values[0], values[1], 1
+	if len(values) > 2 {
+		step = values[2]
+	} else if from > to {
+		step = -1
+	}
+	if step == 0 || (to-from)*step < 0 {
+		return 0, 0, 0, false, errors.PSR_RANGE_STEP(from, to, step)
+	}
+	return from, to, step, ints, nil
+}
+
+// setLoopVars assigns the index and item values of an iteration to the loop variables.
+func (p *dslParser) setLoopVars(names []string, values ...any) error {
+	for i, name := range names {
+		if err := p.dsl.vars.set(name, values[i]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -1,4 +1,4 @@
-package main
+package parser
 
 import (
 	"image"
@@ -24,6 +24,9 @@ type dslParser struct {
 	formatted string         // Formatted source code
 	types     string         // Token types for debugging
 	args      []any          // Script arguments
+	named     map[string]any // Named script arguments, see dslArgs
+	scope     *dslScope      // Parameters of the lambdas being evaluated
+	loops     int            // Depth of the loops being parsed
 }
 
 // advance advances the parser to the next token.
@@ -56,23 +59,36 @@ func (p *dslParser) parseArgument() (*dslNode, error) {
 	case tokens.comment:
 		return nil, nil
 	case tokens.varRef:
-		return &dslNode{
+		return p.parsePostfix(&dslNode{
 			kind: nodes.varRef,
 			data: p.curr.Value,
-		}, nil
+		})
 	case tokens.argRef:
+		return p.parseArgRef()
+	case tokens.integer:
+		val, err := p.dsl.parseInteger(p.curr.Value)
+		if err != nil {
+			return nil, errors.PSR_NUMBER_INVALID(p.curr.Value)
+		}
 		return &dslNode{
-			kind: nodes.argRef,
+			kind: nodes.integer,
+			data: strconv.FormatInt(val, 10),
+		}, nil
+	case tokens.uinteger:
+		if _, err := p.dsl.parseUnsigned(p.curr.Value); err != nil {
+			return nil, err
+		}
+		return &dslNode{
+			kind: nodes.uinteger,
 			data: p.curr.Value,
 		}, nil
-	case tokens.integer:
-		val, err := strconv.Atoi(p.curr.Value)
-		if err != nil {
+	case tokens.color:
+		if _, err := p.dsl.parseColor(p.curr.Value); err != nil {
 			return nil, err
 		}
 		return &dslNode{
-			kind: nodes.integer,
-			data: strconv.Itoa(val),
+			kind: nodes.color,
+			data: p.curr.Value,
 		}, nil
 	case tokens.float:
 		val, err := strconv.ParseFloat(p.curr.Value, 64)
@@ -84,10 +100,7 @@ func (p *dslParser) parseArgument() (*dslNode, error) {
 			data: strconv.FormatFloat(val, 'f', -1, 64),
 		}, nil
 	case tokens.str:
-		return &dslNode{
-			kind: nodes.str,
-			data: p.curr.Value,
-		}, nil
+		return p.parseString(p.curr)
 	case tokens.boolean:
 		val, err := strconv.ParseBool(p.curr.Value)
 		if err != nil {
@@ -103,9 +116,20 @@ func (p *dslParser) parseArgument() (*dslNode, error) {
 			data: "nil",
 		}, nil
 	case tokens.callStart:
-		return p.parseCall()
+		node, err := p.parseCall()
+		if err != nil {
+			return nil, err
+		}
+		if p.next != nil && p.next.Type == tokens.arrow {
+			return p.parseLambda(node)
+		}
+		return p.parsePostfix(node)
 	case tokens.sliceStart:
-		return p.parseSlice()
+		node, err := p.parseSlice()
+		if err != nil {
+			return nil, err
+		}
+		return p.parsePostfix(node)
 	default:
 		return nil, errors.PSR_UNEXPECTED_TOKEN_TYPE(p.curr)
 	}
@@ -152,12 +176,16 @@ func (p *dslParser) parseCall() (*dslNode, error) {
 // parseSlice parses a slice literal with its elements.
 // It handles numeric literals, variable references, and function calls
 // as slice elements. Elements are space-separated within curly braces.
+// Literals with keys are maps, i.e. `{ name: "box" size: 3 }`, and `{:}` is the empty map.
 // Returns an error if the slice syntax is invalid or if element parsing fails.
 func (p *dslParser) parseSlice() (*dslNode, error) {
 	// Two modes: flat 1D slice or angle-bracket rows -> matrix
 	elements := make([]*dslNode, 0)
 	rows := make([]*dslNode, 0)
 	sawRow := false
+	// or a map when the elements have keys
+	entries := make([]*dslNode, 0)
+	var key *string
 
 	for p.advance() {
 		if p.curr.Type == tokens.sliceEnd {
@@ -169,6 +197,20 @@ func (p *dslParser) parseSlice() (*dslNode, error) {
 		if p.curr.Type == tokens.comment {
 			continue
 		}
+		if p.curr.Type == tokens.mapKey {
+			if key != nil {
+				return nil, errors.PSR_MAP_VALUE_MISSING(*key)
+			}
+			if len(elements) > 0 || len(rows) > 0 {
+				return nil, errors.PSR_MAP_KEY_MISSING()
+			}
+			k := strings.TrimSuffix(p.curr.Value, ":")
+			key = &k
+			continue
+		}
+		if key == nil && len(entries) > 0 {
+			return nil, errors.PSR_MAP_KEY_MISSING()
+		}
 		if p.curr.Type == tokens.rowStart {
 			sawRow = true
 			row := &dslNode{kind: nodes.row}
@@ -191,6 +233,11 @@ func (p *dslParser) parseSlice() (*dslNode, error) {
 					row.children = append(row.children, arg)
 				}
 			}
+			if key != nil {
+				entries = append(entries, &dslNode{kind: nodes.arg, named: true, argName: *key, children: []*dslNode{row}})
+				key = nil
+				continue
+			}
 			rows = append(rows, row)
 			continue
 		}
@@ -200,11 +247,22 @@ func (p *dslParser) parseSlice() (*dslNode, error) {
 		if err != nil {
 			return nil, err
 		}
+		if arg != nil && key != nil {
+			entries = append(entries, &dslNode{kind: nodes.arg, named: true, argName: *key, children: []*dslNode{arg}})
+			key = nil
+			continue
+		}
 		if arg != nil {
 			elements = append(elements, arg)
 		}
 	}
 
+	if key != nil && (*key != "" || len(entries) > 0) {
+		return nil, errors.PSR_MAP_VALUE_MISSING(*key)
+	}
+	if key != nil || len(entries) > 0 {
+		return &dslNode{kind: nodes.dict, children: entries}, nil
+	}
 	if sawRow && len(elements) > 0 {
 		// Mixed content: create slice, treat rows as elements
 		elements = append(elements, rows...)
@@ -216,47 +274,60 @@ func (p *dslParser) parseSlice() (*dslNode, error) {
 	return &dslNode{kind: nodes.slice, children: elements}, nil
 }
 
-// parseForRange parses a for loop construct: for target[vars]{ body }
+// parseForRange parses a for loop, either over the elements of a variable,
+// i.e. `for data[i item] ... done`, or over any value or numeric range,
+// i.e. `for item in { 1 2 3 } ... done` or `for i in 0..10 step 2 ... done`.
 func (p *dslParser) parseForRange() (*dslNode, error) {
 	node := &dslNode{
-		kind: nodes.forRange,
-	}
-
-	if !p.advance() {
-		return nil, errors.PSR_FOR_INVALID_VARS()
-	}
-
-	targetName := p.curr.Value
-	target := &dslNode{
-		kind: nodes.varRef,
-		data: targetName,
+		kind:   nodes.forRange,
+		Line:   p.curr.Line,
+		Column: p.curr.Column,
 	}
-	node.children = append(node.children, target)
 
 	if !p.advance() {
 		return nil, errors.PSR_FOR_INVALID_VARS()
 	}
 
-	if p.curr.Type != tokens.indexStart {
-		return nil, errors.PSR_FOR_INVALID_VARS()
-	}
-
 	varNames := []string{}
-	for p.advance() {
-		if p.curr.Type == tokens.indexEnd || p.curr.Type == tokens.terminator {
-			break
-		}
-		if p.curr.Type == tokens.space || p.curr.Value == "" {
-			continue
+	if p.next != nil && p.next.Type == tokens.indexStart {
+		target := &dslNode{
+			kind: nodes.varRef,
+			data: p.curr.Value,
 		}
-		if p.curr.Type == tokens.comment {
-			continue
+		node.children = append(node.children, target)
+		p.advance()
+
+		for p.advance() {
+			if p.curr.Type == tokens.indexEnd || p.curr.Type == tokens.terminator {
+				break
+			}
+			if p.curr.Type == tokens.space || p.curr.Value == "" {
+				continue
+			}
+			if p.curr.Type == tokens.comment {
+				continue
+			}
+			if p.curr.Type == tokens.varRef {
+				varNames = append(varNames, p.curr.Value)
+			} else {
+				return nil, errors.PSR_FOR_INVALID_VARS()
+			}
 		}
-		if p.curr.Type == tokens.varRef {
+	} else {
+		for p.curr.Type == tokens.varRef && p.curr.Value != "in" {
 			varNames = append(varNames, p.curr.Value)
-		} else {
+			if !p.advance() {
+				return nil, errors.PSR_FOR_INVALID_VARS()
+			}
+		}
+		if p.curr.Value != "in" || !p.advanceOperand() {
 			return nil, errors.PSR_FOR_INVALID_VARS()
 		}
+		target, err := p.parseIterable()
+		if err != nil {
+			return nil, err
+		}
+		node.children = append(node.children, target)
 	}
 
 	if len(varNames) == 0 {
@@ -265,31 +336,92 @@ func (p *dslParser) parseForRange() (*dslNode, error) {
 
 	node.data = strings.Join(varNames, " ")
 
-	bodyStatements := []*dslNode{}
+	body, err := p.parseLoopBody()
+	if err != nil {
+		return nil, err
+	}
+	node.children = append(node.children, body...)
+
+	return node, nil
+}
 
-	if !p.advance() {
+// parseIterable parses what a for loop iterates over: a value, i.e. `data`,
+// `{ 1 2 3 }` or `list()`, or a numeric range with an optional step, i.e.
+// `0..10` or `10..0 step -2`.
+func (p *dslParser) parseIterable() (*dslNode, error) {
+	from, err := p.parseNode()
+	if err != nil {
+		return nil, err
+	}
+	if from == nil {
 		return nil, errors.PSR_FOR_INVALID_VARS()
 	}
-
+	if p.next == nil || p.next.Type != tokens.rangeOp {
+		return from, nil
+	}
+	p.advance()
+	node := &dslNode{
+		kind:     nodes.numRange,
+		children: []*dslNode{from},
+		Line:     from.Line,
+		Column:   from.Column,
+	}
 	for {
-		if p.curr == nil {
-			break
+		if !p.advanceOperand() {
+			return nil, errors.PSR_EXPECTED_ARG()
+		}
+		operand, err := p.parseNode()
+		if err != nil {
+			return nil, err
+		}
+		if operand == nil {
+			return nil, errors.PSR_EXPECTED_ARG()
+		}
+		node.children = append(node.children, operand)
+		if len(node.children) == 3 || p.next == nil || p.next.Type != tokens.varRef || p.next.Value != "step" {
+			return node, nil
 		}
+		p.advance()
+	}
+}
+
+// parseWhile parses a while loop, i.e. `while lt(i 10) ... done`.
+func (p *dslParser) parseWhile() (*dslNode, error) {
+	node := &dslNode{
+		kind:   nodes.whileLoop,
+		Line:   p.curr.Line,
+		Column: p.curr.Column,
+	}
+	if !p.advanceOperand() {
+		return nil, errors.PSR_EXPECTED_ARG()
+	}
+	cond, err := p.parseNode()
+	if err != nil {
+		return nil, err
+	}
+	if cond == nil {
+		return nil, errors.PSR_EXPECTED_ARG()
+	}
+	body, err := p.parseLoopBody()
+	if err != nil {
+		return nil, err
+	}
+	node.children = append([]*dslNode{cond}, body...)
+	return node, nil
+}
 
+// parseLoopBody parses the statements of a loop up to its `done`,
+// loops can be nested and contain break and continue statements.
+func (p *dslParser) parseLoopBody() ([]*dslNode, error) {
+	p.loops++
+	defer func() { p.loops-- }()
+
+	body := []*dslNode{}
+	for p.advance() {
 		if p.curr.Type == tokens.done {
 			break
 		}
-
-		if p.curr.Type == tokens.space || p.curr.Value == "" {
-			if !p.advance() {
-				break
-			}
-			continue
-		}
-		if p.curr.Type == tokens.comment {
-			if !p.advance() {
-				break
-			}
+		if p.curr.Type == tokens.space || p.curr.Value == "" || p.curr.Type == tokens.comment {
 			continue
 		}
 
@@ -298,22 +430,25 @@ func (p *dslParser) parseForRange() (*dslNode, error) {
 			return nil, err
 		}
 		if stmt != nil {
-			bodyStatements = append(bodyStatements, stmt)
-		}
-
-		// Advance to next token
-		if !p.advance() {
-			break
+			body = append(body, stmt)
 		}
 	}
 
-	if len(bodyStatements) == 0 {
-		return nil, errors.PSR_FOR_INVALID_VARS()
+	if len(body) == 0 {
+		return nil, errors.PSR_LOOP_BODY_MISSING()
 	}
+	return body, nil
+}
 
-	node.children = append(node.children, bodyStatements...)
-
-	return node, nil
+// advanceOperand advances to the operand of a keyword or an operator, skipping
+// the terminators the tokenizer adds before calls, i.e. the one of `while lt(i 3)`.
+func (p *dslParser) advanceOperand() bool {
+	for p.advance() {
+		if p.curr.Type != tokens.terminator {
+			return true
+		}
+	}
+	return false
 }
 
 // parseIndex parses one or more chained index operations on a base node.
@@ -339,7 +474,7 @@ func (p *dslParser) parseIndex(base *dslNode) (*dslNode, error) {
 	if len(res) == 0 {
 		return nil, errors.PSR_EXPECTED_ARG()
 	}
-	// Parse one or two expressions from tokens
+	// Parse one or two expressions from tokens, each can be a range like `1:3`
 	sub := &dslParser{curr: nil, next: nil, prev: nil, tokens: res, formatted: "", types: "", pos: -1, args: []any{}}
 	idxParts := make([]*dslNode, 0, 2)
 	for sub.advance() {
@@ -350,15 +485,41 @@ func (p *dslParser) parseIndex(base *dslNode) (*dslNode, error) {
 		if sub.curr.Type == tokens.indexEnd {
 			break
 		}
-		n, err := sub.parseArgument()
-		if err != nil {
-			return nil, err
-		}
-		if n != nil {
-			idxParts = append(idxParts, n)
-			if len(idxParts) > 2 {
-				return nil, errors.PSR_PARAM_TOO_MANY("index")
+		if sub.curr.Type == tokens.rangeSep {
+			// a range from the expression before the separator to the one after it,
+			// a side marked with "_" is left open, see dslTokenizer.rangeSeparator
+			rng := &dslNode{kind: nodes.indexRange, children: []*dslNode{nil, nil}}
+			if last := len(idxParts) - 1; last >= 0 && !strings.HasPrefix(sub.curr.Value, "_") {
+				rng.children[0] = idxParts[last]
+				idxParts = idxParts[:last]
 			}
+			idxParts = append(idxParts, rng)
+			if !strings.HasSuffix(sub.curr.Value, "_") {
+				more := sub.advance()
+				for more && sub.curr.Type == tokens.terminator {
+					more = sub.advance()
+				}
+				if !more || sub.curr.Type == tokens.rangeSep {
+					return nil, errors.PSR_EXPECTED_ARG()
+				}
+				n, err := sub.parseArgument()
+				if err != nil {
+					return nil, err
+				}
+				rng.children[1] = n
+			}
+		} else {
+			n, err := sub.parseArgument()
+			if err != nil {
+				return nil, err
+			}
+			if n == nil {
+				continue
+			}
+			idxParts = append(idxParts, n)
+		}
+		if len(idxParts) > 2 {
+			return nil, errors.PSR_PARAM_TOO_MANY("index")
 		}
 	}
 	if len(idxParts) == 0 {
@@ -369,6 +530,94 @@ func (p *dslParser) parseIndex(base *dslNode) (*dslNode, error) {
 	return &dslNode{kind: nodes.index, children: children}, nil
 }
 
+// parsePostfix parses the indexes and member accesses that follow base,
+// i.e. `m[1][0]`, `size(img)[1]` or `a[0].P1.X`.
+func (p *dslParser) parsePostfix(base *dslNode) (*dslNode, error) {
+	for p.next != nil && (p.next.Type == tokens.indexStart || p.next.Type == tokens.member) {
+		p.advance()
+		if p.curr.Type == tokens.member {
+			base = &dslNode{
+				kind:     nodes.member,
+				data:     p.curr.Value,
+				children: []*dslNode{base},
+				Line:     base.Line,
+				Column:   base.Column,
+			}
+			continue
+		}
+		idxNode, err := p.parseIndex(base)
+		if err != nil {
+			return nil, err
+		}
+		base = idxNode
+		// after parseIndex, p.curr == indexEnd; loop will check if another [ follows
+	}
+	return base, nil
+}
+
+// parseOperand parses the postfix operations that follow base and an
+// assignment to the element they select, i.e. `a[2]: 5`.
+func (p *dslParser) parseOperand(base *dslNode) (*dslNode, error) {
+	base, err := p.parsePostfix(base)
+	if err != nil {
+		return nil, err
+	}
+	if (base.kind != nodes.index && base.kind != nodes.member) || p.next == nil || p.next.Type != tokens.assign || p.next.Value != ":" {
+		return base, nil
+	}
+	p.advance()
+	if !p.advance() {
+		return nil, errors.PSR_ASSIGN_MISSING_VALUE()
+	}
+	value, err := p.parseNode()
+	if err != nil {
+		return nil, err
+	}
+	return &dslNode{
+		kind:     nodes.indexAssign,
+		children: []*dslNode{base, value},
+		Line:     base.Line,
+		Column:   base.Column,
+	}, nil
+}
+
+// parseLambda parses the body of a lambda whose parameters are the
+// group that was parsed last, i.e. `(x y) => add(x y)`.
+func (p *dslParser) parseLambda(group *dslNode) (*dslNode, error) {
+	params := make([]string, 0, len(group.children))
+	for _, child := range group.children {
+		if child.kind != nodes.varRef || strings.Contains(child.data, ".") {
+			return nil, errors.PSR_LAMBDA_PARAMS()
+		}
+		params = append(params, child.data)
+	}
+	if group.data != "" {
+		return nil, errors.PSR_LAMBDA_PARAMS()
+	}
+	p.advance() // the arrow
+	if !p.advance() {
+		return nil, errors.PSR_LAMBDA_BODY_MISSING()
+	}
+	// the body is evaluated when the lambda is called, not by the loop it's in
+	loops := p.loops
+	p.loops = 0
+	body, err := p.parseNode()
+	p.loops = loops
+	if err != nil {
+		return nil, err
+	}
+	if body == nil {
+		return nil, errors.PSR_LAMBDA_BODY_MISSING()
+	}
+	return &dslNode{
+		kind:     nodes.lambda,
+		data:     strings.Join(params, " "),
+		children: []*dslNode{body},
+		Line:     group.Line,
+		Column:   group.Column,
+	}, nil
+}
+
 // parseNode parses a single node from the token stream.
 // It handles different types of nodes based on the current token.
 // Returns an error if the token sequence is invalid.
@@ -377,21 +626,48 @@ func (p *dslParser) parseNode() (*dslNode, error) {
 	case tokens.comment:
 		return nil, nil
 	case tokens.str:
-		return &dslNode{
-			kind: nodes.str,
-			data: p.curr.Value,
-		}, nil
+		return p.parseString(p.curr)
 	case tokens.argRef:
-		return &dslNode{
-			kind: nodes.argRef,
-			data: p.curr.Value,
-		}, nil
+		return p.parseArgRef()
+	case tokens.defaultOp:
+		return nil, errors.PSR_DEFAULT_WITHOUT_ARG()
 	case tokens.forLoop:
 		return p.parseForRange()
+	case tokens.whileLoop:
+		return p.parseWhile()
+	case tokens.tryBlock:
+		return p.parseTry()
+	case tokens.catchBlock:
+		return nil, errors.PSR_CATCH_WITHOUT_TRY()
+	case tokens.breakLoop, tokens.contLoop:
+		if p.loops == 0 {
+			return nil, errors.PSR_LOOP_CONTROL_OUTSIDE(p.curr.Value)
+		}
+		kind := nodes.breakLoop
+		if p.curr.Type == tokens.contLoop {
+			kind = nodes.contLoop
+		}
+		return &dslNode{
+			kind:   kind,
+			data:   p.curr.Value,
+			Line:   p.curr.Line,
+			Column: p.curr.Column,
+		}, nil
 	case tokens.callStart:
-		return p.parseCall()
+		node, err := p.parseCall()
+		if err != nil {
+			return nil, err
+		}
+		if p.next != nil && p.next.Type == tokens.arrow {
+			return p.parseLambda(node)
+		}
+		return p.parseOperand(node)
 	case tokens.sliceStart:
-		return p.parseSlice()
+		node, err := p.parseSlice()
+		if err != nil {
+			return nil, err
+		}
+		return p.parseOperand(node)
 	case tokens.sliceEnd:
 		return nil, nil
 	case tokens.indexEnd:
@@ -448,24 +724,31 @@ func (p *dslParser) parseNode() (*dslNode, error) {
 		}, nil
 	default:
 		if p.curr.Type == tokens.integer {
-			if i, err := strconv.ParseInt(p.curr.Value, 10, 64); err == nil {
-				return &dslNode{
-					kind:   nodes.integer,
-					data:   strconv.FormatInt(i, 10),
-					Line:   p.curr.Line,
-					Column: p.curr.Column,
-				}, nil
+			i, err := p.dsl.parseInteger(p.curr.Value)
+			if err != nil {
+				return nil, errors.PSR_NUMBER_INVALID(p.curr.Value)
 			}
+			return &dslNode{
+				kind:   nodes.integer,
+				data:   strconv.FormatInt(i, 10),
+				Line:   p.curr.Line,
+				Column: p.curr.Column,
+			}, nil
 		}
 		if p.curr.Type == tokens.float {
-			if f, err := strconv.ParseFloat(p.curr.Value, 64); err == nil {
-				return &dslNode{
-					kind:   nodes.float,
-					data:   strconv.FormatFloat(f, 'f', -1, 64),
-					Line:   p.curr.Line,
-					Column: p.curr.Column,
-				}, nil
+			f, err := strconv.ParseFloat(p.curr.Value, 64)
+			if err != nil {
+				return nil, errors.PSR_NUMBER_INVALID(p.curr.Value)
 			}
+			return &dslNode{
+				kind:   nodes.float,
+				data:   strconv.FormatFloat(f, 'f', -1, 64),
+				Line:   p.curr.Line,
+				Column: p.curr.Column,
+			}, nil
+		}
+		if p.curr.Type == tokens.uinteger || p.curr.Type == tokens.color {
+			return p.parseArgument()
 		}
 		if p.curr.Type == tokens.boolean {
 			if b, err := strconv.ParseBool(p.curr.Value); err == nil {
@@ -478,38 +761,38 @@ func (p *dslParser) parseNode() (*dslNode, error) {
 			}
 		}
 		if p.curr.Type == tokens.varRef {
-			base := &dslNode{
+			return p.parseOperand(&dslNode{
 				kind:   nodes.varRef,
 				data:   p.curr.Value,
 				Line:   p.curr.Line,
 				Column: p.curr.Column,
+			})
+		}
+		// an expression as the value of a named argument, i.e. `y=add(1 2)`,
+		// `less=(a b) => lt(a b)`, `opts=(radius=3 edge="clamp")`, `values={1 2}`
+		// or `y=v[0]`, simple values are parsed as arguments below
+		if p.curr.Type == tokens.namedArg && p.isNamedExpr() {
+			node := &dslNode{
+				kind:    nodes.arg,
+				named:   true,
+				argName: strings.TrimSuffix(p.curr.Value, "="),
+				Line:    p.curr.Line,
+				Column:  p.curr.Column,
 			}
-			// if next is an indexStart, parse indexing (can be chained)
-			for p.next != nil && p.next.Type == tokens.indexStart {
-				// move to indexStart and parse
-				if !p.advance() {
-					break
-				}
-				if p.curr.Type != tokens.indexStart {
-					break
-				}
-				idxNode, err := p.parseIndex(base)
-				if err != nil {
-					return nil, err
-				}
-				base = idxNode
-				// after parseIndex, p.curr == indexEnd; loop will check if another [ follows
+			p.advance()
+			value, err := p.parseNode()
+			if err != nil {
+				return nil, err
 			}
-			return base, nil
+			node.children = []*dslNode{value}
+			return node, nil
 		}
 		if p.next != nil && p.next.Type == tokens.callStart {
 			return p.parseCall()
 		}
-		// Support indexing after a completed call expression: (handled when parseCall returns and the caller sees indexStart)
-		// Allow indexing the result of a call or other expressions by handling indexStart after parseCall above
-		if p.curr.Type == tokens.indexStart {
-			// This path occurs when an expression directly followed by [ is being parsed inside a larger context
-			// Fall back: error because we don't have a base
+		// indexes, member accesses and arrows are parsed with the value they
+		// follow, one without a value, i.e. `[1]`, has nothing to index
+		if p.curr.Type == tokens.indexStart || p.curr.Type == tokens.member || p.curr.Type == tokens.arrow {
 			return nil, errors.PSR_EXPECTED_ARG()
 		}
 		if !p.advance() {
@@ -540,6 +823,63 @@ func (p *dslParser) parseNode() (*dslNode, error) {
 	}
 }
 
+// isNamedExpr returns true if the value of the named argument at the current
+// token is more than a single token: a call, a group, a slice or a map, or a
+// value that is indexed or whose member is accessed.
+func (p *dslParser) isNamedExpr() bool {
+	if p.next == nil {
+		return false
+	}
+	if p.next.Type == tokens.callStart || p.next.Type == tokens.sliceStart {
+		return true
+	}
+	if p.pos+2 < len(p.tokens) {
+		after := p.tokens[p.pos+2].Type
+		return after == tokens.indexStart || after == tokens.member
+	}
+	return false
+}
+
+// evaluateOptions evaluates a group of named arguments, i.e.
+// `(radius=3 edge="clamp")`, which is passed to struct parameters.
+func (p *dslParser) evaluateOptions(node *dslNode) (Options, error) {
+	opts := Options{}
+	for _, child := range node.children {
+		if !child.named {
+			return nil, errors.PSR_OPTIONS_NOT_NAMED()
+		}
+		var val any = child.data
+		if len(child.children) > 0 {
+			v, err := p.evaluateNode(child.children[0])
+			if err != nil {
+				return nil, err
+			}
+			val = v
+		}
+		opts[child.argName] = val
+	}
+	return opts, nil
+}
+
+// evaluateArg evaluates a positional argument of the given parameter.
+// Bare identifiers that aren't variables but one of the parameter's allowed
+// values evaluate to that value, i.e. `blend(img1 img2 multiply)`, other
+// unresolved ones are reported with the list of allowed values.
+func (p *dslParser) evaluateArg(param *dslParamMeta, node *dslNode) (any, error) {
+	if param == nil || len(param.values) == 0 || node.kind != nodes.varRef || p.scope.has(node.data) || p.dsl.vars.has(node.data) {
+		return p.evaluateNode(node)
+	}
+	if param.allows(node.data) {
+		return node.data, nil
+	}
+	v, err := p.evaluateNode(node)
+	if err != nil {
+		// an unresolved bare identifier is a value that isn't one of the choices
+		return nil, errors.REG_VALIDATION_NOT_ALLOWED("parameter", param.name, param.values, node.data)
+	}
+	return v, nil
+}
+
 // evaluateNode evaluates a node in the AST, handling different node types:
 // - Function calls: Executes the function with its arguments
 // - Variable references: Retrieves the variable's value
@@ -554,19 +894,30 @@ func (p *dslParser) parseNode() (*dslNode, error) {
 func (p *dslParser) evaluateNode(node *dslNode) (any, error) {
 	switch node.kind {
 	case nodes.argRef:
-		index, err := strconv.Atoi(strings.TrimPrefix(node.data, "$"))
-		if err != nil {
-			return nil, errors.PSR_ARG_REF_INVALID(node.data)
+		v, given, err := p.argRef(node.data)
+		if !given && len(node.children) > 0 {
+			return p.evaluateNode(node.children[0])
 		}
-		if index < 1 || index > len(p.args) {
-			return nil, errors.PSR_ARG_REF_OUT_OF_RANGE(index)
-		}
-		return p.args[index-1], nil
+		return v, err
 	case nodes.varRef:
+		if v, ok := p.scope.get(node.data); ok {
+			return v, nil
+		}
 		val := p.dsl.vars.get(node.data)
 		if val == nil {
+			// names can contain dots, otherwise `r.P1.X` is the field X of the field P1 of r
+			if member := p.memberRef(node.data); member != nil {
+				return p.evaluateNode(member)
+			}
+			// names of functions are references to them, i.e. `map(xs sqrt)`
+			if f := p.funcRef(node.data); f != nil {
+				return f, nil
+			}
 			return nil, errors.PSR_VAR_UNDEFINED(node.data)
 		}
+		if val.meta.doc.deprecated {
+			p.dsl.warn(val.meta.doc.warning("variable", node.data))
+		}
 		return val.get(), nil
 	case nodes.arg:
 		// Create a temporary parser to parse the argument
@@ -611,58 +962,95 @@ func (p *dslParser) evaluateNode(node *dslNode) (any, error) {
 		}
 		return argNode.data, nil
 	case nodes.call:
+		if node.data == "" {
+			if len(node.children) == 1 && !node.children[0].named {
+				// a parenthesized expression, i.e. `add(x=1 y=(2))`
+				return p.evaluateNode(node.children[0])
+			}
+			return p.evaluateOptions(node)
+		}
 		// Evaluate all child nodes first
 		args := make([]any, 0)
-		fn := dsl.funcs.get(node.data)
+		fn := p.dsl.funcs.get(node.data)
 		if fn == nil {
+			if f := p.funcValue(node.data); f != nil {
+				return p.evaluateFunc(node, f)
+			}
+			if node.data == "default" {
+				return p.evaluateDefault(node)
+			}
+			if builtin, ok := dslBuiltins[node.data]; ok {
+				return p.evaluateBuiltin(node, builtin)
+			}
 			return nil, errors.PSR_FUNC_UNKNOWN(node.data)
 		}
-		orderedArgs := make([]any, len(fn.meta.params))
-		for i, param := range fn.meta.params {
-			orderedArgs[i] = param.def
+		if fn.meta.doc.deprecated {
+			p.dsl.warn(fn.meta.doc.warning("function", node.data))
 		}
-		namedArgsMode := false
+		orderedArgs := fn.meta.defaults()
+		named := map[string]bool{} // the parameters and fields given by name
 		for _, child := range node.children {
 			if child.named {
-				namedArgsMode = true
-				// Find the parameter index by name
-				found := false
+				if named[child.argName] {
+					return nil, errors.PSR_PARAM_DUPLICATE(child.argName)
+				}
+				named[child.argName] = true
+				// Find the parameter index by name, fields of struct parameters
+				// can be passed directly, i.e. `blur(img radius=3)`
+				index, field := -1, ""
 				for i, param := range fn.meta.params {
 					if param.name == child.argName {
-						var val any
-						val = child.data
-						if len(child.children) > 0 {
-							v, err := p.evaluateNode(child.children[0])
-							if err != nil {
-								return nil, err
-							}
-							val = v
-						}
-						orderedArgs[i] = val
-						found = true
+						index = i
 						break
 					}
 				}
-				if !found {
+				if index < 0 {
+					index, field = fn.meta.optionsParam(child.argName), child.argName
+				}
+				if index < 0 {
 					return nil, errors.PSR_PARAM_UNKNOWN(child.data)
 				}
+				if index < len(args) {
+					// already given by position, i.e. `add(1 a=2)`
+					return nil, errors.PSR_PARAM_DUPLICATE(fn.meta.params[index].name)
+				}
+				var val any
+				val = child.data
+				if len(child.children) > 0 {
+					v, err := p.evaluateNode(child.children[0])
+					if err != nil {
+						return nil, err
+					}
+					val = v
+				}
+				if field != "" {
+					val = Options{field: val}
+				}
+				// options given in several places are merged
+				if opts, ok := val.(Options); ok {
+					if prev, ok := orderedArgs[index].(Options); ok {
+						val = prev.merge(opts)
+					}
+				}
+				orderedArgs[index] = val
 			} else {
-				if namedArgsMode {
-					return nil, errors.PSR_PARAM_STYLE_MISMATCH()
+				if len(named) > 0 {
+					return nil, errors.PSR_ARG_POSITIONAL_AFTER_NAMED()
+				}
+				if p.isSpread(child) {
+					args = append(args, p.args...)
+					continue
 				}
-				val, err := p.evaluateNode(child)
+				val, err := p.evaluateArg(fn.meta.positionalParam(len(args)), child)
 				if err != nil {
 					return nil, err
 				}
 				args = append(args, val)
 			}
 		}
-		// Fill in positional arguments
-		for i, arg := range args {
-			if i >= len(orderedArgs) {
-				return nil, errors.PSR_PARAM_TOO_MANY(node.data)
-			}
-			orderedArgs[i] = arg
+		// Fill in positional arguments, a trailing variadic parameter collects the rest
+		if err := fn.meta.fill(node.data, orderedArgs, args); err != nil {
+			return nil, err
 		}
 		return fn.call(p.dsl.vars, orderedArgs...)
 	case nodes.assign:
@@ -673,183 +1061,56 @@ func (p *dslParser) evaluateNode(node *dslNode) (any, error) {
 		if err != nil {
 			return nil, err
 		}
-		p.dsl.vars.set(node.data, val)
+		names := strings.Fields(node.data)
+		if len(names) > 1 {
+			// destructuring assignment, i.e. "w h: size(img)"
+			rv := reflect.ValueOf(val)
+			if val == nil || (rv.Kind() != reflect.Slice && rv.Kind() != reflect.Array) {
+				return nil, errors.PSR_ASSIGN_NOT_ITERABLE(val)
+			}
+			if rv.Len() != len(names) {
+				return nil, errors.PSR_ASSIGN_COUNT_MISMATCH(len(names), rv.Len())
+			}
+			for i, name := range names {
+				if err := p.dsl.vars.set(name, rv.Index(i).Interface()); err != nil {
+					return nil, err
+				}
+			}
+			return val, nil
+		}
+		if err := p.dsl.vars.set(node.data, val); err != nil {
+			return nil, err
+		}
 		return val, nil
 	case nodes.str:
 		return node.data, nil
+	case nodes.strTemplate:
+		return p.evaluateInterpolation(node)
 	case nodes.integer:
 		return strconv.ParseInt(node.data, 10, 64)
 	case nodes.float:
 		return strconv.ParseFloat(node.data, 64)
+	case nodes.uinteger:
+		return p.dsl.parseUnsigned(node.data)
+	case nodes.color:
+		return p.dsl.parseColor(node.data)
 	case nodes.boolean:
 		return strconv.ParseBool(node.data)
 	case nodes.slice:
 		// Evaluate all children first
 		vals := make([]any, 0, len(node.children))
 		for _, child := range node.children {
+			if p.isSpread(child) {
+				vals = append(vals, p.args...)
+				continue
+			}
 			v, err := p.evaluateNode(child)
 			if err != nil {
 				return nil, err
 			}
 			vals = append(vals, v)
 		}
-
-		// Empty slice -> []any{}
-		if len(vals) == 0 {
-			return []any{}, nil
-		}
-
-		// Helper checks
-		allNumeric := true
-		allStrings := true
-		firstNonNilType := reflect.TypeOf(vals[0])
-		uniformType := true
-		for _, v := range vals {
-			if v == nil {
-				// nil breaks numeric and string checks, and type uniformity
-				allNumeric = false
-				allStrings = false
-				uniformType = false
-				continue
-			}
-			// numeric check via toFloat64
-			if _, err := dsl.toFloat64(v); err != nil {
-				allNumeric = false
-			}
-			if _, ok := v.(string); !ok {
-				allStrings = false
-			}
-			if t := reflect.TypeOf(v); firstNonNilType == nil {
-				firstNonNilType = t
-			} else if t != firstNonNilType {
-				uniformType = false
-			}
-		}
-
-		if allNumeric {
-			res := make([]float64, 0, len(vals))
-			for _, v := range vals {
-				f, _ := dsl.toFloat64(v)
-				res = append(res, f)
-			}
-			return res, nil
-		}
-
-		if allStrings {
-			res := make([]string, 0, len(vals))
-			for _, v := range vals {
-				res = append(res, v.(string))
-			}
-			return res, nil
-		}
-
-		// If all same type, and type matches one of the supported custom types, return typed slice
-		if uniformType && firstNonNilType != nil {
-			switch firstNonNilType {
-			case reflect.TypeOf(&Ellipse{}):
-				out := make([]*Ellipse, 0, len(vals))
-				for _, v := range vals {
-					out = append(out, v.(*Ellipse))
-				}
-				return out, nil
-			case reflect.TypeOf(&NGon{}):
-				out := make([]*NGon, 0, len(vals))
-				for _, v := range vals {
-					out = append(out, v.(*NGon))
-				}
-				return out, nil
-			case reflect.TypeOf(&Point{}):
-				out := make([]*Point, 0, len(vals))
-				for _, v := range vals {
-					out = append(out, v.(*Point))
-				}
-				return out, nil
-			case reflect.TypeOf(&Quad{}):
-				out := make([]*Quad, 0, len(vals))
-				for _, v := range vals {
-					out = append(out, v.(*Quad))
-				}
-				return out, nil
-			case reflect.TypeOf(&Rect{}):
-				out := make([]*Rect, 0, len(vals))
-				for _, v := range vals {
-					out = append(out, v.(*Rect))
-				}
-				return out, nil
-			case reflect.TypeOf(&LineStyle{}):
-				out := make([]*LineStyle, 0, len(vals))
-				for _, v := range vals {
-					out = append(out, v.(*LineStyle))
-				}
-				return out, nil
-			case reflect.TypeOf(&FillStyle{}):
-				out := make([]*FillStyle, 0, len(vals))
-				for _, v := range vals {
-					out = append(out, v.(*FillStyle))
-				}
-				return out, nil
-			case reflect.TypeOf(&TextStyle{}):
-				out := make([]*TextStyle, 0, len(vals))
-				for _, v := range vals {
-					out = append(out, v.(*TextStyle))
-				}
-				return out, nil
-			case reflect.TypeOf(&Text{}):
-				out := make([]*Text, 0, len(vals))
-				for _, v := range vals {
-					out = append(out, v.(*Text))
-				}
-				return out, nil
-			case reflect.TypeOf(&Triangle{}):
-				out := make([]*Triangle, 0, len(vals))
-				for _, v := range vals {
-					out = append(out, v.(*Triangle))
-				}
-				return out, nil
-			case reflect.TypeOf(&Vector{}):
-				out := make([]*Vector, 0, len(vals))
-				for _, v := range vals {
-					out = append(out, v.(*Vector))
-				}
-				return out, nil
-			case reflect.TypeOf((*image.RGBA)(nil)):
-				out := make([]*image.RGBA, 0, len(vals))
-				for _, v := range vals {
-					out = append(out, v.(*image.RGBA))
-				}
-				return out, nil
-			case reflect.TypeOf((*image.NRGBA)(nil)):
-				out := make([]*image.NRGBA, 0, len(vals))
-				for _, v := range vals {
-					out = append(out, v.(*image.NRGBA))
-				}
-				return out, nil
-			case reflect.TypeOf((*image.RGBA64)(nil)):
-				out := make([]*image.RGBA64, 0, len(vals))
-				for _, v := range vals {
-					out = append(out, v.(*image.RGBA64))
-				}
-				return out, nil
-			case reflect.TypeOf((*image.NRGBA64)(nil)):
-				out := make([]*image.NRGBA64, 0, len(vals))
-				for _, v := range vals {
-					out = append(out, v.(*image.NRGBA64))
-				}
-				return out, nil
-			}
-		}
-
-		// Fallback: []any (coerce numerics to float64 for consistency)
-		res := make([]any, 0, len(vals))
-		for _, v := range vals {
-			if _, err := dsl.toFloat64(v); err == nil {
-				f, _ := dsl.toFloat64(v)
-				res = append(res, f)
-				continue
-			}
-			res = append(res, v)
-		}
-		return res, nil
+		return dsl.inferSlice(vals), nil
 	case nodes.matrix:
 		// Evaluate all rows and infer a common type across the matrix.
 		// Rules mirror slice inference, applied to elements across rows.
@@ -1084,196 +1345,209 @@ func (p *dslParser) evaluateNode(node *dslNode) (any, error) {
 			return res, nil
 		}
 		return rowVals, nil
+	case nodes.dict:
+		m := make(Map, len(node.children))
+		for _, entry := range node.children {
+			v, err := p.evaluateNode(entry.children[0])
+			if err != nil {
+				return nil, err
+			}
+			m[entry.argName] = v
+		}
+		return m, nil
 	case nodes.index:
-		if len(node.children) < 2 || len(node.children) > 3 {
+		return p.evaluateIndex(node)
+	case nodes.lambda:
+		return p.lambda(node), nil
+	case nodes.member:
+		base, err := p.evaluateNode(node.children[0])
+		if err != nil {
+			return nil, err
+		}
+		return dsl.member(base, node.data)
+	case nodes.indexAssign:
+		if len(node.children) != 2 {
 			return nil, errors.PSR_ASSIGN_INVALID()
 		}
-		baseVal, err := p.evaluateNode(node.children[0])
+		val, err := p.evaluateNode(node.children[1])
 		if err != nil {
 			return nil, err
 		}
-		if mat, ok := baseVal.([][]float64); ok {
-			if len(node.children) != 3 {
-				return nil, errors.PSR_EXPECTED_ARG()
+		if err := p.assignIndex(node.children[0], val); err != nil {
+			return nil, err
+		}
+		return val, nil
+	case nodes.forRange:
+		return nil, p.evaluateFor(node)
+	case nodes.whileLoop:
+		return nil, p.evaluateWhile(node)
+	case nodes.breakLoop, nodes.contLoop:
+		return nil, dslLoopControl{node.kind}
+	case nodes.tryBlock:
+		return p.evaluateTry(node)
+	default:
+		return nil, errors.PSR_UNSUPPORTED_NODE_TYPE(node)
+	}
+}
+
+// inferSlice returns the values as a typed slice: numbers become []float64,
+// strings []string and values of a single supported type a slice of that type.
+// Other values are kept in an []any.
+func (dsl *dslCollection) inferSlice(vals []any) any {
+	// Empty slice -> []any{}
+	if len(vals) == 0 {
+		return []any{}
+	}
+
+	// Helper checks
+	allNumeric := true
+	allStrings := true
+	firstNonNilType := reflect.TypeOf(vals[0])
+	uniformType := true
+	for _, v := range vals {
+		if v == nil {
+			// nil breaks numeric and string checks, and type uniformity
+			allNumeric = false
+			allStrings = false
+			uniformType = false
+			continue
+		}
+		// numeric check via toFloat64
+		if _, err := dsl.toFloat64(v); err != nil {
+			allNumeric = false
+		}
+		if _, ok := v.(string); !ok {
+			allStrings = false
+		}
+		if t := reflect.TypeOf(v); firstNonNilType == nil {
+			firstNonNilType = t
+		} else if t != firstNonNilType {
+			uniformType = false
+		}
+	}
+
+	if allNumeric {
+		res := make([]float64, 0, len(vals))
+		for _, v := range vals {
+			f, _ := dsl.toFloat64(v)
+			res = append(res, f)
+		}
+		return res
+	}
+
+	if allStrings {
+		res := make([]string, 0, len(vals))
+		for _, v := range vals {
+			res = append(res, v.(string))
+		}
+		return res
+	}
+
+	// If all same type, and type matches one of the supported custom types, return typed slice
+	if uniformType && firstNonNilType != nil {
+		switch firstNonNilType {
+		case reflect.TypeOf(&Ellipse{}):
+			out := make([]*Ellipse, 0, len(vals))
+			for _, v := range vals {
+				out = append(out, v.(*Ellipse))
 			}
-			rIdxVal, err := p.evaluateNode(node.children[1])
-			if err != nil {
-				return nil, err
+			return out
+		case reflect.TypeOf(&NGon{}):
+			out := make([]*NGon, 0, len(vals))
+			for _, v := range vals {
+				out = append(out, v.(*NGon))
 			}
-			cIdxVal, err := p.evaluateNode(node.children[2])
-			if err != nil {
-				return nil, err
+			return out
+		case reflect.TypeOf(&Point{}):
+			out := make([]*Point, 0, len(vals))
+			for _, v := range vals {
+				out = append(out, v.(*Point))
 			}
-			rf, err := dsl.toFloat64(rIdxVal)
-			if err != nil {
-				return nil, err
+			return out
+		case reflect.TypeOf(&Quad{}):
+			out := make([]*Quad, 0, len(vals))
+			for _, v := range vals {
+				out = append(out, v.(*Quad))
 			}
-			cf, err := dsl.toFloat64(cIdxVal)
-			if err != nil {
-				return nil, err
+			return out
+		case reflect.TypeOf(&Rect{}):
+			out := make([]*Rect, 0, len(vals))
+			for _, v := range vals {
+				out = append(out, v.(*Rect))
 			}
-			rIdx := int(rf)
-			cIdx := int(cf)
-			if rIdx < 0 || rIdx >= len(mat) {
-				return nil, errors.PSR_ARG_REF_OUT_OF_RANGE(rIdx)
+			return out
+		case reflect.TypeOf(&LineStyle{}):
+			out := make([]*LineStyle, 0, len(vals))
+			for _, v := range vals {
+				out = append(out, v.(*LineStyle))
 			}
-			if cIdx < 0 || cIdx >= len(mat[rIdx]) {
-				return nil, errors.PSR_ARG_REF_OUT_OF_RANGE(cIdx)
+			return out
+		case reflect.TypeOf(&FillStyle{}):
+			out := make([]*FillStyle, 0, len(vals))
+			for _, v := range vals {
+				out = append(out, v.(*FillStyle))
 			}
-			return mat[rIdx][cIdx], nil
-		}
-		if slice, ok := baseVal.([]float64); ok {
-			idxVal, err := p.evaluateNode(node.children[1])
-			if err != nil {
-				return nil, err
+			return out
+		case reflect.TypeOf(&TextStyle{}):
+			out := make([]*TextStyle, 0, len(vals))
+			for _, v := range vals {
+				out = append(out, v.(*TextStyle))
 			}
-			fidx, err := dsl.toFloat64(idxVal)
-			if err != nil {
-				return nil, err
+			return out
+		case reflect.TypeOf(&Text{}):
+			out := make([]*Text, 0, len(vals))
+			for _, v := range vals {
+				out = append(out, v.(*Text))
 			}
-			i := int(fidx)
-			if i < 0 || i >= len(slice) {
-				return nil, errors.PSR_ARG_REF_OUT_OF_RANGE(i)
+			return out
+		case reflect.TypeOf(&Triangle{}):
+			out := make([]*Triangle, 0, len(vals))
+			for _, v := range vals {
+				out = append(out, v.(*Triangle))
 			}
-			return slice[i], nil
-		}
-
-		// Generic reflection-based indexing for any slice types (1D and 2D)
-		bv := reflect.ValueOf(baseVal)
-		if bv.IsValid() && bv.Kind() == reflect.Slice {
-			if len(node.children) == 2 {
-				idxVal, err := p.evaluateNode(node.children[1])
-				if err != nil {
-					return nil, err
-				}
-				fidx, err := dsl.toFloat64(idxVal)
-				if err != nil {
-					return nil, err
-				}
-				i := int(fidx)
-				if i < 0 || i >= bv.Len() {
-					return nil, errors.PSR_ARG_REF_OUT_OF_RANGE(i)
-				}
-				return bv.Index(i).Interface(), nil
+			return out
+		case reflect.TypeOf(&Vector{}):
+			out := make([]*Vector, 0, len(vals))
+			for _, v := range vals {
+				out = append(out, v.(*Vector))
 			}
-			if len(node.children) == 3 {
-				// 2D indexing: base must be slice of slices
-				if bv.Len() == 0 {
-					return nil, errors.PSR_ARG_REF_OUT_OF_RANGE(0)
-				}
-				if bv.Type().Elem().Kind() != reflect.Slice {
-					return nil, errors.CAST_NOT_POSSIBLE("index base", "[][]T")
-				}
-				rIdxVal, err := p.evaluateNode(node.children[1])
-				if err != nil {
-					return nil, err
-				}
-				cIdxVal, err := p.evaluateNode(node.children[2])
-				if err != nil {
-					return nil, err
-				}
-				rf, err := dsl.toFloat64(rIdxVal)
-				if err != nil {
-					return nil, err
-				}
-				cf, err := dsl.toFloat64(cIdxVal)
-				if err != nil {
-					return nil, err
-				}
-				r := int(rf)
-				c := int(cf)
-				if r < 0 || r >= bv.Len() {
-					return nil, errors.PSR_ARG_REF_OUT_OF_RANGE(r)
-				}
-				row := bv.Index(r)
-				if row.Kind() != reflect.Slice {
-					return nil, errors.CAST_NOT_POSSIBLE("index base", "[][]T")
-				}
-				if c < 0 || c >= row.Len() {
-					return nil, errors.PSR_ARG_REF_OUT_OF_RANGE(c)
-				}
-				return row.Index(c).Interface(), nil
+			return out
+		case reflect.TypeOf((*image.RGBA)(nil)):
+			out := make([]*image.RGBA, 0, len(vals))
+			for _, v := range vals {
+				out = append(out, v.(*image.RGBA))
 			}
-		}
-		return nil, errors.CAST_NOT_POSSIBLE("index base", "slice or slice of slices")
-	case nodes.forRange:
-		if len(node.children) < 2 {
-			return nil, errors.PSR_FOR_INVALID_VARS()
-		}
-
-		targetVal, err := p.evaluateNode(node.children[0])
-		if err != nil {
-			return nil, err
-		}
-
-		varNames := strings.Fields(node.data)
-		if len(varNames) == 0 {
-			return nil, errors.PSR_FOR_INVALID_VARS()
-		}
-
-		target := reflect.ValueOf(targetVal)
-		if !target.IsValid() || target.Kind() != reflect.Slice {
-			return nil, errors.PSR_FOR_TARGET_NOT_ITERABLE()
-		}
-
-		if target.Len() == 0 {
-			return nil, nil
-		}
-
-		if target.Type().Elem().Kind() == reflect.Slice {
-			if len(varNames) == 3 {
-				for i := 0; i < target.Len(); i++ {
-					row := target.Index(i)
-					for j := 0; j < row.Len(); j++ {
-						item := row.Index(j).Interface()
-						p.dsl.vars.set(varNames[0], float64(i))
-						p.dsl.vars.set(varNames[1], float64(j))
-						p.dsl.vars.set(varNames[2], item)
-
-						for _, stmt := range node.children[1:] {
-							_, err := p.evaluateNode(stmt)
-							if err != nil {
-								return nil, err
-							}
-						}
-					}
-				}
-			} else if len(varNames) == 2 {
-				for i := 0; i < target.Len(); i++ {
-					row := target.Index(i).Interface()
-					p.dsl.vars.set(varNames[0], float64(i))
-					p.dsl.vars.set(varNames[1], row)
-
-					for _, stmt := range node.children[1:] {
-						_, err := p.evaluateNode(stmt)
-						if err != nil {
-							return nil, err
-						}
-					}
-				}
-			} else {
-				return nil, errors.PSR_FOR_INVALID_VARS()
+			return out
+		case reflect.TypeOf((*image.NRGBA)(nil)):
+			out := make([]*image.NRGBA, 0, len(vals))
+			for _, v := range vals {
+				out = append(out, v.(*image.NRGBA))
 			}
-		} else {
-			if len(varNames) != 2 {
-				return nil, errors.PSR_FOR_INVALID_VARS()
+			return out
+		case reflect.TypeOf((*image.RGBA64)(nil)):
+			out := make([]*image.RGBA64, 0, len(vals))
+			for _, v := range vals {
+				out = append(out, v.(*image.RGBA64))
 			}
-			for i := 0; i < target.Len(); i++ {
-				item := target.Index(i).Interface()
-				p.dsl.vars.set(varNames[0], float64(i))
-				p.dsl.vars.set(varNames[1], item)
-
-				for _, stmt := range node.children[1:] {
-					_, err := p.evaluateNode(stmt)
-					if err != nil {
-						return nil, err
-					}
-				}
+			return out
+		case reflect.TypeOf((*image.NRGBA64)(nil)):
+			out := make([]*image.NRGBA64, 0, len(vals))
+			for _, v := range vals {
+				out = append(out, v.(*image.NRGBA64))
 			}
+			return out
 		}
+	}
 
-		return nil, nil
-	default:
-		return nil, errors.PSR_UNSUPPORTED_NODE_TYPE(node)
+	// Fallback: []any (coerce numerics to float64 for consistency)
+	res := make([]any, 0, len(vals))
+	for _, v := range vals {
+		if _, err := dsl.toFloat64(v); err == nil {
+			f, _ := dsl.toFloat64(v)
+			res = append(res, f)
+			continue
+		}
+		res = append(res, v)
 	}
+	return res
 }
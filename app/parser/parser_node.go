@@ -1,4 +1,4 @@
-package main
+package parser
 
 import (
 	"fmt"
@@ -33,6 +33,10 @@ func (n *dslNode) String() string {
 		typ = "float"
 	case nodes.integer:
 		typ = "int"
+	case nodes.uinteger:
+		typ = "uint"
+	case nodes.color:
+		typ = "color"
 	case nodes.boolean:
 		typ = "bool"
 	case nodes.assign:
@@ -45,6 +49,32 @@ func (n *dslNode) String() string {
 		typ = "slice"
 	case nodes.forRange:
 		typ = "for"
+	case nodes.dict:
+		typ = "map"
+	case nodes.index:
+		typ = "index"
+	case nodes.indexRange:
+		typ = "range"
+	case nodes.indexAssign:
+		typ = "index assign"
+	case nodes.member:
+		typ = "member"
+	case nodes.lambda:
+		typ = "lambda"
+	case nodes.whileLoop:
+		typ = "while"
+	case nodes.breakLoop:
+		typ = "break"
+	case nodes.contLoop:
+		typ = "continue"
+	case nodes.numRange:
+		typ = "range"
+	case nodes.tryBlock:
+		typ = "try"
+	case nodes.block:
+		typ = "block"
+	case nodes.strTemplate:
+		typ = "interpolated string"
 	}
 	return fmt.Sprintf("Node{Type: %s, Value: %s, Children: %v, Named: %t, ArgName: %s}", typ, n.data, n.children, n.named, n.argName)
 }
@@ -0,0 +1,93 @@
+package parser
+
+import (
+	"fmt"
+	"strings"
+)
+
+// parseString returns the node of a string token. Interpolated strings, i.e.
+// "size: ${w}x${h}", become a node whose children are the literal parts and
+// the embedded expressions.
+func (p *dslParser) parseString(token *dslToken) (*dslNode, error) {
+	if token.parts == nil {
+		return &dslNode{
+			kind: nodes.str,
+			data: token.Value,
+		}, nil
+	}
+	node := &dslNode{
+		kind:   nodes.strTemplate,
+		data:   token.Value,
+		Line:   token.Line,
+		Column: token.Column,
+	}
+	for i, part := range token.parts {
+		if i%2 == 0 {
+			node.children = append(node.children, &dslNode{kind: nodes.str, data: part})
+			continue
+		}
+		expr, err := p.parseInterpolation(part)
+		if err != nil {
+			return nil, err
+		}
+		node.children = append(node.children, expr)
+	}
+	return node, nil
+}
+
+// parseInterpolation parses the expression embedded in a string, it must be
+// a single expression.
+func (p *dslParser) parseInterpolation(src string) (*dslNode, error) {
+	t := &dslTokenizer{source: src, token: dsl.newToken("", tokens.invalid), state: dsl.newState()}
+	if err := t.tokenize(); err != nil {
+		return nil, err
+	}
+	if err := t.lex(); err != nil {
+		return nil, err
+	}
+	sub := &dslParser{dsl: p.dsl, tokens: t.getTokens(), pos: -1, args: []any{}, loops: p.loops}
+	var expr *dslNode
+	for sub.advance() {
+		if sub.curr.Type == tokens.terminator || sub.curr.Type == tokens.comment {
+			continue
+		}
+		if expr != nil {
+			return nil, errors.PSR_INTERPOLATION_INVALID(src)
+		}
+		node, err := sub.parseNode()
+		if err != nil {
+			return nil, err
+		}
+		if node == nil || node.kind == nodes.assign {
+			return nil, errors.PSR_INTERPOLATION_INVALID(src)
+		}
+		expr = node
+	}
+	if expr == nil {
+		return nil, errors.PSR_INTERPOLATION_INVALID(src)
+	}
+	return expr, nil
+}
+
+// evaluateInterpolation evaluates the parts of an interpolated string and
+// joins them, values are converted like arguments of string parameters,
+// values without a string form are formatted like Go values.
+func (p *dslParser) evaluateInterpolation(node *dslNode) (any, error) {
+	var sb strings.Builder
+	for _, child := range node.children {
+		v, err := p.evaluateNode(child)
+		if err != nil {
+			return nil, err
+		}
+		if v == nil {
+			sb.WriteString("nil")
+			continue
+		}
+		if s, err := p.dsl.castToType(v, "string"); err == nil {
+			sb.WriteString(s.(string))
+		} else {
+			sb.WriteString(fmt.Sprint(v)) // i.e. slices
+		}
+	}
+	return sb.String(), nil
+}
@@ -0,0 +1,114 @@
+package parser
+
+// parseTry parses a try block and its catch block, i.e.
+// `try { img: load($1) } catch err { log(err.message) }`. The name of the
+// caught error is optional.
+func (p *dslParser) parseTry() (*dslNode, error) {
+	node := &dslNode{
+		kind:   nodes.tryBlock,
+		Line:   p.curr.Line,
+		Column: p.curr.Column,
+	}
+	body, err := p.parseBlock("try")
+	if err != nil {
+		return nil, err
+	}
+	for p.next != nil && p.next.Type == tokens.terminator {
+		p.advance()
+	}
+	if p.next == nil || p.next.Type != tokens.catchBlock {
+		return nil, errors.PSR_CATCH_MISSING()
+	}
+	p.advance()
+	if p.next != nil && p.next.Type == tokens.varRef {
+		p.advance()
+		node.data = p.curr.Value
+	}
+	handler, err := p.parseBlock("catch")
+	if err != nil {
+		return nil, err
+	}
+	node.children = []*dslNode{body, handler}
+	return node, nil
+}
+
+// parseBlock parses the statements of the block that follows keyword up to
+// its closing brace, blocks can be empty.
+func (p *dslParser) parseBlock(keyword string) (*dslNode, error) {
+	if !p.advanceOperand() || p.curr.Type != tokens.blockStart {
+		return nil, errors.PSR_BLOCK_EXPECTED(keyword)
+	}
+	node := &dslNode{
+		kind:   nodes.block,
+		data:   keyword,
+		Line:   p.curr.Line,
+		Column: p.curr.Column,
+	}
+	for p.advance() {
+		if p.curr.Type == tokens.blockEnd {
+			return node, nil
+		}
+		if p.curr.Type == tokens.terminator || p.curr.Type == tokens.comment || p.curr.Value == "" {
+			continue
+		}
+
+		stmt, err := p.parseNode()
+		if err != nil {
+			return nil, err
+		}
+		if stmt != nil {
+			node.children = append(node.children, stmt)
+		}
+	}
+	return nil, errors.TKN_PAREN_MISMATCH()
+}
+
+// evaluateTry evaluates a try block. If one of its statements fails, the
+// catch block is evaluated with the error assigned to the name of the catch.
+// Loop control and canceled scripts aren't caught. The value is the one of
+// the last statement evaluated.
+func (p *dslParser) evaluateTry(node *dslNode) (any, error) {
+	res, err := p.evaluateBlock(node.children[0])
+	if err == nil || !p.catchable(err) {
+		return res, err
+	}
+	if node.data != "" {
+		if err := p.dsl.vars.set(node.data, newError(err)); err != nil {
+			return nil, err
+		}
+	}
+	return p.evaluateBlock(node.children[1])
+}
+
+// evaluateBlock evaluates the statements of a block, the value is the one of
+// the last statement.
+func (p *dslParser) evaluateBlock(node *dslNode) (res any, err error) {
+	for _, stmt := range node.children {
+		if res, err = p.evaluateNode(stmt); err != nil {
+			return nil, err
+		}
+	}
+	return res, nil
+}
+
+// evaluateDefault evaluates `default(value fallback)`, the fallback is only
+// evaluated if the value fails, i.e. `default(load($1) blank(64 64))`.
+func (p *dslParser) evaluateDefault(node *dslNode) (any, error) {
+	if len(node.children) != 2 || node.children[0].named || node.children[1].named {
+		return nil, errors.PSR_BUILTIN_ARGS("default(value fallback), fallback is used if value fails")
+	}
+	res, err := p.evaluateNode(node.children[0])
+	if err == nil || !p.catchable(err) {
+		return res, err
+	}
+	return p.evaluateNode(node.children[1])
+}
+
+// catchable returns false for the errors that try blocks and defaults don't
+// handle: break and continue statements and canceled scripts.
+func (p *dslParser) catchable(err error) bool {
+	if _, ok := err.(dslLoopControl); ok {
+		return false
+	}
+	return p.dsl.context().Err() == nil
+}
@@ -1,14 +1,19 @@
-package main
+package parser
 
 import (
+	"context"
+	"encoding/json"
+	"flag"
 	"fmt"
 	"image"
 	"image/color"
 	"image/png"
+	"io"
 	"os"
 	"path/filepath"
 	"reflect"
 	"strings"
+	"sync"
 	"testing"
 
 	"github.com/toxyl/math"
@@ -148,19 +153,25 @@ func createTestLanguage() {
 		"pos", "int", "index", "The position of something in a list",
 		0, 10, 20,
 		func() any { return pos },
-		func(a any) { pos = a.(int) },
+		func(a any) error { pos = a.(int); return nil },
 	)
 	dsl.vars.register(
 		"on", "bool", "", "Whether or not the feature is enabled",
 		nil, nil, true,
 		func() any { return isEnabled },
-		func(a any) { isEnabled = a.(bool) },
+		func(a any) error { isEnabled = a.(bool); return nil },
 	)
 	dsl.vars.register(
 		"item", "any", "", "The item at the current position in the list",
 		nil, nil, true,
 		func() any { return list[pos] },
-		func(a any) { list[pos] = a },
+		func(a any) error { list[pos] = a; return nil },
+	)
+	dsl.vars.register(
+		"max-items", "int", "", "The maximum number of items in the list",
+		nil, nil, 21,
+		func() any { return len(list) },
+		nil,
 	)
 	dsl.funcs.register(
 		"add",
@@ -208,6 +219,88 @@ func createTestLanguage() {
 			return strings.Join(values, ""), nil
 		},
 	)
+	dsl.funcs.register(
+		"sum",
+		"Sums all given numbers",
+		[]dslParamMeta{
+			{name: "values", typ: "int", min: 0, max: 100, unit: "", desc: "The numbers to sum", variadic: true},
+		},
+		[]dslParamMeta{
+			{name: "result", typ: "int", def: 0, unit: "", desc: "The sum of all numbers"},
+		},
+		func(args ...any) (any, error) {
+			res := 0
+			for _, v := range castVariadic[int](args[0]) {
+				res += v
+			}
+			return res, nil
+		},
+	)
+	dsl.funcs.register(
+		"join",
+		"Joins strings with a separator",
+		[]dslParamMeta{
+			{name: "sep", typ: "string", def: ",", unit: "", desc: "The separator"},
+			{name: "parts", typ: "string", unit: "", desc: "The strings to join", variadic: true},
+		},
+		[]dslParamMeta{
+			{name: "result", typ: "string", def: "", unit: "", desc: "The joined string"},
+		},
+		func(args ...any) (any, error) {
+			return strings.Join(castVariadic[string](args[1]), args[0].(string)), nil
+		},
+	)
+	dsl.funcs.register(
+		"divmod",
+		"Divides two integers and returns quotient and remainder",
+		[]dslParamMeta{
+			{name: "a", typ: "int", def: 0, unit: "", desc: "The dividend"},
+			{name: "b", typ: "int", min: 1, max: 100, def: 1, unit: "", desc: "The divisor"},
+		},
+		[]dslParamMeta{
+			{name: "q", typ: "int", def: 0, unit: "", desc: "The quotient"},
+			{name: "r", typ: "int", def: 0, unit: "", desc: "The remainder"},
+		},
+		func(args ...any) (any, error) {
+			a, b := args[0].(int), args[1].(int)
+			return Tuple{a / b, a % b}, nil
+		},
+	)
+	dsl.funcs.register(
+		"blend",
+		"Describes how a layer is blended",
+		[]dslParamMeta{
+			{name: "opacity", typ: "int", min: 0, max: 100, def: 100, unit: "%", desc: "The opacity of the layer"},
+			{name: "mode", typ: "string", def: "normal", unit: "", desc: "The blend mode", values: []string{"normal", "multiply", "screen"}},
+		},
+		[]dslParamMeta{
+			{name: "result", typ: "string", def: "", unit: "", desc: "The blend description"},
+		},
+		func(args ...any) (any, error) {
+			return fmt.Sprintf("%s %d%%", args[1].(string), args[0].(int)), nil
+		},
+	)
+	dsl.funcs.register(
+		"steps",
+		"Runs a number of steps, reporting progress and stopping when the script is canceled",
+		[]dslParamMeta{
+			{name: "n", typ: "int", min: 1, max: 10, def: 3, unit: "", desc: "The number of steps"},
+		},
+		[]dslParamMeta{
+			{name: "done", typ: "int", def: 0, unit: "", desc: "The number of steps done"},
+		},
+		func(args ...any) (any, error) {
+			// mirrors the wrapper generated for `func steps(ctx context.Context, p ProgressReporter, n int) (int, error)`
+			ctx, p, n := dsl.context(), dsl.progress("steps"), args[0].(int)
+			for i := 0; i < n; i++ {
+				if err := ctx.Err(); err != nil {
+					return i, err
+				}
+				p.Report(float64(i+1), float64(n))
+			}
+			return n, nil
+		},
+	)
 	dsl.funcs.register(
 		"test-function-1", "This is a test function",
 		[]dslParamMeta{
@@ -647,6 +740,12 @@ func createTestLanguage() {
 			)
 		},
 	)
+	dsl.funcs.addExamples("add",
+		dslExample{expr: "add(1 mul(2 3))", result: "7"},
+		dslExample{expr: "add(1 2)", result: "int"},
+	)
+	dsl.funcs.addExamples("divmod", dslExample{expr: "divmod(17 5)", result: "(3 2)"})
+	dsl.funcs.addExamples("P", dslExample{expr: "P(1 2)"})
 	dsl.storeState()
 }
 
@@ -698,9 +797,61 @@ for data[i item]
 done
 aSliceBreaksItBecauseYouDontProperlyTrackState: { 1 2 3 }
 x`, []any{}, &dslResult{70.0, nil}, false),
+			c("for loop with item only", `data: { 1 2 } s: 0 for data[x] s: add(s x) done s`, []any{}, &dslResult{3, nil}, false),
+			c("range", `s: 0 for i in 1..4 s: add(s i) done s`, []any{}, &dslResult{10, nil}, false),
+			c("range with step", `s: 0 for i in 0..10 step 2 s: add(s i) done s`, []any{}, &dslResult{30, nil}, false),
+			c("range down", `s: ">" for i in 3..1 s: concat(s i) done s`, []any{}, &dslResult{">321", nil}, false),
+			c("range down with step", `s: 0 for i in 10..0 step -5 s: add(s i) done s`, []any{}, &dslResult{15, nil}, false),
+			c("range of floats", `l: {} for x in 0..1 step 0.5 l: append(l x) done l`, []any{}, &dslResult{[]float64{0, 0.5, 1}, nil}, false),
+			c("range with index", `s: ">" for i x in 5..7 s: concat(s i) done s`, []any{}, &dslResult{">012", nil}, false),
+			c("range with call", `a: { 1 2 3 } s: 0 for i in 1..len(a) s: add(s i) done s`, []any{}, &dslResult{6, nil}, false),
+			c("range with variables", `n: 3 s: 0 for i in n..n s: add(s i) done s`, []any{}, &dslResult{3, nil}, false),
+			c("range with wrong step", `for i in 0..10 step -1 x: i done`, []any{}, nil, true),
+			c("range with zero step", `for i in 0..10 step 0 x: i done`, []any{}, nil, true),
+			c("range of strings", `for i in "a".."b" x: i done`, []any{}, nil, true),
+			c("literal slice", `s: 0 for x in { 1 2 3 } s: add(s x) done s`, []any{}, &dslResult{6, nil}, false),
+			c("literal slice with index", `s: 0 for i x in { 5 6 } s: add(s i) done s`, []any{}, &dslResult{1, nil}, false),
+			c("call result", `s: 0 for x in divmod(17 5) s: add(s x) done s`, []any{}, &dslResult{5, nil}, false),
+			c("variable", `data: { 1 2 } s: 0 for x in data s: add(s x) done s`, []any{}, &dslResult{3, nil}, false),
+			c("map values", `s: 0 for v in { a: 1 b: 2 } s: add(s v) done s`, []any{}, &dslResult{3, nil}, false),
+			c("matrix rows", `m: { <1 2> <3 4> } s: 0 for row in m s: add(s row[1]) done s`, []any{}, &dslResult{6, nil}, false),
+			c("matrix cells", `m: { <1 2> <3 4> } s: 0 for r c v in m s: add(s v) done s`, []any{}, &dslResult{10, nil}, false),
+			c("too many names", `for a b c in { 1 2 } x: a done`, []any{}, nil, true),
+			c("not iterable", `for x in 5 y: x done`, []any{}, nil, true),
+			c("empty body", `for x in { 1 2 } done`, []any{}, nil, true),
+			c("nested", `s: 0 for i in 1..3 for j in 1..2 s: add(s mul(i j)) done done s`, []any{}, &dslResult{18, nil}, false),
+			c("nested multi-line", `total: 0
+for i in 1..3
+    for j in 1..3
+        total: add(total 1)
+    done
+done
+total`, []any{}, &dslResult{9, nil}, false),
+			c("nested legacy", `data: { 1 2 } s: 0 for data[i x] for data[j y] s: add(s mul(x y)) done done s`, []any{}, &dslResult{9, nil}, false),
+			c("break", `s: 0 for x in { 1 2 3 } s: add(s x) break done s`, []any{}, &dslResult{1, nil}, false),
+			c("break inner loop", `n: 0 for i in 1..3 for j in 1..5 n: add(n 1) break done done n`, []any{}, &dslResult{3, nil}, false),
+			c("continue", `s: 0 for x in { 1 2 3 } s: add(s x) continue s: 100 done s`, []any{}, &dslResult{6, nil}, false),
+			c("while", `i: 0 while lt(i 5) i: add(i 1) done i`, []any{}, &dslResult{5, nil}, false),
+			c("while multi-line", "i: 0\ns: 0\nwhile lt(i 3)\n    i: add(i 1)\n    for j in 1..i\n        s: add(s j)\n    done\ndone\ns", []any{}, &dslResult{10, nil}, false),
+			c("while false", `i: 0 while lt(i 0) i: add(i 1) done i`, []any{}, &dslResult{int64(0), nil}, false),
+			c("while break", `i: 0 while true i: add(i 1) break done i`, []any{}, &dslResult{1, nil}, false),
+			c("while not bool", `while 1 x: 1 done`, []any{}, nil, true),
+			c("while without condition", `while`, []any{}, nil, true),
+			c("break outside loop", `break`, []any{}, nil, true),
+			c("continue outside loop", `add(1 2) continue`, []any{}, nil, true),
+			c("break in lambda", `for x in { 1 } f: () => break done`, []any{}, nil, true),
 		}
 
 		createTestLanguage()
+		defer createTestLanguage()
+		dsl.funcs.register("lt", "Compares two numbers",
+			[]dslParamMeta{{name: "a", typ: "float64"}, {name: "b", typ: "float64"}},
+			nil,
+			func(a ...any) (any, error) {
+				return a[0].(float64) < a[1].(float64), nil
+			},
+		)
+		dsl.storeState()
 		for _, tt := range tests {
 			dsl.restoreState()
 			t.Run(tt.name, func(t *testing.T) {
@@ -711,6 +862,347 @@ x`, []any{}, &dslResult{70.0, nil}, false),
 	})
 }
 
+func TestErrorHandling(t *testing.T) {
+	t.Run("Error Handling", func(t *testing.T) {
+		type TestCase struct {
+			name    string
+			script  string
+			want    *dslResult
+			wantErr bool
+		}
+		c := func(name, script string, want *dslResult, wantErr bool) TestCase {
+			return TestCase{name, script, want, wantErr}
+		}
+		tests := []TestCase{
+			c("try without error", `x: 0 try { x: 1 } catch { x: 2 } x`, &dslResult{1, nil}, false),
+			c("catch error", `x: 0 try { x: check(-1) } catch { x: 2 } x`, &dslResult{2, nil}, false),
+			c("skip rest of try", `x: 0 try { y: check(-1) x: 1 } catch { } x`, &dslResult{0, nil}, false),
+			c("error message", `try { check(-1) } catch err { m: err.message } m`, &dslResult{"negative value", nil}, false),
+			c("error code of function", `try { check(-1) } catch err { c: err.code } c`, &dslResult{"ERROR", nil}, false),
+			c("error code of language", `try { missing } catch err { c: err.code } c`, &dslResult{"PSR_VAR_UNDEFINED", nil}, false),
+			c("error as string", `try { fail("oops") } catch err { s: concat(">" err) } s`, &dslResult{">oops", nil}, false),
+			c("fail", `try { fail("bad input") } catch err { m: err.message } m`, &dslResult{"bad input", nil}, false),
+			c("fail code", `try { fail("bad input") } catch err { c: err.code } c`, &dslResult{"FAIL", nil}, false),
+			c("fail with code", `try { fail("bad input" "E_INPUT") } catch err { c: err.code } c`, &dslResult{"E_INPUT", nil}, false),
+			c("throw again", `try { try { throw("inner" "E1") } catch err { throw(err) } } catch e { c: e.code } c`, &dslResult{"E1", nil}, false),
+			c("value of try", `try { check(2) } catch { 5 }`, &dslResult{2, nil}, false),
+			c("value of catch", `try { check(-2) } catch { 5 }`, &dslResult{5, nil}, false),
+			c("skip failing elements", `n: 0
+for x in { 1 -2 3 }
+    try {
+        v: check(x)
+        n: add(n v)
+    } catch err {
+        continue
+    }
+    n: add(n 10)
+done
+n`, &dslResult{24, nil}, false),
+			c("skip failing elements on one line", `n: 0 for x in { -1 2 } try { n: add(n check(x)) } catch err { continue } done n`, &dslResult{2, nil}, false),
+			c("break in try", `n: 0 for x in { 1 2 3 } try { n: add(n x) break } catch { } done n`, &dslResult{1, nil}, false),
+			c("uncaught fail", `fail("stop")`, nil, true),
+			c("error in catch", `try { check(-1) } catch { check(-2) }`, nil, true),
+			c("fail without message", `fail()`, nil, true),
+			c("try without catch", `try { x: 1 }`, nil, true),
+			c("catch without try", `catch { x: 1 }`, nil, true),
+			c("unclosed block", `try { x: 1`, nil, true),
+			c("default", `default(check(-1) 0)`, &dslResult{0, nil}, false),
+			c("default without error", `default(check(2) 0)`, &dslResult{2, nil}, false),
+			c("default is lazy", `default(1 check(-1))`, &dslResult{1, nil}, false),
+			c("default map key", `m: { a: 1 } default(m["b"] 7)`, &dslResult{7, nil}, false),
+			c("default without fallback", `default(1)`, nil, true),
+		}
+		createTestLanguage()
+		defer createTestLanguage()
+		dsl.funcs.register("check", "Returns a number that isn't negative",
+			[]dslParamMeta{{name: "v", typ: "float64"}},
+			nil,
+			func(a ...any) (any, error) {
+				if a[0].(float64) < 0 {
+					return nil, fmt.Errorf("negative value")
+				}
+				return a[0], nil
+			},
+		)
+		dsl.funcs.register("concat", "Concatenates two strings",
+			[]dslParamMeta{{name: "a", typ: "string"}, {name: "b", typ: "string"}},
+			nil,
+			func(a ...any) (any, error) {
+				return a[0].(string) + a[1].(string), nil
+			},
+		)
+		dsl.storeState()
+		for _, tt := range tests {
+			dsl.restoreState()
+			t.Run(tt.name, func(t *testing.T) {
+				got, err := dsl.run(tt.script, "", nil, false)
+				testResult(t, tt.name, tt.want, tt.wantErr, got, err)
+			})
+		}
+	})
+}
+
+func TestStrings(t *testing.T) {
+	t.Run("Strings", func(t *testing.T) {
+		type TestCase struct {
+			name    string
+			script  string
+			want    *dslResult
+			wantErr bool
+		}
+		c := func(name, script string, want *dslResult, wantErr bool) TestCase {
+			return TestCase{name, script, want, wantErr}
+		}
+		tests := []TestCase{
+			c("escapes", `"a\tb\n\\"`, &dslResult{"a\tb\n\\", nil}, false),
+			c("escaped quote", `"say \"hi\""`, &dslResult{`say "hi"`, nil}, false),
+			c("hex escape", `"\x41\x42"`, &dslResult{"AB", nil}, false),
+			c("unicode escape", `"caf\u00e9"`, &dslResult{"café", nil}, false),
+			c("long unicode escape", `"\U0001F600"`, &dslResult{"\U0001F600", nil}, false),
+			c("utf-8 text", `"héllo wörld"`, &dslResult{"héllo wörld", nil}, false),
+			c("unknown escape", `"\q"`, nil, true),
+			c("unknown escape in path", `"C:\data"`, nil, true),
+			c("escaped backslash in path", `"C:\\data"`, &dslResult{`C:\data`, nil}, false),
+			c("invalid unicode escape", `"\uZZZZ"`, nil, true),
+			c("short unicode escape", `"\u12"`, nil, true),
+			c("empty string", `s: "" s`, &dslResult{"", nil}, false),
+			c("empty string length", `len("")`, &dslResult{0, nil}, false),
+			c("raw string", "`a\\nb`", &dslResult{`a\nb`, nil}, false),
+			c("raw multi-line string", "s: `line 1\nline 2`\ns", &dslResult{"line 1\nline 2", nil}, false),
+			c("raw string with quotes", "`say \"hi\" # and ${x}`", &dslResult{`say "hi" # and ${x}`, nil}, false),
+			c("raw string unterminated", "`abc", nil, true),
+			c("interpolation", `w: 3 h: 4 "size: ${w}x${h}"`, &dslResult{"size: 3x4", nil}, false),
+			c("interpolation of call", `"sum: ${add(1 2)}"`, &dslResult{"sum: 3", nil}, false),
+			c("interpolation of float", `x: 1.5 "${x}"`, &dslResult{"1.5", nil}, false),
+			c("interpolation of bool", `"${true}"`, &dslResult{"true", nil}, false),
+			c("interpolation of string", `"<${"inner"}>"`, &dslResult{"<inner>", nil}, false),
+			c("interpolation of field", `m: { name: "box" } "name: ${m.name}"`, &dslResult{"name: box", nil}, false),
+			c("interpolation of index", `a: { 1 2 3 } "${a[1]}"`, &dslResult{"2", nil}, false),
+			c("interpolation of slice", `"${ { 1 2 } }"`, &dslResult{"[1 2]", nil}, false),
+			c("interpolation as argument", `len("${add(10 5)}")`, &dslResult{2, nil}, false),
+			c("interpolation in lambda", `f: (x) => "<${x}>" f(5)`, &dslResult{"<5>", nil}, false),
+			c("interpolation in loop", `s: ">" for i in 1..3 s: "${s}${i}" done s`, &dslResult{">123", nil}, false),
+			c("escaped interpolation", `"\${w}"`, &dslResult{"${w}", nil}, false),
+			c("empty interpolation", `"${}"`, nil, true),
+			c("interpolation of two values", `"${1 2}"`, nil, true),
+			c("interpolation of assignment", `"${x: 1}"`, nil, true),
+			c("unterminated interpolation", `"${w"`, nil, true),
+			c("interpolation of undefined variable", `"${nope}"`, nil, true),
+		}
+		createTestLanguage()
+		for _, tt := range tests {
+			dsl.restoreState()
+			t.Run(tt.name, func(t *testing.T) {
+				got, err := dsl.run(tt.script, "", nil, false)
+				testResult(t, tt.name, tt.want, tt.wantErr, got, err)
+			})
+		}
+
+		t.Run("errors", func(t *testing.T) {
+			for script, want := range map[string]string{
+				`"\q"`:      "invalid escape sequence \\q at position 2",
+				`"C:\data"`: "invalid escape sequence \\d at position 4",
+				`"ok" "\%"`: "invalid escape sequence \\% at position 7",
+			} {
+				dsl.restoreState()
+				_, err := dsl.run(script, "", nil, false)
+				if err == nil || !strings.Contains(err.Error(), want) {
+					t.Errorf("%s: error = %v, want it to contain %q", script, err, want)
+				}
+			}
+		})
+	})
+}
+
+func TestNumbers(t *testing.T) {
+	t.Run("Numbers", func(t *testing.T) {
+		type TestCase struct {
+			name    string
+			script  string
+			want    *dslResult
+			wantErr bool
+		}
+		c := func(name, script string, want *dslResult, wantErr bool) TestCase {
+			return TestCase{name, script, want, wantErr}
+		}
+		tests := []TestCase{
+			c("hex", `0xFF`, &dslResult{int64(255), nil}, false),
+			c("negative hex", `x: -0x10 x`, &dslResult{int64(-16), nil}, false),
+			c("binary", `0b1010`, &dslResult{int64(10), nil}, false),
+			c("octal", `0o17`, &dslResult{int64(15), nil}, false),
+			c("leading zero", `012`, &dslResult{int64(12), nil}, false),
+			c("underscores", `1_000_000`, &dslResult{int64(1000000), nil}, false),
+			c("underscores in float", `1_000.5`, &dslResult{1000.5, nil}, false),
+			c("scientific", `1e-3`, &dslResult{0.001, nil}, false),
+			c("scientific with fraction", `x: 2.5e2 x`, &dslResult{250.0, nil}, false),
+			c("hex argument", `add(0x10 1)`, &dslResult{17, nil}, false),
+			c("hex in slice", `a: { 0x1 0b10 3 } a[1]`, &dslResult{int64(2), nil}, false),
+			c("hex map key", `m: { 0xFF: "max" } m["255"]`, &dslResult{"max", nil}, false),
+			c("hex range", `s: 0 for i in 0x1..0b11 s: add(s i) done s`, &dslResult{6, nil}, false),
+			c("too large", `9_223_372_036_854_775_808`, nil, true),
+			c("double underscore", `x: 1__0 x`, nil, true),
+			c("unsigned", `255u8`, &dslResult{uint8(255), nil}, false),
+			c("unsigned without size", `x: 7u x`, &dslResult{uint(7), nil}, false),
+			c("unsigned hex", `0xFFFFu16`, &dslResult{uint16(65535), nil}, false),
+			c("unsigned 64", `18_446_744_073_709_551_615u64`, &dslResult{uint64(18446744073709551615), nil}, false),
+			c("unsigned argument", `channel(200u8)`, &dslResult{uint8(200), nil}, false),
+			c("unsigned overflow", `256u8`, nil, true),
+			c("negative unsigned", `x: -1u x`, nil, true),
+			c("color", `#ff8800`, &dslResult{color.NRGBA{255, 136, 0, 255}, nil}, false),
+			c("color with alpha", `c: #ff880080 c`, &dslResult{color.NRGBA{255, 136, 0, 128}, nil}, false),
+			c("color upper case", `#FF8800`, &dslResult{color.NRGBA{255, 136, 0, 255}, nil}, false),
+			c("color argument", `premultiply(#ff880080)`, &dslResult{color.RGBA{128, 68, 0, 128}, nil}, false),
+			c("color in slice", `a: { #000000 #ffffff } a[1]`, &dslResult{color.NRGBA{255, 255, 255, 255}, nil}, false),
+			c("comment after color", `c: #00ff00 # green # c`, &dslResult{color.NRGBA{0, 255, 0, 255}, nil}, false),
+			c("comment with hex digits", `# abcdef # 1`, &dslResult{int64(1), nil}, false),
+			c("comment starting with hex digits", `#abcdef# 1`, &dslResult{int64(1), nil}, false),
+			c("comment starting with short hex word", `#fed up# 1`, &dslResult{int64(1), nil}, false),
+			c("hex without digits", `0x`, nil, true),
+			c("binary without digits", `x: 0b x`, nil, true),
+			c("trailing underscore", `x: 10_ x`, nil, true),
+			c("exponent without digits", `add(1 1e)`, nil, true),
+			c("digits before name", `x: 12abc x`, nil, true),
+			c("too large assignment", `x: 9_223_372_036_854_775_808 x`, nil, true),
+			c("short color", `#abc`, nil, true),
+			c("short color with alpha", `c: #abcd c`, nil, true),
+			c("color with odd digits", `c: #abcde c`, nil, true),
+		}
+		createTestLanguage()
+		defer createTestLanguage()
+		dsl.funcs.register("channel", "Returns a color channel",
+			[]dslParamMeta{{name: "v", typ: "uint8"}},
+			nil,
+			func(a ...any) (any, error) {
+				return a[0], nil
+			},
+		)
+		dsl.funcs.register("premultiply", "Returns the premultiplied color",
+			[]dslParamMeta{{name: "c", typ: "color.RGBA"}},
+			nil,
+			func(a ...any) (any, error) {
+				return a[0], nil
+			},
+		)
+		dsl.storeState()
+		for _, tt := range tests {
+			dsl.restoreState()
+			t.Run(tt.name, func(t *testing.T) {
+				got, err := dsl.run(tt.script, "", nil, false)
+				testResult(t, tt.name, tt.want, tt.wantErr, got, err)
+			})
+		}
+
+		t.Run("error position", func(t *testing.T) {
+			for script, want := range map[string]string{
+				`x: 0x x`:         "[1:4] invalid number 0x",
+				`x: 1__0 x`:       "[1:4] invalid number 1__0",
+				`add(1 0x)`:       "[1:7] invalid number 0x",
+				`#abc`:            "[1:1] invalid color #abc",
+				"x: 1\nc: #abc c": "[2:4] invalid color #abc",
+			} {
+				dsl.restoreState()
+				_, err := dsl.run(script, "", nil, false)
+				if err == nil || !strings.HasPrefix(err.Error(), want) {
+					t.Errorf("%q: error = %v, want %s", script, err, want)
+				}
+			}
+		})
+	})
+}
+
+func TestComments(t *testing.T) {
+	t.Run("Comments", func(t *testing.T) {
+		type TestCase struct {
+			name    string
+			script  string
+			want    *dslResult
+			wantErr bool
+		}
+		c := func(name, script string, want *dslResult, wantErr bool) TestCase {
+			return TestCase{name, script, want, wantErr}
+		}
+		tests := []TestCase{
+			c("line comment", "x: 5 // the width\nx", &dslResult{int64(5), nil}, false),
+			c("line comment without space", "x: 2// two\nadd(x 1)", &dslResult{3, nil}, false),
+			c("line comment in call", "add(1 // one\n2)", &dslResult{3, nil}, false),
+			c("line comment in slice", "a: { 1 // one\n2 } a[1]", &dslResult{int64(2), nil}, false),
+			c("line comment after loop header", "s: 0 for i in 1..3 // sum\ns: add(s i) done s", &dslResult{6, nil}, false),
+			c("line comment with block comment", "x: 1 // a # in it\nx", &dslResult{int64(1), nil}, false),
+			c("line comment with keyword", "x: 1 // for each\nx", &dslResult{int64(1), nil}, false),
+			c("block comment with keyword", `add(1 # try this # 2)`, &dslResult{3, nil}, false),
+			c("keyword in string", `s: "for" s`, &dslResult{"for", nil}, false),
+			c("slashes in string", `"http://example.com"`, &dslResult{"http://example.com", nil}, false),
+			c("doc comment", "/// the width\nw: 3\nw", &dslResult{int64(3), nil}, false),
+			c("only a line comment", `// nothing`, nil, true),
+		}
+		createTestLanguage()
+		for _, tt := range tests {
+			dsl.restoreState()
+			t.Run(tt.name, func(t *testing.T) {
+				got, err := dsl.run(tt.script, "", nil, false)
+				testResult(t, tt.name, tt.want, tt.wantErr, got, err)
+			})
+		}
+	})
+
+	t.Run("DocComments", func(t *testing.T) {
+		script := strings.Join([]string{
+			"/// Blurs an image twice.",
+			"macro twice(img) { blur(blur(img)) };",
+			"",
+			"/// Doubles a number.",
+			"/// Works for ints and floats.",
+			"double: (x) => mul(x 2)",
+			"/// The width of the output.",
+			"width: 800 // in pixels",
+			"/// Not attached, there's a blank line.",
+			"",
+			"height: 600",
+			"// not a doc comment",
+			"depth: 8",
+		}, "\n")
+		docs := dsl.parseScriptDocs(script)
+		want := []dslScriptDoc{
+			{name: "twice", kind: "macro", params: []string{"img"}, desc: "Blurs an image twice.", line: 2},
+			{name: "double", kind: "func", params: []string{"x"}, desc: "Doubles a number.\nWorks for ints and floats.", line: 6},
+			{name: "width", kind: "var", desc: "The width of the output.", line: 8},
+		}
+		if len(docs) != len(want) {
+			t.Fatalf("got %d docs, want %d", len(docs), len(want))
+		}
+		for i, doc := range docs {
+			if !reflect.DeepEqual(*doc, want[i]) {
+				t.Errorf("doc %d = %+v, want %+v", i, *doc, want[i])
+			}
+		}
+		if got := docs[0].signature(); got != "{{ twice(img) }}" {
+			t.Errorf("macro signature = %q", got)
+		}
+		if got := docs[1].signature(); got != "double(x)" {
+			t.Errorf("func signature = %q", got)
+		}
+
+		md := dsl.docScript(script, "markdown")
+		for _, s := range []string{"## Macros", "### `{{ twice(img) }}`", "## Functions", "### `double(x)`", "Works for ints and floats.", "## Variables", "### `width`"} {
+			if !strings.Contains(md, s) {
+				t.Errorf("script docs should contain %q, got:\n%s", s, md)
+			}
+		}
+		if strings.Contains(md, "height") || strings.Contains(md, "depth") {
+			t.Errorf("undocumented definitions should not be listed, got:\n%s", md)
+		}
+
+		createTestLanguage()
+		defer createTestLanguage()
+		if _, err := dsl.run("/// The number of tiles.\ntiles: 4\ntiles", "", nil, false); err != nil {
+			t.Fatalf("run failed: %v", err)
+		}
+		if doc, ok := dsl.docs["tiles"]; !ok || doc.desc != "The number of tiles." {
+			t.Errorf("docs of run scripts should be kept for search, got %+v", dsl.docs)
+		}
+	})
+}
+
 func TestBasicExpressions(t *testing.T) {
 	t.Run("Basic Expressions", func(t *testing.T) {
 		type TestCase struct {
@@ -1529,7 +2021,9 @@ func TestTypeConversions(t *testing.T) {
 			{name: "function to function", value: func() {}, targetType: "func()", wantErr: true},
 			{name: "function to interface", value: func() {}, targetType: "interface{}", wantErr: true},
 			{name: "map to interface", value: map[string]int{"a": 1}, targetType: "interface{}", wantErr: true},
-			{name: "map to map", value: map[string]int{"a": 1}, targetType: "map[string]int", wantErr: true},
+			{name: "map to map", value: map[string]int{"a": 1}, targetType: "map[string]int", want: map[string]int{"a": 1}},
+			{name: "map to map of floats", value: Map{"a": int64(1)}, targetType: "map[string]float64", want: map[string]float64{"a": 1}},
+			{name: "map with int keys to map", value: map[int]int{1: 1}, targetType: "map[string]int", wantErr: true},
 			{name: "nil value", value: nil, targetType: "int", wantErr: true},
 			{name: "unsupported target type", value: 42, targetType: "map", wantErr: true},
 			{name: "unsupported type", value: struct{}{}, targetType: "int", wantErr: true},
@@ -1570,7 +2064,7 @@ func TestParser(t *testing.T) {
 			c("just an int", `42`, []any{}, &dslResult{int64(42), nil}, false),
 			c("mixed types", `concat($1 $2)`, []any{"hello", 42}, &dslResult{"hello42", nil}, false),
 			c("multiple arguments", `add($1 $2)`, []any{5, 3}, &dslResult{8, nil}, false),
-			c("named arguments mixed with positional arguments", `test-function-1(x=1 y=test-function-2(1 2) str="hello")`, []any{}, nil, true),
+			c("named arguments with positional arguments in nested call", `test-function-1(x=1 y=add(1 2) str="hello")`, []any{}, &dslResult{4, nil}, false),
 			c("named arguments out of order", `test-function-1(str="hello" y=2 x=1)`, []any{}, &dslResult{3, nil}, false),
 			c("named arguments", `test-function-1(x=1 y=2 str="hello")`, []any{}, &dslResult{3, nil}, false),
 			c("named optional arguments 1", `test-function-1(x=1 y=2)`, []any{}, &dslResult{3, nil}, false),
@@ -1836,11 +2330,21 @@ func TestSliceIndexing(t *testing.T) {
 			c("literal index", `mySlice: { 1 2 3 4 5 6 } v: mySlice[2] v`, []any{}, &dslResult{float64(3), nil}, false),
 			c("variable index", `n: 4 mySlice: { 1 2 3 4 5 6 } v: mySlice[n] v`, []any{}, &dslResult{float64(5), nil}, false),
 			c("func index", `mySlice: { 1 2 3 4 5 6 } v: mySlice[add(2 3)] v`, []any{}, &dslResult{float64(6), nil}, false),
-			c("oob negative", `mySlice: { 1 2 3 } v: mySlice[-1] v`, []any{}, &dslResult{nil, nil}, true),
+			c("negative index", `mySlice: { 1 2 3 } v: mySlice[-1] v`, []any{}, &dslResult{float64(3), nil}, false),
+			c("oob negative", `mySlice: { 1 2 3 } v: mySlice[-4] v`, []any{}, &dslResult{nil, nil}, true),
 			c("oob too large", `mySlice: { 1 2 3 } v: mySlice[3] v`, []any{}, &dslResult{nil, nil}, true),
 			c("string slice index", `s: { "a" "b" "c" } v: s[1] v`, []any{}, &dslResult{"b", nil}, false),
 			c("any slice index", `x: { 1 "a" true } v1: x[0] v1`, []any{}, &dslResult{float64(1), nil}, false),
 			c("nested slice", `x: { "hello" <2 3> <5 6> } v1: x[2] v1`, []any{}, &dslResult{[]float64{5.0, 6.0}, nil}, false),
+			c("range", `mySlice: { 1 2 3 4 5 6 } mySlice[1:3]`, []any{}, &dslResult{[]float64{2, 3}, nil}, false),
+			c("range open start", `mySlice: { 1 2 3 4 5 6 } mySlice[:2]`, []any{}, &dslResult{[]float64{1, 2}, nil}, false),
+			c("range open end", `mySlice: { 1 2 3 4 5 6 } mySlice[4:]`, []any{}, &dslResult{[]float64{5, 6}, nil}, false),
+			c("range negative", `mySlice: { 1 2 3 4 5 6 } mySlice[-2:]`, []any{}, &dslResult{[]float64{5, 6}, nil}, false),
+			c("range with func", `mySlice: { 1 2 3 4 5 6 } mySlice[add(1 1):len(mySlice)]`, []any{}, &dslResult{[]float64{3, 4, 5, 6}, nil}, false),
+			c("range of strings", `s: { "a" "b" "c" } s[1:]`, []any{}, &dslResult{[]string{"b", "c"}, nil}, false),
+			c("range is a copy", `a: { 1 2 3 } b: a[:] b[0]: 9 a`, []any{}, &dslResult{[]float64{1, 2, 3}, nil}, false),
+			c("range reversed", `mySlice: { 1 2 3 } mySlice[2:1]`, []any{}, &dslResult{nil, nil}, true),
+			c("range too large", `mySlice: { 1 2 3 } mySlice[1:4]`, []any{}, &dslResult{nil, nil}, true),
 		}
 
 		createTestLanguage()
@@ -1873,6 +2377,139 @@ func TestMatrixLiteralsAndIndexing(t *testing.T) {
 			c("oob row", `m: { <1 2> <3 4> } v: m[2 0] v`, &dslResult{nil, nil}, true),
 			c("oob col", `m: { <1 2> <3 4> } v: m[0 2] v`, &dslResult{nil, nil}, true),
 			c("generic 2D index strings", `m: { <"a" "b"> <"c" "d"> } v: m[1 0] v`, &dslResult{"c", nil}, false),
+			c("negative 2D index", `m: { <1 2> <3 4> } m[-1 -2]`, &dslResult{float64(3), nil}, false),
+			c("sub-matrix", `m: { <1 2 3> <4 5 6> <7 8 9> } m[0:2 1:3]`, &dslResult{[][]float64{{2, 3}, {5, 6}}, nil}, false),
+			c("row", `m: { <1 2 3> <4 5 6> <7 8 9> } m[1 :]`, &dslResult{[]float64{4, 5, 6}, nil}, false),
+			c("column", `m: { <1 2 3> <4 5 6> <7 8 9> } m[: 1]`, &dslResult{[]float64{2, 5, 8}, nil}, false),
+			c("range of rows", `m: { <"a" "b"> <"c" "d"> } m[1: :1]`, &dslResult{[][]string{{"c"}}, nil}, false),
+			c("oob column range", `m: { <1 2> <3 4> } m[: 1:3]`, &dslResult{nil, nil}, true),
+		}
+		createTestLanguage()
+		for _, tt := range tests {
+			dsl.restoreState()
+			t.Run(tt.name, func(t *testing.T) {
+				got, err := dsl.run(tt.script, "", nil, false)
+				testResult(t, tt.name, tt.want, tt.wantErr, got, err)
+			})
+		}
+	})
+}
+
+func TestIndexAssignment(t *testing.T) {
+	t.Run("Index Assignment", func(t *testing.T) {
+		weights := []float64{1, 2}
+		createTestLanguage()
+		defer createTestLanguage()
+		dsl.vars.register("weights", "[]float64", "", "Read-only weights", nil, nil, nil,
+			func() any { return weights },
+			nil,
+		)
+		dsl.storeState()
+
+		type TestCase struct {
+			name    string
+			script  string
+			want    *dslResult
+			wantErr bool
+		}
+		c := func(name, script string, want *dslResult, wantErr bool) TestCase {
+			return TestCase{name, script, want, wantErr}
+		}
+		tests := []TestCase{
+			c("slice element", `a: { 1 2 3 } a[2]: 5 a`, &dslResult{[]float64{1, 2, 5}, nil}, false),
+			c("negative index", `a: { 1 2 3 } a[-1]: 9 a`, &dslResult{[]float64{1, 2, 9}, nil}, false),
+			c("result is the value", `a: { 1 2 3 } a[0]: 4`, &dslResult{int64(4), nil}, false),
+			c("string element", `s: { "a" "b" } s[0]: "z" s`, &dslResult{[]string{"z", "b"}, nil}, false),
+			c("matrix element", `m: { <1 2> <3 4> } m[1 0]: 0.5 m`, &dslResult{[][]float64{{1, 2}, {0.5, 4}}, nil}, false),
+			c("map entry", `d: { x: 1 } d["y"]: 2 d`, &dslResult{Map{"x": int64(1), "y": int64(2)}, nil}, false),
+			c("copies are independent", `a: { 1 2 3 } b: a b[0]: 9 a`, &dslResult{[]float64{1, 2, 3}, nil}, false),
+			c("element type mismatch", `a: { 1 2 3 } a[0]: "x"`, nil, true),
+			c("out of range", `a: { 1 2 3 } a[3]: 1`, nil, true),
+			c("range", `a: { 1 2 3 } a[0:2]: 1`, nil, true),
+			c("read-only variable", `weights[0]: 3`, nil, true),
+			c("missing value", `a: { 1 2 3 } a[0]:`, nil, true),
+		}
+		for _, tt := range tests {
+			dsl.restoreState()
+			t.Run(tt.name, func(t *testing.T) {
+				got, err := dsl.run(tt.script, "", nil, false)
+				testResult(t, tt.name, tt.want, tt.wantErr, got, err)
+			})
+		}
+	})
+}
+
+func TestPostfix(t *testing.T) {
+	t.Run("Postfix", func(t *testing.T) {
+		type TestCase struct {
+			name    string
+			script  string
+			want    *dslResult
+			wantErr bool
+		}
+		c := func(name, script string, want *dslResult, wantErr bool) TestCase {
+			return TestCase{name, script, want, wantErr}
+		}
+		tests := []TestCase{
+			c("chained index", `m: { <1 2> <3 4> } m[1][0]`, &dslResult{float64(3), nil}, false),
+			c("chained index assigned", `m: { <1 2> <3 4> } x: m[1][0] x`, &dslResult{float64(3), nil}, false),
+			c("index of call", `divmod(17 5)[1]`, &dslResult{2, nil}, false),
+			c("index of call assigned", `x: divmod(17 5)[0] x`, &dslResult{3, nil}, false),
+			c("index of call as argument", `add(divmod(17 5)[1] 2)`, &dslResult{4, nil}, false),
+			c("index of call in index", `a: { 1 2 3 } a[divmod(5 3)[1]]`, &dslResult{float64(3), nil}, false),
+			c("index of call followed by call", "divmod(17 5)[1]\nadd(1 2)", &dslResult{3, nil}, false),
+			c("range of literal", `{ 1 2 3 }[1:]`, &dslResult{[]float64{2, 3}, nil}, false),
+			c("field of call", `P(1 2).Y`, &dslResult{float64(2), nil}, false),
+			c("field of call as argument", `add(P(3 2).X 1)`, &dslResult{4, nil}, false),
+			c("field of variable", `r: P(1 2) r.X`, &dslResult{float64(1), nil}, false),
+			c("field of element", `a: { P(1 2) P(3 4) } a[1].X`, &dslResult{float64(3), nil}, false),
+			c("fields in slice", `{ divmod(9 2)[0] P(1 2).X }`, &dslResult{[]float64{4, 1}, nil}, false),
+			c("field case-insensitive", `d: { p: P(5 6) } d["p"].y`, &dslResult{float64(6), nil}, false),
+			c("map entry", `d: { p: P(5 6) } d.p.Y`, &dslResult{float64(6), nil}, false),
+			c("unknown field", `P(1 2).Z`, nil, true),
+			c("field of number", `x: 1 x.y`, nil, true),
+			c("field of undefined", `t.X`, nil, true),
+			c("field assignment", `m: { <1 2> } m[0].X: 3`, nil, true),
+			c("index of call assignment", `divmod(17 5)[0]: 3`, nil, true),
+		}
+		createTestLanguage()
+		for _, tt := range tests {
+			dsl.restoreState()
+			t.Run(tt.name, func(t *testing.T) {
+				got, err := dsl.run(tt.script, "", nil, false)
+				testResult(t, tt.name, tt.want, tt.wantErr, got, err)
+			})
+		}
+	})
+}
+
+func TestArgumentStyles(t *testing.T) {
+	t.Run("ArgumentStyles", func(t *testing.T) {
+		type TestCase struct {
+			name    string
+			script  string
+			want    *dslResult
+			wantErr bool
+		}
+		c := func(name, script string, want *dslResult, wantErr bool) TestCase {
+			return TestCase{name, script, want, wantErr}
+		}
+		tests := []TestCase{
+			c("positional then named", `test-function-1(1 y=2)`, &dslResult{3, nil}, false),
+			c("positional then named out of order", `test-function-1(1 str="hi" y=5)`, &dslResult{6, nil}, false),
+			c("named with positional nested call", `test-function-1(x=1 y=add(1 2))`, &dslResult{4, nil}, false),
+			c("positional with named nested call", `test-function-1(test-function-1(x=1 y=1) 3)`, &dslResult{5, nil}, false),
+			c("variadic positional then named", `join(sep="-")`, &dslResult{"", nil}, false),
+			c("named slice", `sum(values={1 2})`, &dslResult{3, nil}, false),
+			c("named slice after positional", `join("-" parts={"a" "b"})`, &dslResult{"a-b", nil}, false),
+			c("named indexed slice", `test-function-1(1 y={1 2}[0])`, &dslResult{2, nil}, false),
+			c("named indexed variable", `v: {1 2} test-function-1(1 y=v[1])`, &dslResult{3, nil}, false),
+			c("named parenthesized", `test-function-1(x=1 y=(2))`, &dslResult{3, nil}, false),
+			c("positional parenthesized", `test-function-1((1) 2)`, &dslResult{3, nil}, false),
+			c("positional after named", `test-function-1(x=1 2)`, nil, true),
+			c("named given twice", `test-function-1(x=1 x=2)`, nil, true),
+			c("named already given by position", `test-function-1(1 x=2)`, nil, true),
+			c("second named already given by position", `test-function-1(1 2 y=3)`, nil, true),
 		}
 		createTestLanguage()
 		for _, tt := range tests {
@@ -1882,6 +2519,1457 @@ func TestMatrixLiteralsAndIndexing(t *testing.T) {
 				testResult(t, tt.name, tt.want, tt.wantErr, got, err)
 			})
 		}
+
+		t.Run("errors", func(t *testing.T) {
+			for script, want := range map[string]string{
+				`test-function-1(x=1 2)`:   "positional arguments must come before named arguments",
+				`test-function-1(x=1 x=2)`: "parameter x is given more than once",
+				`test-function-1(1 x=2)`:   "parameter x is given more than once",
+			} {
+				dsl.restoreState()
+				_, err := dsl.run(script, "", nil, false)
+				if err == nil || !strings.Contains(err.Error(), want) {
+					t.Errorf("%s: error = %v, want it to contain %q", script, err, want)
+				}
+			}
+		})
+	})
+}
+
+func TestScriptArgs(t *testing.T) {
+	t.Run("ScriptArgs", func(t *testing.T) {
+		type TestCase struct {
+			name    string
+			script  string
+			args    []any
+			want    *dslResult
+			wantErr bool
+		}
+		c := func(name, script string, args []any, want *dslResult, wantErr bool) TestCase {
+			return TestCase{name, script, args, want, wantErr}
+		}
+		header := "/// @arg $width int 1..4096 = 800 The output width\n"
+		tests := []TestCase{
+			c("named argument", `$width`, []any{Args{"width": 800}}, &dslResult{800, nil}, false),
+			c("named and positional arguments", `add($1 $width)`, []any{1, Args{"width": 2}}, &dslResult{3, nil}, false),
+			c("named arguments are merged", `add($a $b)`, []any{Args{"a": 1}, Args{"b": 2}}, &dslResult{3, nil}, false),
+			c("missing named argument", `$width`, nil, nil, true),
+			c("argument count", `$#`, []any{1, 2, Args{"w": 3}}, &dslResult{2, nil}, false),
+			c("argument count without arguments", `$#`, nil, &dslResult{0, nil}, false),
+			c("all arguments", `$@`, []any{1, 2}, &dslResult{[]any{1, 2}, nil}, false),
+			c("spread into call", `add($@)`, []any{1, 2}, &dslResult{3, nil}, false),
+			c("spread into lambda", "f: (a b) => add(a b)\nf($@)", []any{1, 2}, &dslResult{3, nil}, false),
+			c("spread into slice", `{0 $@}`, []any{int64(1), int64(2)}, &dslResult{[]int64{0, 1, 2}, nil}, false),
+			c("default of missing argument", `$2 ?? 10`, []any{1}, &dslResult{int64(10), nil}, false),
+			c("default of given argument", `$1 ?? 10`, []any{1}, &dslResult{1, nil}, false),
+			c("default of missing named argument", `$height ?? 600`, nil, &dslResult{int64(600), nil}, false),
+			c("default in call", `add($1 $2 ?? 10)`, []any{1}, &dslResult{11, nil}, false),
+			c("default before argument", `add($2 ?? 10 $1)`, []any{1}, &dslResult{11, nil}, false),
+			c("default call", "x: $2 ?? add(1 2)\nx", nil, &dslResult{3, nil}, false),
+			c("chained defaults", `$3 ?? $2 ?? 3`, []any{1, 7}, &dslResult{7, nil}, false),
+			c("default in interpolation", `"${$1}x${$h ?? 4}"`, []any{2}, &dslResult{"2x4", nil}, false),
+			c("default without argument", "x: 1\nx ?? 3", nil, nil, true),
+			c("default without value", `$1 ??`, []any{1}, nil, true),
+			c("declared argument", header+`$width`, []any{Args{"width": 300}}, &dslResult{300, nil}, false),
+			c("declared argument is converted", header+`$width`, []any{Args{"width": "300"}}, &dslResult{300, nil}, false),
+			c("declared argument takes its default", header+`$width`, nil, &dslResult{800, nil}, false),
+			c("declared argument out of range", header+`$width`, []any{Args{"width": 5000}}, nil, true),
+			c("declared argument of wrong type", header+`$width`, []any{Args{"width": "wide"}}, nil, true),
+			c("required positional argument", "/// @arg $1 int\n$1", nil, nil, true),
+			c("positional argument takes its default", "/// @arg $2 float64 0..1 = 0.5\n$2", []any{"x"}, &dslResult{0.5, nil}, false),
+			c("invalid declaration", "/// @arg width int\n1", nil, nil, true),
+			c("invalid default", "/// @arg $w int = wide\n1", nil, nil, true),
+		}
+		createTestLanguage()
+		for _, tt := range tests {
+			dsl.restoreState()
+			t.Run(tt.name, func(t *testing.T) {
+				got, err := dsl.run(tt.script, "", nil, false, tt.args...)
+				testResult(t, tt.name, tt.want, tt.wantErr, got, err)
+			})
+		}
+
+		t.Run("errors", func(t *testing.T) {
+			for script, want := range map[string]string{
+				`$height`:                 "named argument $height is not given",
+				`?? 3`:                    "?? must follow an argument reference",
+				header + `$width`:         "",
+				"/// @arg $1 int\n$1":     "argument $1 is required",
+				"/// @arg $w int 1..9\n1": "argument $w is required",
+			} {
+				dsl.restoreState()
+				_, err := dsl.run(script, "", nil, false, Args{"width": 5000})
+				if want == "" {
+					want = "argument $width: value 5000 is out of bounds (1 - 4096)"
+				}
+				if err == nil || !strings.Contains(err.Error(), want) {
+					t.Errorf("%s: error = %v, want it to contain %q", script, err, want)
+				}
+			}
+		})
+
+		t.Run("docs", func(t *testing.T) {
+			script := "/// Resizes an image.\n/// @arg $1 any The image\n" + header + "\n/// Twice the width\nw: mul($width 2)"
+			doc := dsl.docScriptMarkdown(script)
+			for _, want := range []string{
+				"## Arguments",
+				"- `$1` (`any`, required): The image",
+				"- `$width` (`int`, 1..4096, default `800`): The output width",
+				"### `w`\n\nTwice the width",
+			} {
+				if !strings.Contains(doc, want) {
+					t.Errorf("docs = %q, want it to contain %q", doc, want)
+				}
+			}
+			prog, err := dsl.compile(script, "", nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(prog.args) != 2 || prog.args[1].name != "width" || prog.args[1].def != 800 || prog.args[1].max != int64(4096) {
+				t.Errorf("args = %+v", prog.args)
+			}
+		})
+	})
+}
+
+func TestScriptParams(t *testing.T) {
+	t.Run("ScriptParams", func(t *testing.T) {
+		l := New("params", "Params", "Testing", "1.0.0", "params")
+		err := l.RegisterFunc("scale",
+			func(a ...any) (any, error) { return a[0].(int) * a[1].(int), nil },
+			FuncMeta{Params: []ParamMeta{{Name: "x", Type: "int", Default: 0}, {Name: "factor", Type: "int", Default: 2}}},
+		)
+		if err != nil {
+			t.Fatalf("RegisterFunc failed: %v", err)
+		}
+		script := `/// @arg $1 int The number to scale
+params {
+	width int 1..4096 = 800 "Output width"
+	factor int 1.. "Scale factor; at least 1"
+	quality float64 0..1 = 0.9; verbose bool = false
+	name string = "out file"
+}
+scale($1 $factor)`
+
+		type TestCase struct {
+			name    string
+			script  string
+			args    []any
+			want    any
+			wantErr bool
+		}
+		c := func(name, script string, args []any, want any, wantErr bool) TestCase {
+			return TestCase{name, script, args, want, wantErr}
+		}
+		tests := []TestCase{
+			c("declared parameters", script, []any{3, Args{"factor": 4}}, 12, false),
+			c("converted parameter", script, []any{3, Args{"factor": "4"}}, 12, false),
+			c("required parameter", script, []any{3}, nil, true),
+			c("parameter out of range", script, []any{3, Args{"factor": 0}}, nil, true),
+			c("parameter default", "params { width int = 800 }\n$width", nil, 800, false),
+			c("single line block", "params { a int = 1; b int = 2 }\nscale($a $b)", nil, 2, false),
+			c("error after multi-line block", "params {\n\ta int = 1\n}\nscale(\n", nil, nil, true),
+			c("unterminated block", "params {\n\ta int = 1\n1", nil, nil, true),
+			c("invalid declaration", "params { a int 1..x = 3 y }\n1", nil, nil, true),
+			c("invalid default", "params { a int = wide }\n1", nil, nil, true),
+			c("declared twice", "params { a int }\n/// @arg $a int\n1", nil, nil, true),
+		}
+		for _, tt := range tests {
+			t.Run(tt.name, func(t *testing.T) {
+				got, err := l.Run(tt.script, tt.args...)
+				if (err != nil) != tt.wantErr {
+					t.Fatalf("Run(%s) error = %v, wantErr %v", tt.script, err, tt.wantErr)
+				}
+				if !tt.wantErr && got != tt.want {
+					t.Errorf("Run(%s) = %v, want %v", tt.script, got, tt.want)
+				}
+			})
+		}
+
+		prog, err := l.Compile(script)
+		if err != nil {
+			t.Fatalf("Compile failed: %v", err)
+		}
+
+		t.Run("metadata", func(t *testing.T) {
+			args := prog.Args()
+			if len(args) != 6 {
+				t.Fatalf("Args() = %+v, want 6 arguments", args)
+			}
+			want := ParamMeta{Name: "width", Type: "int", Default: 800, Min: int64(1), Max: int64(4096), Desc: "Output width"}
+			if !reflect.DeepEqual(args[0], want) {
+				t.Errorf("Args()[0] = %+v, want %+v", args[0], want)
+			}
+			if args[1].Desc != "Scale factor; at least 1" || args[1].Default != nil || args[5].Name != "1" {
+				t.Errorf("Args() = %+v", args)
+			}
+		})
+
+		t.Run("flags", func(t *testing.T) {
+			fs := flag.NewFlagSet("scale", flag.ContinueOnError)
+			fs.SetOutput(io.Discard)
+			args := prog.AddFlags(fs)
+			if err := fs.Parse([]string{"-factor", "5", "-verbose", "7"}); err != nil {
+				t.Fatalf("Parse failed: %v", err)
+			}
+			if args["factor"] != 5 || args["verbose"] != true || len(args) != 2 {
+				t.Errorf("args = %v", args)
+			}
+			if got, err := prog.Run(fs.Arg(0), args); err != nil || got != 35 {
+				t.Errorf("Run = %v, %v, want 35", got, err)
+			}
+			if f := fs.Lookup("width"); f == nil || f.DefValue != "800" || f.Usage != "Output width (1..4096)" {
+				t.Errorf("width flag = %+v", f)
+			}
+			if fs.Lookup("1") != nil {
+				t.Errorf("positional arguments must not be flags")
+			}
+			for _, bad := range [][]string{{"-width", "9000"}, {"-quality", "high"}} {
+				if err := fs.Parse(bad); err == nil {
+					t.Errorf("Parse(%v) should fail", bad)
+				}
+			}
+		})
+
+		t.Run("schema", func(t *testing.T) {
+			data, err := prog.Schema()
+			if err != nil {
+				t.Fatalf("Schema failed: %v", err)
+			}
+			var schema struct {
+				Type       string                    `json:"type"`
+				Properties map[string]map[string]any `json:"properties"`
+				Required   []string                  `json:"required"`
+			}
+			if err := json.Unmarshal(data, &schema); err != nil {
+				t.Fatalf("invalid schema %s: %v", data, err)
+			}
+			width := schema.Properties["width"]
+			if schema.Type != "object" || len(schema.Properties) != 5 || width["type"] != "integer" || width["minimum"] != 1.0 || width["maximum"] != 4096.0 || width["default"] != 800.0 || width["description"] != "Output width" {
+				t.Errorf("schema = %s", data)
+			}
+			if schema.Properties["quality"]["type"] != "number" || schema.Properties["verbose"]["type"] != "boolean" || schema.Properties["name"]["default"] != "out file" {
+				t.Errorf("schema = %s", data)
+			}
+			if !reflect.DeepEqual(schema.Required, []string{"factor"}) {
+				t.Errorf("required = %v, want [factor]", schema.Required)
+			}
+			if i, j := strings.Index(string(data), `"width"`), strings.Index(string(data), `"factor"`); i < 0 || j < i {
+				t.Errorf("properties must be in the order of the declarations: %s", data)
+			}
+		})
+
+		t.Run("docs", func(t *testing.T) {
+			doc := l.DocScript(script, "markdown")
+			for _, want := range []string{
+				"- `$width` (`int`, 1..4096, default `800`): Output width",
+				"- `$factor` (`int`, 1.., required): Scale factor; at least 1",
+				"- `$1` (`int`, required): The number to scale",
+			} {
+				if !strings.Contains(doc, want) {
+					t.Errorf("docs = %q, want it to contain %q", doc, want)
+				}
+			}
+		})
+	})
+}
+
+func TestFunctions(t *testing.T) {
+	t.Run("Functions", func(t *testing.T) {
+		createTestLanguage()
+		defer createTestLanguage()
+		dsl.funcs.register("gt", "Compares two numbers",
+			[]dslParamMeta{{name: "a", typ: "float64"}, {name: "b", typ: "float64"}},
+			nil,
+			func(a ...any) (any, error) {
+				return a[0].(float64) > a[1].(float64), nil
+			},
+		)
+		dsl.funcs.register("apply", "Calls a function with a number",
+			[]dslParamMeta{{name: "fn", typ: "func(int) int"}, {name: "x", typ: "int"}},
+			nil,
+			func(a ...any) (any, error) {
+				return castFunc[func(int) int](a[0])(a[1].(int)), nil
+			},
+		)
+		dsl.funcs.register("applyErr", "Calls a function that can fail with a number",
+			[]dslParamMeta{{name: "fn", typ: "func(float64) (float64, error)"}, {name: "x", typ: "float64"}},
+			nil,
+			func(a ...any) (any, error) {
+				return castFunc[func(float64) (float64, error)](a[0])(a[1].(float64))
+			},
+		)
+		dsl.storeState()
+
+		type TestCase struct {
+			name    string
+			script  string
+			want    *dslResult
+			wantErr bool
+		}
+		c := func(name, script string, want *dslResult, wantErr bool) TestCase {
+			return TestCase{name, script, want, wantErr}
+		}
+		tests := []TestCase{
+			c("lambda call", "double: (x) => mul(x 2)\ndouble(21)", &dslResult{42, nil}, false),
+			c("lambda without params", "f: () => 5\nf()", &dslResult{int64(5), nil}, false),
+			c("lambda returning param", "id: (x) => x\nid(\"a\")", &dslResult{"a", nil}, false),
+			c("lambda shadows variable", "x: 100\nf: (x) => add(x 1)\nf(1)", &dslResult{2, nil}, false),
+			c("lambda reads variable", "y: 10\nf: (x) => add(x y)\nf(1)", &dslResult{11, nil}, false),
+			c("nested lambda", "adder: (x) => (y) => add(x y)\nadd5: adder(5)\nadd5(2)", &dslResult{7, nil}, false),
+			c("lambda argument count", "f: (x) => x\nf(1 2)", nil, true),
+			c("lambda named argument", "f: (x) => x\nf(x=1)", nil, true),
+			c("lambda invalid params", "f: (1) => 2", nil, true),
+			c("lambda without body", "map({ 1 2 } (x) =>)", nil, true),
+			c("map", `map({ 1 2 3 } (x) => mul(x 2))`, &dslResult{[]float64{2, 4, 6}, nil}, false),
+			c("map strings", `map({ "a" "b" } (s) => concat(s "!"))`, &dslResult{[]string{"a!", "b!"}, nil}, false),
+			c("map builtin", `map({ "ab" "c" } len)`, &dslResult{[]float64{2, 1}, nil}, false),
+			c("map builtin invalid", `map({ 1 2 } len)`, nil, true),
+			c("map registered function", `map({ 1 2 } (x) => divmod(x 2)[1])`, &dslResult{[]float64{1, 0}, nil}, false),
+			c("map variable", "double: (x) => mul(x 2)\nmap({ 1 2 } double)", &dslResult{[]float64{2, 4}, nil}, false),
+			c("map indexed", `map({ 1 2 3 } (x) => mul(x 2))[2]`, &dslResult{float64(6), nil}, false),
+			c("filter", `filter({ 1 5 2 7 } (x) => gt(x 3))`, &dslResult{[]float64{5, 7}, nil}, false),
+			c("filter not bool", `filter({ 1 2 } (x) => P(1 2))`, nil, true),
+			c("reduce", `reduce({ 1 2 3 4 } (a b) => add(a b))`, &dslResult{10, nil}, false),
+			c("reduce initial", `reduce({ 1 2 3 } (a b) => mul(a b) 10)`, &dslResult{60, nil}, false),
+			c("reduce reference", `reduce({ 1 2 3 } add 0)`, &dslResult{6, nil}, false),
+			c("reduce empty", `reduce({} add)`, nil, true),
+			c("sort", `sort({ 3 1 2 })`, &dslResult{[]float64{1, 2, 3}, nil}, false),
+			c("sort strings", `sort({ "b" "c" "a" })`, &dslResult{[]string{"a", "b", "c"}, nil}, false),
+			c("sort less", `sort({ 3 1 2 } (a b) => gt(a b))`, &dslResult{[]float64{3, 2, 1}, nil}, false),
+			c("sort keeps original", "a: { 3 1 2 }\nb: sort(a)\na", &dslResult{[]float64{3, 1, 2}, nil}, false),
+			c("sort mixed", `sort({ P(1 2) 1 })`, nil, true),
+			c("pipeline", `reduce(map(filter({ 1 2 3 4 } (x) => gt(x 2)) (x) => mul(x x)) add)`, &dslResult{25, nil}, false),
+			c("callback", `apply((x) => mul(x 3) 2)`, &dslResult{6, nil}, false),
+			c("callback reference", `apply(sum 2)`, &dslResult{2, nil}, false),
+			c("callback named", `apply(fn=(x) => add(x 1) x=2)`, &dslResult{3, nil}, false),
+			c("callback error", `apply((x) => concat(x P(1 2)) 2)`, nil, true),
+			c("callback error result", `applyErr((x) => concat(x P(1 2)) 2)`, nil, true),
+			c("callback wrong result", `apply((x) => "a" 2)`, nil, true),
+			c("callback not a function", `apply(1 2)`, nil, true),
+			c("endless recursion", "f: (x) => f(x)\nf(1)", nil, true),
+			c("endless recursion through callback", "f: (x) => apply(f x)\nf(1)", nil, true),
+			c("endless recursion through map", "f: (x) => map({ x } f)\nf(1)", nil, true),
+		}
+		for _, tt := range tests {
+			dsl.restoreState()
+			t.Run(tt.name, func(t *testing.T) {
+				got, err := dsl.run(tt.script, "", nil, false)
+				testResult(t, tt.name, tt.want, tt.wantErr, got, err)
+			})
+		}
+
+		t.Run("call depth", func(t *testing.T) {
+			dsl.restoreState()
+			_, err := dsl.run("f: (x) => f(x)\nf(1)", "", nil, false)
+			if err == nil || !strings.Contains(err.Error(), fmt.Sprintf("deeper than %d calls", maxCallDepth)) {
+				t.Errorf("error = %v, want the call depth error", err)
+			}
+			// the depth is back to zero, so the next script can nest calls again
+			dsl.restoreState()
+			got, err := dsl.run("adder: (x) => (y) => add(x y)\nadd5: adder(5)\nadd5(2)", "", nil, false)
+			testResult(t, "call depth", &dslResult{7, nil}, false, got, err)
+		})
+	})
+}
+
+func TestBuiltins(t *testing.T) {
+	t.Run("Builtins", func(t *testing.T) {
+		type TestCase struct {
+			name    string
+			script  string
+			want    *dslResult
+			wantErr bool
+		}
+		c := func(name, script string, want *dslResult, wantErr bool) TestCase {
+			return TestCase{name, script, want, wantErr}
+		}
+		tests := []TestCase{
+			c("len of slice", `a: { 1 2 3 } len(a)`, &dslResult{3, nil}, false),
+			c("len of matrix", `m: { <1 2> <3 4> <5 6> } len(m)`, &dslResult{3, nil}, false),
+			c("len of row", `m: { <1 2> <3 4> <5 6> } len(m[0 :])`, &dslResult{2, nil}, false),
+			c("len of map", `len({ x: 1 y: 2 })`, &dslResult{2, nil}, false),
+			c("len of string", `len("héllo")`, &dslResult{5, nil}, false),
+			c("len of number", `len(1)`, nil, true),
+			c("len without value", `len()`, nil, true),
+			c("append values", `a: { 1 2 } append(a 3 4)`, &dslResult{[]float64{1, 2, 3, 4}, nil}, false),
+			c("append keeps original", `a: { 1 2 } b: append(a 3) a`, &dslResult{[]float64{1, 2}, nil}, false),
+			c("append slice", `append({ 1 2 } { 3 4 })`, &dslResult{[]float64{1, 2, 3, 4}, nil}, false),
+			c("append to empty", `append({} "a" "b")`, &dslResult{[]string{"a", "b"}, nil}, false),
+			c("append row", `m: { <1 2> } append(m { 3 4 })`, &dslResult{[][]float64{{1, 2}, {3, 4}}, nil}, false),
+			c("append wrong type", `append({ 1 2 } "x")`, nil, true),
+			c("append to number", `append(1 2)`, nil, true),
+		}
+		createTestLanguage()
+		for _, tt := range tests {
+			dsl.restoreState()
+			t.Run(tt.name, func(t *testing.T) {
+				got, err := dsl.run(tt.script, "", nil, false)
+				testResult(t, tt.name, tt.want, tt.wantErr, got, err)
+			})
+		}
+	})
+}
+
+func TestVariadic(t *testing.T) {
+	t.Run("Variadic", func(t *testing.T) {
+		type TestCase struct {
+			name    string
+			script  string
+			want    *dslResult
+			wantErr bool
+		}
+		c := func(name, script string, want *dslResult, wantErr bool) TestCase {
+			return TestCase{name, script, want, wantErr}
+		}
+		tests := []TestCase{
+			c("no values", `sum()`, &dslResult{0, nil}, false),
+			c("single value", `sum(5)`, &dslResult{5, nil}, false),
+			c("positional values", `sum(1 2 3 4)`, &dslResult{10, nil}, false),
+			c("nested calls", `sum(add(1 2) mul(2 3) 4)`, &dslResult{13, nil}, false),
+			c("variables", `a: 10 b: 20 sum(a b)`, &dslResult{30, nil}, false),
+			c("spread slice literal", `sum({1 2 3})`, &dslResult{6, nil}, false),
+			c("spread slice variable", `data: { 4 5 6 } sum(data)`, &dslResult{15, nil}, false),
+			c("spread mixed with values", `sum({1 2} 3)`, &dslResult{6, nil}, false),
+			c("named variadic", `data: { 1 2 3 } sum(values=data)`, &dslResult{6, nil}, false),
+			c("element out of range", `sum(1 200 3)`, nil, true),
+			c("fixed param before variadic", `join("-" "a" "b" "c")`, &dslResult{"a-b-c", nil}, false),
+			c("only fixed param", `join("-")`, &dslResult{"", nil}, false),
+		}
+		createTestLanguage()
+		for _, tt := range tests {
+			dsl.restoreState()
+			t.Run(tt.name, func(t *testing.T) {
+				got, err := dsl.run(tt.script, "", nil, false)
+				testResult(t, tt.name, tt.want, tt.wantErr, got, err)
+			})
+		}
+	})
+}
+
+func TestTuples(t *testing.T) {
+	t.Run("Tuples", func(t *testing.T) {
+		type TestCase struct {
+			name    string
+			script  string
+			want    *dslResult
+			wantErr bool
+		}
+		c := func(name, script string, want *dslResult, wantErr bool) TestCase {
+			return TestCase{name, script, want, wantErr}
+		}
+		tests := []TestCase{
+			c("tuple result", `divmod(17 5)`, &dslResult{Tuple{3, 2}, nil}, false),
+			c("destructure first", `q r: divmod(17 5) q`, &dslResult{3, nil}, false),
+			c("destructure second", `q r: divmod(17 5) r`, &dslResult{2, nil}, false),
+			c("destructure on new line", "x: 1\nq r: divmod(17 x)\nadd(q r)", &dslResult{17, nil}, false),
+			c("destructure after call", "add(1 2)\nq r: divmod(9 4)\nr", &dslResult{1, nil}, false),
+			c("destructure after assignment", `x: 2 q r: divmod(9 x) q`, &dslResult{4, nil}, false),
+			c("destructure slice", `a b c: { 1 2 3 } c`, &dslResult{3, nil}, false),
+			c("index tuple", `t: divmod(17 5) t[1]`, &dslResult{2, nil}, false),
+			c("tuple as argument", `t: divmod(17 5) add(t[0] t[1])`, &dslResult{5, nil}, false),
+			c("too many names", `a b c: divmod(17 5)`, nil, true),
+			c("too few names", `a b: { 1 2 3 }`, nil, true),
+			c("not destructurable", `a b: add(1 2)`, nil, true),
+		}
+		createTestLanguage()
+		for _, tt := range tests {
+			dsl.restoreState()
+			t.Run(tt.name, func(t *testing.T) {
+				got, err := dsl.run(tt.script, "", nil, false)
+				testResult(t, tt.name, tt.want, tt.wantErr, got, err)
+			})
+		}
+	})
+	t.Run("Format", func(t *testing.T) {
+		createTestLanguage()
+		got, err := dsl.run(`divmod(17 5)`, "", nil, false)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if s := fmt.Sprintf("%v", got.value); s != "(3 2)" {
+			t.Errorf("Format = %q, want %q", s, "(3 2)")
+		}
+	})
+}
+
+func TestMaps(t *testing.T) {
+	t.Run("Maps", func(t *testing.T) {
+		createTestLanguage()
+		defer createTestLanguage()
+		dsl.funcs.register("total", "Sums the values of a map",
+			[]dslParamMeta{{name: "values", typ: "map[string]float64"}},
+			nil,
+			func(a ...any) (any, error) {
+				sum := 0.0
+				for _, v := range a[0].(map[string]float64) {
+					sum += v
+				}
+				return sum, nil
+			},
+		)
+		dsl.funcs.register("labels", "Joins the entries of a map",
+			[]dslParamMeta{{name: "m", typ: "map[string]string"}},
+			nil,
+			func(a ...any) (any, error) {
+				return Map{"m": a[0]}.String(), nil
+			},
+		)
+		dsl.funcs.register("scores", "Returns a Go map",
+			nil,
+			nil,
+			func(a ...any) (any, error) {
+				return map[string]float64{"a": 1, "b": 2}, nil
+			},
+		)
+		dsl.funcs.register("concat", "Concatenates two strings",
+			[]dslParamMeta{{name: "a", typ: "string"}, {name: "b", typ: "string"}},
+			nil,
+			func(a ...any) (any, error) {
+				return a[0].(string) + a[1].(string), nil
+			},
+		)
+		dsl.storeState()
+
+		type TestCase struct {
+			name    string
+			script  string
+			want    *dslResult
+			wantErr bool
+		}
+		c := func(name, script string, want *dslResult, wantErr bool) TestCase {
+			return TestCase{name, script, want, wantErr}
+		}
+		tests := []TestCase{
+			c("literal", `{ name: "box" size: 3 }`, &dslResult{Map{"name": "box", "size": int64(3)}, nil}, false),
+			c("quoted keys", `{ "max size": 3 }`, &dslResult{Map{"max size": int64(3)}, nil}, false),
+			c("number keys", `{ 1: "a" 2.50: "b" }`, &dslResult{Map{"1": "a", "2.5": "b"}, nil}, false),
+			c("empty", `{:}`, &dslResult{Map{}, nil}, false),
+			c("calls and variables", `x: 2 { a: x b: add(x 1) }`, &dslResult{Map{"a": int64(2), "b": 3}, nil}, false),
+			c("row value", `{ a: <1 2> }`, &dslResult{Map{"a": []float64{1, 2}}, nil}, false),
+			c("index", `m: { a: 1 b: 2 } m["b"]`, &dslResult{int64(2), nil}, false),
+			c("index number key", `m: { 1: "a" 2: "b" } m[2]`, &dslResult{"b", nil}, false),
+			c("index number as string", `m: { 1: "a" } m["1"]`, &dslResult{"a", nil}, false),
+			c("index variable", `m: { a: 1 } k: "a" m[k]`, &dslResult{int64(1), nil}, false),
+			c("index Go map", `s: scores() s["b"]`, &dslResult{2.0, nil}, false),
+			c("loop", "m: { b: 2 a: 1 10: 3 2: 4 }\ns: \">\"\nfor m[k v]\ns: concat(s k)\ndone\ns", &dslResult{">210ab", nil}, false),
+			c("loop values", "m: { a: 1 b: 2 }\nt: 0\nfor m[k v]\nt: add(t v)\ndone\nt", &dslResult{3, nil}, false),
+			c("cast", `total({ a: 1 b: 2.5 })`, &dslResult{3.5, nil}, false),
+			c("cast empty", `total({:})`, &dslResult{0.0, nil}, false),
+			c("named", `total(values={ a: 1 b: 2.5 })`, &dslResult{3.5, nil}, false),
+			c("named index", `concat(a="x" b={ k: "y" }["k"])`, &dslResult{"xy", nil}, false),
+			c("cast strings", `labels({ a: "x" })`, &dslResult{`{ m: map[a:x] }`, nil}, false),
+			c("cast Go map", `total(scores())`, &dslResult{3.0, nil}, false),
+			c("undefined key", `m: { a: 1 } m["b"]`, nil, true),
+			c("invalid key", `m: { a: 1 } m[true]`, nil, true),
+			c("value without key", `{ a: 1 2 }`, nil, true),
+			c("key without value", `{ a: }`, nil, true),
+			c("element before key", `{ 1 a: 2 }`, nil, true),
+			c("missing key", `{ : 1 }`, nil, true),
+			c("missing key after key", `{ a: : 1 }`, nil, true),
+			c("loop with index", "m: { a: 1 }\nfor m[i k v]\nx: v\ndone", nil, true),
+			c("cast not possible", `total({ a: "x" })`, nil, true),
+			c("not a map", `total({ 1 2 })`, nil, true),
+		}
+		for _, tt := range tests {
+			dsl.restoreState()
+			t.Run(tt.name, func(t *testing.T) {
+				got, err := dsl.run(tt.script, "", nil, false)
+				testResult(t, tt.name, tt.want, tt.wantErr, got, err)
+			})
+		}
+
+		t.Run("String", func(t *testing.T) {
+			m := Map{"name": "box", "max size": 3, "10": true, "2": 1.5}
+			if got, want := m.String(), `{ 2: 1.5 10: true "max size": 3 name: "box" }`; got != want {
+				t.Errorf("got %s, want %s", got, want)
+			}
+		})
+	})
+}
+
+func TestConstants(t *testing.T) {
+	t.Run("Constants", func(t *testing.T) {
+		type TestCase struct {
+			name    string
+			script  string
+			want    *dslResult
+			wantErr bool
+		}
+		c := func(name, script string, want *dslResult, wantErr bool) TestCase {
+			return TestCase{name, script, want, wantErr}
+		}
+		tests := []TestCase{
+			c("read", `max-items`, &dslResult{21, nil}, false),
+			c("as argument", `add(max-items 1)`, &dslResult{22, nil}, false),
+			c("copy to variable", `n: max-items add(n 0)`, &dslResult{21, nil}, false),
+			c("assign", `max-items: 5`, nil, true),
+			c("assign after statement", `n: 1 max-items: n`, nil, true),
+			c("destructure", `a max-items: { 1 2 }`, nil, true),
+		}
+		createTestLanguage()
+		for _, tt := range tests {
+			dsl.restoreState()
+			t.Run(tt.name, func(t *testing.T) {
+				got, err := dsl.run(tt.script, "", nil, false)
+				testResult(t, tt.name, tt.want, tt.wantErr, got, err)
+			})
+		}
+
+		t.Run("error", func(t *testing.T) {
+			dsl.restoreState()
+			_, err := dsl.run(`max-items: 5`, "", nil, false)
+			if err == nil || !strings.Contains(err.Error(), "cannot assign to constant max-items") {
+				t.Errorf("error = %v, want it to mention the constant", err)
+			}
+		})
+
+		t.Run("docs", func(t *testing.T) {
+			doc := dsl.docMarkdown()
+			constants := strings.Index(doc, "\n## Constants")
+			functions := strings.Index(doc, "\n## Functions")
+			if constants < 0 || !strings.Contains(doc[constants:functions], "`max-items`") {
+				t.Errorf("docs should list max-items under Constants")
+			}
+			if strings.Contains(doc[:constants], "`max-items`") {
+				t.Errorf("docs should not list max-items under Variables")
+			}
+		})
+	})
+}
+
+func TestVariables(t *testing.T) {
+	t.Run("Variables", func(t *testing.T) {
+		var alpha uint8 = 100
+		var gain float32 = 1
+		label := "a"
+		createTestLanguage()
+		defer createTestLanguage()
+		dsl.vars.register("alpha", "uint8", "", "Alpha", uint8(10), uint8(200), uint8(100),
+			func() any { return alpha },
+			func(a any) error { alpha = a.(uint8); return nil },
+		)
+		dsl.vars.register("gain", "float32", "", "Gain", 0, 1.5, float32(1),
+			func() any { return gain },
+			func(a any) error { gain = a.(float32); return nil },
+		)
+		dsl.vars.register("label", "string", "", "Label", 1, 5, "a",
+			func() any { return label },
+			func(a any) error { label = a.(string); return nil },
+		)
+		dsl.vars.register("locked", "int", "", "Always rejects values", nil, nil, 0,
+			func() any { return 0 },
+			func(a any) error { return fmt.Errorf("locked") },
+		)
+		dsl.storeState()
+
+		type TestCase struct {
+			name    string
+			script  string
+			want    *dslResult
+			wantErr bool
+		}
+		c := func(name, script string, want *dslResult, wantErr bool) TestCase {
+			return TestCase{name, script, want, wantErr}
+		}
+		tests := []TestCase{
+			c("int literal", `pos: 5 pos`, &dslResult{5, nil}, false),
+			c("float to int", `pos: 2.0 pos`, &dslResult{2, nil}, false),
+			c("numeric string", `pos: "7" pos`, &dslResult{7, nil}, false),
+			c("above range", `pos: 11`, nil, true),
+			c("below range", `pos: -1`, nil, true),
+			c("invalid string", `pos: "abc"`, nil, true),
+			c("bool", `on: false on`, &dslResult{false, nil}, false),
+			c("uint8", `alpha: 150 alpha`, &dslResult{uint8(150), nil}, false),
+			c("uint8 above range", `alpha: 250`, nil, true),
+			c("uint8 below range", `alpha: 5`, nil, true),
+			c("float32", `gain: 0.5 gain`, &dslResult{float32(0.5), nil}, false),
+			c("float32 above range", `gain: 2`, nil, true),
+			c("string", `label: "ok" label`, &dslResult{"ok", nil}, false),
+			c("string too long", `label: "too long"`, nil, true),
+			c("string too short", `label: ""`, nil, true),
+			c("setter error", `locked: 1`, nil, true),
+			c("destructure out of range", `a pos: { 1 20 }`, nil, true),
+			c("loop variable", `data: { 1 2 } for data[i pos] x: pos done pos`, &dslResult{2, nil}, false),
+			c("loop over constant", `data: { 1 2 } for data[i max-items] x: i done`, nil, true),
+		}
+		for _, tt := range tests {
+			dsl.restoreState()
+			t.Run(tt.name, func(t *testing.T) {
+				got, err := dsl.run(tt.script, "", nil, false)
+				testResult(t, tt.name, tt.want, tt.wantErr, got, err)
+			})
+		}
+
+		t.Run("error", func(t *testing.T) {
+			dsl.restoreState()
+			_, err := dsl.run(`pos: "abc"`, "", nil, false)
+			if err == nil || !strings.Contains(err.Error(), "cannot assign abc (string) to variable pos") {
+				t.Errorf("error = %v, want it to mention the value and variable", err)
+			}
+		})
+	})
+}
+
+func TestValidation(t *testing.T) {
+	t.Run("Validation", func(t *testing.T) {
+		createTestLanguage()
+		defer createTestLanguage()
+		identity := func(a ...any) (any, error) { return a[0], nil }
+		dsl.funcs.register("small", "", []dslParamMeta{{name: "v", typ: "int8", min: -10, max: 10}}, nil, identity)
+		dsl.funcs.register("gain", "", []dslParamMeta{{name: "v", typ: "float32", min: 0, max: 1.5}}, nil, identity)
+		dsl.funcs.register("ratio", "", []dslParamMeta{{name: "v", typ: "float64", min: 0, max: 10}}, nil, identity)
+		dsl.funcs.register("first", "", []dslParamMeta{{name: "values", typ: "[]float64", min: 0, max: 100, minLen: 1, maxLen: 3}}, nil,
+			func(a ...any) (any, error) { return a[0].([]float64)[0], nil },
+		)
+		dsl.funcs.register("label", "", []dslParamMeta{{name: "s", typ: "string", minLen: 2, maxLen: 4}}, nil, identity)
+		dsl.funcs.register("canvas", "", []dslParamMeta{{name: "w", typ: "int"}, {name: "h", typ: "int"}}, nil,
+			func(a ...any) (any, error) { return image.NewNRGBA(image.Rect(0, 0, a[0].(int), a[1].(int))), nil },
+		)
+		dsl.funcs.register("width", "", []dslParamMeta{{name: "img", typ: "*image.NRGBA", min: "2x2", max: "8x8"}}, nil,
+			func(a ...any) (any, error) { return a[0].(*image.NRGBA).Bounds().Dx(), nil },
+		)
+		dsl.funcs.register("count", "", []dslParamMeta{{name: "values", typ: "int", variadic: true, minLen: 1, maxLen: 3}}, nil,
+			func(a ...any) (any, error) { return len(castVariadic[int](a[0])), nil },
+		)
+		dsl.funcs.register("even", "", []dslParamMeta{{name: "v", typ: "int"}}, nil, identity)
+		if err := dsl.funcs.addValidator("even", "v", func(value any) error {
+			if value.(int)%2 != 0 {
+				return fmt.Errorf("%d is odd", value)
+			}
+			return nil
+		}); err != nil {
+			t.Fatalf("addValidator() error = %v", err)
+		}
+		if err := dsl.funcs.addValidator("even", "x", func(value any) error { return nil }); err == nil {
+			t.Errorf("addValidator() with an unknown parameter should fail")
+		}
+		dsl.storeState()
+
+		type TestCase struct {
+			name    string
+			script  string
+			want    *dslResult
+			wantErr bool
+		}
+		c := func(name, script string, want *dslResult, wantErr bool) TestCase {
+			return TestCase{name, script, want, wantErr}
+		}
+		tests := []TestCase{
+			c("int8", `small(-10)`, &dslResult{int8(-10), nil}, false),
+			c("int8 above range", `small(11)`, nil, true),
+			c("float32", `gain(1.5)`, &dslResult{float32(1.5), nil}, false),
+			c("float32 above range", `gain(1.6)`, nil, true),
+			c("float64 with int limits", `ratio(9.5)`, &dslResult{9.5, nil}, false),
+			c("float64 below int limit", `ratio(-0.5)`, nil, true),
+			c("slice", `first({ 1 2 3 })`, &dslResult{1.0, nil}, false),
+			c("slice too long", `first({ 1 2 3 4 })`, nil, true),
+			c("slice element out of range", `first({ 1 200 })`, nil, true),
+			c("string", `label("abcd")`, &dslResult{"abcd", nil}, false),
+			c("string too short", `label("a")`, nil, true),
+			c("string too long", `label("abcde")`, nil, true),
+			c("image", `width(canvas(8 2))`, &dslResult{8, nil}, false),
+			c("image too small", `width(canvas(8 1))`, nil, true),
+			c("image too large", `width(canvas(9 8))`, nil, true),
+			c("variadic", `count(1 2 3)`, &dslResult{3, nil}, false),
+			c("variadic too many", `count(1 2 3 4)`, nil, true),
+			c("validator", `even(4)`, &dslResult{4, nil}, false),
+			c("validator fails", `even(3)`, nil, true),
+		}
+		for _, tt := range tests {
+			dsl.restoreState()
+			t.Run(tt.name, func(t *testing.T) {
+				got, err := dsl.run(tt.script, "", nil, false)
+				testResult(t, tt.name, tt.want, tt.wantErr, got, err)
+			})
+		}
+
+		t.Run("errors", func(t *testing.T) {
+			for script, want := range map[string]string{
+				`first({ 1 200 })`:   "parameter values[1]: value 200 is out of bounds",
+				`width(canvas(1 1))`: "parameter img: size 1x1 is out of bounds (2x2 - 8x8)",
+				`even(3)`:            "parameter v: 3 is odd",
+			} {
+				dsl.restoreState()
+				_, err := dsl.run(script, "", nil, false)
+				if err == nil || !strings.Contains(err.Error(), want) {
+					t.Errorf("%s: error = %v, want it to contain %q", script, err, want)
+				}
+			}
+		})
+	})
+}
+
+func TestOptions(t *testing.T) {
+	t.Run("Options", func(t *testing.T) {
+		createTestLanguage()
+		defer createTestLanguage()
+		dsl.funcs.register("soften", "Softens a number",
+			[]dslParamMeta{
+				{name: "x", typ: "float64", def: 0.0},
+				{name: "opts", typ: "softenOptions", desc: "How to soften", fields: []dslParamMeta{
+					{name: "radius", typ: "float64", def: 1.0, min: 0, max: 10, desc: "Blur radius"},
+					{name: "edge", typ: "string", def: "clamp", values: []string{"clamp", "wrap"}},
+					{name: "passes", typ: "int"},
+				}},
+			},
+			nil,
+			func(a ...any) (any, error) {
+				return fmt.Sprintf("%v r=%v e=%v p=%v", a[0], castOption[float64](a[1], "radius"), castOption[string](a[1], "edge"), castOption[int](a[1], "passes")), nil
+			},
+		)
+		dsl.storeState()
+
+		type TestCase struct {
+			name    string
+			script  string
+			want    *dslResult
+			wantErr bool
+		}
+		c := func(name, script string, want *dslResult, wantErr bool) TestCase {
+			return TestCase{name, script, want, wantErr}
+		}
+		tests := []TestCase{
+			c("defaults", `soften(1)`, &dslResult{"1 r=1 e=clamp p=0", nil}, false),
+			c("group", `soften(1 opts=(radius=3 edge="wrap" passes=2))`, &dslResult{"1 r=3 e=wrap p=2", nil}, false),
+			c("positional group", `soften(1 (radius=2))`, &dslResult{"1 r=2 e=clamp p=0", nil}, false),
+			c("flattened", `soften(x=1 radius=3 edge=wrap)`, &dslResult{"1 r=3 e=wrap p=0", nil}, false),
+			c("group and flattened", `soften(1 opts=(radius=3) passes=4)`, &dslResult{"1 r=3 e=clamp p=4", nil}, false),
+			c("variable", `r: 5 soften(1 opts=(radius=r))`, &dslResult{"1 r=5 e=clamp p=0", nil}, false),
+			c("out of range", `soften(1 radius=11)`, nil, true),
+			c("invalid value", `soften(1 opts=(edge=mirror))`, nil, true),
+			c("unknown field", `soften(1 opts=(sigma=2))`, nil, true),
+			c("positional field", `soften(1 opts=(2))`, nil, true),
+			c("not options", `soften(1 2)`, nil, true),
+		}
+		for _, tt := range tests {
+			dsl.restoreState()
+			t.Run(tt.name, func(t *testing.T) {
+				got, err := dsl.run(tt.script, "", nil, false)
+				testResult(t, tt.name, tt.want, tt.wantErr, got, err)
+			})
+		}
+
+		t.Run("errors", func(t *testing.T) {
+			for script, want := range map[string]string{
+				`soften(1 radius=11)`:          "parameter opts.radius: value 11 is out of bounds",
+				`soften(1 opts=(sigma=2))`:     "unknown parameter: opts.sigma",
+				`soften(1 opts=(edge=mirror))`: "parameter opts.edge: mirror is not a valid choice",
+			} {
+				dsl.restoreState()
+				_, err := dsl.run(script, "", nil, false)
+				if err == nil || !strings.Contains(err.Error(), want) {
+					t.Errorf("%s: error = %v, want it to contain %q", script, err, want)
+				}
+			}
+		})
+
+		t.Run("docs", func(t *testing.T) {
+			doc := dsl.docMarkdown()
+			for _, want := range []string{"`soften(x=0 opts=())`", "| `opts.radius` | `float64` | `1` | `0` | `10` |", "| `opts.edge` |"} {
+				if !strings.Contains(doc, want) {
+					t.Errorf("docs should contain %s", want)
+				}
+			}
+		})
+	})
+}
+
+func TestExamples(t *testing.T) {
+	t.Run("Examples", func(t *testing.T) {
+		createTestLanguage()
+		for _, name := range dsl.funcs.names() {
+			for _, ex := range dsl.funcs.get(name).meta.examples {
+				t.Run(ex.expr, func(t *testing.T) {
+					dsl.restoreState()
+					got, err := dsl.run(ex.expr, "", nil, false)
+					if err != nil {
+						t.Fatalf("%s: %v", ex.expr, err)
+					}
+					if !ex.matches(got.value) {
+						t.Errorf("%s = %v (%T), want %s", ex.expr, got.value, got.value, ex.result)
+					}
+				})
+			}
+		}
+
+		t.Run("matches", func(t *testing.T) {
+			type TestCase struct {
+				name   string
+				result string
+				value  any
+				want   bool
+			}
+			c := func(name, result string, value any, want bool) TestCase {
+				return TestCase{name, result, value, want}
+			}
+			tests := []TestCase{
+				c("value", "3", 3, true),
+				c("wrong value", "4", 3, false),
+				c("quoted string", `"a-b"`, "a-b", true),
+				c("tuple", "(3 2)", Tuple{3, 2}, true),
+				c("kind", "int", 3, true),
+				c("wrong kind", "float", 3, false),
+				c("image", "image", image.NewNRGBA64(image.Rect(0, 0, 1, 1)), true),
+				c("go type", "*image.NRGBA64", image.NewNRGBA64(image.Rect(0, 0, 1, 1)), true),
+				c("short type", "NRGBA64", image.NewNRGBA64(image.Rect(0, 0, 1, 1)), true),
+				c("any result", "", nil, true),
+			}
+			for _, tt := range tests {
+				ex := dslExample{expr: tt.name, result: tt.result}
+				if got := ex.matches(tt.value); got != tt.want {
+					t.Errorf("%s: matches(%v) = %v, want %v", tt.name, tt.value, got, tt.want)
+				}
+			}
+		})
+
+		t.Run("docs", func(t *testing.T) {
+			doc := dsl.docMarkdown()
+			if !strings.Contains(doc, "`add(1 mul(2 3))` ⮕ `7`") || !strings.Contains(doc, "- `P(1 2)`\n") {
+				t.Errorf("docs should list the examples")
+			}
+			langDef, _ := dsl.GetLanguageDefinition()
+			if _, ok := langDef["snippets"].(map[string]any)["divmod example 1"]; !ok {
+				t.Errorf("snippets should contain the divmod example")
+			}
+			dsl.funcs.addExamples("join", dslExample{expr: `join("-" "\${w}" "}")`})
+			defer createTestLanguage()
+			langDef, _ = dsl.GetLanguageDefinition()
+			snippet, _ := langDef["snippets"].(map[string]any)["join example 1"].(map[string]any)
+			if want := `join("-" "\\\${w\}" "\}")`; snippet == nil || snippet["body"].([]string)[0] != want {
+				t.Errorf("snippet = %v, want the body %s", snippet, want)
+			}
+		})
+	})
+}
+
+func TestDocAnnotations(t *testing.T) {
+	t.Run("DocAnnotations", func(t *testing.T) {
+		createTestLanguage()
+		dsl.funcs.document("add", dslDocMeta{category: "Math", since: "1.1"})
+		dsl.funcs.document("mul", dslDocMeta{category: "Math", deprecated: true, deprecation: "use add instead"})
+		dsl.vars.document("pos", dslDocMeta{category: "Lists"})
+		defer createTestLanguage()
+
+		t.Run("warnings", func(t *testing.T) {
+			warnings := []string{}
+			dsl.setWarningHandler(func(msg string) { warnings = append(warnings, msg) })
+			defer dsl.setWarningHandler(printWarning)
+
+			if _, err := dsl.run(`mul(2 mul(3 4))`, "", nil, false); err != nil {
+				t.Fatalf("mul failed: %v", err)
+			}
+			if len(warnings) != 1 || warnings[0] != "function mul is deprecated: use add instead" {
+				t.Errorf("warnings = %q, want a single warning about mul", warnings)
+			}
+			if _, err := dsl.run(`add(1 2)`, "", nil, false); err != nil {
+				t.Fatalf("add failed: %v", err)
+			}
+			if len(warnings) != 1 {
+				t.Errorf("add should not be reported as deprecated")
+			}
+			if _, err := dsl.run(`mul(2 2)`, "", nil, false); err != nil {
+				t.Fatalf("mul failed: %v", err)
+			}
+			if len(warnings) != 2 {
+				t.Errorf("each run should report deprecated functions again")
+			}
+		})
+
+		t.Run("docs", func(t *testing.T) {
+			doc := dsl.docMarkdown()
+			if doc != dsl.docMarkdown() {
+				t.Errorf("docs should be deterministic")
+			}
+			functions := strings.Index(doc, "\n## Functions")
+			math := strings.Index(doc, "\n### Math")
+			if math < functions || strings.Index(doc, "`P(") > math {
+				t.Errorf("Math functions should be listed after the uncategorized ones")
+			}
+			if !strings.Contains(doc[math:], "#### `add(") || !strings.Contains(doc, "since `1.1`") {
+				t.Errorf("add should be listed under Math with its version")
+			}
+			if !strings.Contains(doc, "#### ~~`mul(") || !strings.Contains(doc, "**Deprecated**: use add instead") {
+				t.Errorf("mul should be struck through and marked deprecated")
+			}
+			if !strings.Contains(doc, "\n### Lists") {
+				t.Errorf("pos should be listed under Lists")
+			}
+		})
+	})
+}
+
+func TestAliases(t *testing.T) {
+	t.Run("Aliases", func(t *testing.T) {
+		type TestCase struct {
+			name    string
+			script  string
+			want    *dslResult
+			wantErr bool
+		}
+		c := func(name, script string, want *dslResult, wantErr bool) TestCase {
+			return TestCase{name, script, want, wantErr}
+		}
+		tests := []TestCase{
+			c("alias", `plus(1 2)`, &dslResult{3, nil}, false),
+			c("alias with named args", `plus(x=1 y=2)`, &dslResult{3, nil}, false),
+			c("qualified alias", `math.add(plus(1 2) 3)`, &dslResult{6, nil}, false),
+			c("qualified function", `img.double(4)`, &dslResult{8, nil}, false),
+			c("qualified variable", `img.radius`, &dslResult{3, nil}, false),
+			c("qualified variable as argument", `img.double(img.radius)`, &dslResult{6, nil}, false),
+			c("float is not a name", `v: -1.5 v`, &dslResult{-1.5, nil}, false),
+			c("unknown alias", `minus(1 2)`, nil, true),
+		}
+		createTestLanguage()
+		dsl.funcs.register("img.double", "Doubles a number",
+			[]dslParamMeta{{name: "x", typ: "int", def: 0}}, nil,
+			func(a ...any) (any, error) { return a[0].(int) * 2, nil },
+		)
+		dsl.funcs.alias("add", "plus", "math.add")
+		dsl.vars.register("img.radius", "int", "", "The radius", nil, nil, 3, func() any { return 3 }, nil)
+		dsl.storeState()
+		defer createTestLanguage()
+		for _, tt := range tests {
+			dsl.restoreState()
+			t.Run(tt.name, func(t *testing.T) {
+				got, err := dsl.run(tt.script, "", nil, false)
+				testResult(t, tt.name, tt.want, tt.wantErr, got, err)
+			})
+		}
+
+		t.Run("docs", func(t *testing.T) {
+			if names := strings.Join(dsl.funcs.names(), " "); strings.Contains(" "+names+" ", " plus ") {
+				t.Errorf("aliases should not be listed as functions")
+			}
+			if !strings.Contains(dsl.docMarkdown(), "Aliases: `plus`, `math.add`") {
+				t.Errorf("docs should list the aliases of add")
+			}
+		})
+
+		t.Run("restore", func(t *testing.T) {
+			dsl.funcs.register("tmp", "", nil, nil, func(a ...any) (any, error) { return 1, nil })
+			dsl.funcs.alias("tmp", "temp")
+			dsl.restoreState()
+			if dsl.funcs.get("temp") != nil || dsl.funcs.get("plus") == nil {
+				t.Errorf("restoring should only remove aliases of removed functions")
+			}
+		})
+	})
+}
+
+func TestLibrary(t *testing.T) {
+	t.Run("Library", func(t *testing.T) {
+		radius := 2
+		newLanguage := func() *Language {
+			l := New("lib", "Library", "Testing", "1.0.0", "lib")
+			err := l.RegisterFunc("scale",
+				func(a ...any) (any, error) { return a[0].(int) * a[1].(int), nil },
+				FuncMeta{
+					Desc:     "Scales a number",
+					Params:   []ParamMeta{{Name: "x", Type: "int", Default: 0}, {Name: "factor", Type: "int", Default: 2}},
+					Returns:  []ParamMeta{{Name: "result", Type: "int", Default: 0}},
+					Examples: []Example{{Expr: "scale(3)", Result: "6"}},
+					Aliases:  []string{"times"},
+					Category: "Math",
+				},
+			)
+			if err != nil {
+				t.Fatalf("RegisterFunc failed: %v", err)
+			}
+			err = l.RegisterVarFunc("radius", func() any { return radius }, func(v any) error { radius = v.(int); return nil }, VarMeta{Type: "int", Default: 2})
+			if err != nil {
+				t.Fatalf("RegisterVarFunc failed: %v", err)
+			}
+			return l
+		}
+		l := newLanguage()
+
+		type TestCase struct {
+			name    string
+			script  string
+			args    []any
+			want    any
+			wantErr bool
+		}
+		c := func(name, script string, args []any, want any, wantErr bool) TestCase {
+			return TestCase{name, script, args, want, wantErr}
+		}
+		tests := []TestCase{
+			c("function", `scale(3 4)`, nil, 12, false),
+			c("defaults", `scale(3)`, nil, 6, false),
+			c("alias", `times(x=2 factor=5)`, nil, 10, false),
+			c("variable", `scale(radius)`, nil, 4, false),
+			c("arguments", `scale($1 $2)`, []any{3, 3}, 9, false),
+			c("unknown function", `add(1 2)`, nil, nil, true),
+		}
+		for _, tt := range tests {
+			t.Run(tt.name, func(t *testing.T) {
+				got, err := l.Run(tt.script, tt.args...)
+				if (err != nil) != tt.wantErr {
+					t.Fatalf("Run(%s) error = %v, wantErr %v", tt.script, err, tt.wantErr)
+				}
+				if !tt.wantErr && got != tt.want {
+					t.Errorf("Run(%s) = %v, want %v", tt.script, got, tt.want)
+				}
+			})
+		}
+
+		t.Run("compile", func(t *testing.T) {
+			prog, err := l.Compile(`scale($1 $1)`)
+			if err != nil {
+				t.Fatalf("Compile failed: %v", err)
+			}
+			for _, n := range []int{2, 5} {
+				if got, err := prog.Run(n); err != nil || got != n*n {
+					t.Errorf("Run(%d) = %v, %v, want %d", n, got, err, n*n)
+				}
+			}
+			if _, err := l.Compile(`scale(1`); err == nil {
+				t.Errorf("Compile should fail for invalid scripts")
+			}
+		})
+
+		t.Run("isolated", func(t *testing.T) {
+			other := New("other", "Other", "", "1.0.0", "other")
+			if _, err := other.Run(`scale(1 2)`); err == nil {
+				t.Errorf("languages should not share functions")
+			}
+		})
+
+		t.Run("invalid", func(t *testing.T) {
+			fn := func(a ...any) (any, error) { return nil, nil }
+			if err := l.RegisterFunc("", fn, FuncMeta{}); err == nil {
+				t.Errorf("RegisterFunc should reject empty names")
+			}
+			meta := FuncMeta{Params: []ParamMeta{{Name: "a", Type: "int", Variadic: true}, {Name: "b", Type: "int"}}}
+			if err := l.RegisterFunc("bad", fn, meta); err == nil {
+				t.Errorf("RegisterFunc should reject variadic parameters that aren't last")
+			}
+		})
+
+		t.Run("docs", func(t *testing.T) {
+			if doc := l.Docs("markdown"); !strings.Contains(doc, "### Math") || !strings.Contains(doc, "`scale(3)` ⮕ `6`") {
+				t.Errorf("docs should list scale under Math with its example")
+			}
+			for _, ex := range l.Examples() {
+				if got, err := l.Run(ex.Expr); err != nil || !ex.Matches(got) {
+					t.Errorf("example %s = %v, %v, want %s", ex.Expr, got, err, ex.Result)
+				}
+			}
+		})
+	})
+}
+
+func TestReflection(t *testing.T) {
+	t.Run("Reflection", func(t *testing.T) {
+		type blendParams struct {
+			A       float64 `dsl:"a,desc=First value"`
+			B       float64 `dsl:"b,min=0,max=100,default=50,unit=%,desc=Second value, in percent"`
+			Mode    string  `dsl:"mode,values=mix|max,default=mix"`
+			ignored bool
+		}
+		type softenOptions struct {
+			Radius float64 `dsl:"radius,min=0,max=10,default=1"`
+			Edge   string  `dsl:"edge,values=clamp|wrap,default=clamp"`
+		}
+		type widthParams struct {
+			Img *image.NRGBA `dsl:"img,min=2x2,max=8x8"`
+			Pad []float64    `dsl:"pad,minlen=1,maxlen=2,min=0"`
+		}
+		params, err := ParamsFromTags(blendParams{})
+		if err != nil {
+			t.Fatalf("ParamsFromTags failed: %v", err)
+		}
+
+		gain := 1.5
+		version := "1.0"
+		l := New("refl", "Reflection", "Testing", "1.0.0", "refl")
+		must := func(err error) {
+			t.Helper()
+			if err != nil {
+				t.Fatalf("registration failed: %v", err)
+			}
+		}
+		must(l.RegisterFunc("scale", func(x, factor float64) float64 { return x * factor * gain },
+			Describe("Scales a number").
+				Param("x", "The number").
+				Param("factor", "The factor").Default(2).Range(0, nil).
+				Returns("res", "The scaled number").
+				Example("scale(1 3)", "4.5").
+				Category("Math").
+				Meta(),
+		))
+		must(l.RegisterFunc("blend", func(a, b float64, mode string) float64 {
+			if mode == "max" {
+				return max(a, b)
+			}
+			return a + (b-a)*0.5
+		}, FuncMeta{Desc: "Blends two values", Params: params}))
+		must(l.RegisterFunc("sum", func(xs ...int) int {
+			n := 0
+			for _, x := range xs {
+				n += x
+			}
+			return n
+		}))
+		must(l.RegisterFunc("divmod", func(a, b int) (int, int) { return a / b, a % b }))
+		must(l.RegisterFunc("inverse", func(x float64) (float64, error) {
+			if x == 0 {
+				return 0, fmt.Errorf("division by zero")
+			}
+			return 1 / x, nil
+		}))
+		must(l.RegisterFunc("canceled", func(ctx context.Context) bool { return ctx.Err() != nil }))
+		must(l.RegisterFunc("mean", func(xs []float64) float64 { return (xs[0] + xs[len(xs)-1]) / 2 },
+			Describe("Averages the first and last number").
+				Param("xs", "The numbers").Length(1, 3).Validate(func(value any) error {
+				if value.([]float64)[0] < 0 {
+					return fmt.Errorf("first number is negative")
+				}
+				return nil
+			}).
+				Meta(),
+		))
+		widthMeta, err := ParamsFromTags(widthParams{})
+		if err != nil {
+			t.Fatalf("ParamsFromTags failed: %v", err)
+		}
+		must(l.RegisterFunc("padded", func(img *image.NRGBA, pad []float64) int { return img.Bounds().Dx() + int(pad[0]) },
+			FuncMeta{Params: widthMeta},
+		))
+		must(l.RegisterFunc("soften", func(x float64, opts softenOptions) string { return fmt.Sprintf("%v %v %s", x, opts.Radius, opts.Edge) }))
+		must(l.RegisterFunc("canvas", func(w, h int) *image.NRGBA { return image.NewNRGBA(image.Rect(0, 0, w, h)) }))
+		must(l.RegisterFunc("twice", func(f func(float64) float64, x float64) float64 { return f(f(x)) }))
+		must(l.RegisterFunc("octet", func(x uint8) uint8 { return x }))
+		must(l.RegisterFunc("offset", func(x int8) int8 { return x }))
+		must(l.RegisterVar("gain", &gain, VarMeta{Desc: "Gain of scale"}))
+		must(l.RegisterVar("version", &version, VarMeta{ReadOnly: true}))
+
+		type TestCase struct {
+			name    string
+			script  string
+			want    any
+			wantErr bool
+		}
+		c := func(name, script string, want any, wantErr bool) TestCase {
+			return TestCase{name, script, want, wantErr}
+		}
+		tests := []TestCase{
+			c("derived types", `scale(2 3)`, 9.0, false),
+			c("builder default", `scale(2)`, 6.0, false),
+			c("int literal to float", `scale(x=1 factor=1)`, 1.5, false),
+			c("tags", `blend(10 30)`, 20.0, false),
+			c("tags default", `blend(a=10)`, 30.0, false),
+			c("tags values", `blend(10 30 max)`, 30.0, false),
+			c("tags invalid value", `blend(10 30 min)`, nil, true),
+			c("variadic", `sum(1 2 3)`, 6, false),
+			c("variadic empty", `sum()`, 0, false),
+			c("tuple", `divmod(7 2)`, Tuple{3, 1}, false),
+			c("error", `inverse(0)`, nil, true),
+			c("no error", `inverse(4)`, 0.25, false),
+			c("context", `canceled()`, false, false),
+			c("pointer variable", `gain: 2 scale(1 1)`, 2.0, false),
+			c("read-only variable", `version: "2.0"`, nil, true),
+			c("builder length", `mean({ 1 2 3 })`, 2.0, false),
+			c("builder length exceeded", `mean({ 1 2 3 4 })`, nil, true),
+			c("builder validator", `mean({ -1 2 })`, nil, true),
+			c("tags size", `padded(canvas(4 4) { 1 })`, 5, false),
+			c("tags size exceeded", `padded(canvas(9 4) { 1 })`, nil, true),
+			c("tags length exceeded", `padded(canvas(4 4) { 1 2 3 })`, nil, true),
+			c("tags element range", `padded(canvas(4 4) { -1 })`, nil, true),
+			c("options defaults", `soften(1)`, "1 1 clamp", false),
+			c("options flattened", `soften(1 radius=3 edge=wrap)`, "1 3 wrap", false),
+			c("options group", `soften(1 (edge=wrap))`, "1 1 wrap", false),
+			c("options out of range", `soften(1 (radius=11))`, nil, true),
+			c("callback", `twice((x) => scale(x 2) 1)`, 9.0, false),
+			c("callback reference", `twice(inverse 4)`, 4.0, false),
+			c("callback error", `twice(inverse 0)`, nil, true),
+			c("uint8", `octet(255)`, uint8(255), false),
+			c("uint8 overflow", `octet(300)`, nil, true),
+			c("uint8 negative", `octet(-1)`, nil, true),
+			c("int8 truncated", `offset(-2.5)`, int8(-2), false),
+			c("int8 overflow", `offset(128)`, nil, true),
+			c("int8 underflow", `offset(-129)`, nil, true),
+		}
+		for _, tt := range tests {
+			t.Run(tt.name, func(t *testing.T) {
+				l.RestoreState()
+				gain = 1.5
+				got, err := l.Run(tt.script)
+				if (err != nil) != tt.wantErr {
+					t.Fatalf("Run(%s) error = %v, wantErr %v", tt.script, err, tt.wantErr)
+				}
+				if !tt.wantErr && !reflect.DeepEqual(got, tt.want) {
+					t.Errorf("Run(%s) = %v (%T), want %v (%T)", tt.script, got, got, tt.want, tt.want)
+				}
+			})
+		}
+
+		t.Run("pointer variable is bound", func(t *testing.T) {
+			if _, err := l.Run(`gain: 4`); err != nil || gain != 4 {
+				t.Errorf("gain = %v, %v, want 4", gain, err)
+			}
+			gain = 0.5
+			if got, err := l.Run(`gain`); err != nil || got != 0.5 {
+				t.Errorf("gain = %v, %v, want 0.5", got, err)
+			}
+		})
+
+		t.Run("concurrent runs", func(t *testing.T) {
+			type key struct{}
+			if err := l.RegisterFunc("run", func(ctx context.Context) int { return ctx.Value(key{}).(int) }); err != nil {
+				t.Fatal(err)
+			}
+			var wg sync.WaitGroup
+			for i := 0; i < 20; i++ {
+				wg.Add(1)
+				go func() {
+					defer wg.Done()
+					got, err := l.RunContext(context.WithValue(context.Background(), key{}, i), `run()`)
+					if err != nil || got != i {
+						t.Errorf("run() = %v, %v, want %d", got, err, i)
+					}
+				}()
+			}
+			wg.Wait()
+		})
+
+		t.Run("cast out of range", func(t *testing.T) {
+			if v, err := CastAs[uint8](255.0, "uint8"); err != nil || v != 255 {
+				t.Errorf("CastAs[uint8](255.0) = %v, %v, want 255", v, err)
+			}
+			if _, err := CastAs[uint8](300, "uint8"); err == nil || !strings.Contains(err.Error(), "300 is out of the range of uint8") {
+				t.Errorf("CastAs[uint8](300) error = %v, want out of range", err)
+			}
+			if _, err := CastAs[int8](-129, "int8"); err == nil || !strings.Contains(err.Error(), "-129 is out of the range of int8") {
+				t.Errorf("CastAs[int8](-129) error = %v, want out of range", err)
+			}
+		})
+
+		t.Run("docs", func(t *testing.T) {
+			doc := l.Docs("markdown")
+			for _, want := range []string{"`scale(x=0 factor=2) ⮕ (res=0)`", "Second value, in percent", "`sum(p1...) ⮕ (result=0)`", "Length: `1..3`"} {
+				if !strings.Contains(doc, want) {
+					t.Errorf("docs should contain %s", want)
+				}
+			}
+		})
+
+		t.Run("invalid", func(t *testing.T) {
+			tests := []struct {
+				name string
+				fn   any
+				meta []FuncMeta
+			}{
+				{"not a function", 42, nil},
+				{"parameter count", func(a int) int { return a }, []FuncMeta{Describe("").Param("a", "").Param("b", "").Meta()}},
+				{"parameter type", func(a int) int { return a }, []FuncMeta{{Params: []ParamMeta{{Name: "a", Type: "string"}}}}},
+				{"default type", func(a int) int { return a }, []FuncMeta{Describe("").Param("a", "").Default("x").Meta()}},
+				{"return count", func(a int) int { return a }, []FuncMeta{Describe("").Returns("a", "").Returns("b", "").Meta()}},
+			}
+			for _, tt := range tests {
+				if err := l.RegisterFunc("bad", tt.fn, tt.meta...); err == nil {
+					t.Errorf("%s: RegisterFunc should fail", tt.name)
+				}
+			}
+			if err := l.RegisterVar("bad", gain); err == nil {
+				t.Errorf("RegisterVar should reject values that aren't pointers")
+			}
+			if _, err := ParamsFromTags(struct {
+				A int `dsl:"a,min=x"`
+			}{}); err == nil {
+				t.Errorf("ParamsFromTags should reject invalid values")
+			}
+		})
+	})
+}
+
+func TestEnums(t *testing.T) {
+	t.Run("Enums", func(t *testing.T) {
+		type TestCase struct {
+			name    string
+			script  string
+			want    *dslResult
+			wantErr bool
+		}
+		c := func(name, script string, want *dslResult, wantErr bool) TestCase {
+			return TestCase{name, script, want, wantErr}
+		}
+		tests := []TestCase{
+			c("default value", `blend()`, &dslResult{"normal 100%", nil}, false),
+			c("named bare identifier", `blend(opacity=50 mode=multiply)`, &dslResult{"multiply 50%", nil}, false),
+			c("positional bare identifier", `blend(50 screen)`, &dslResult{"screen 50%", nil}, false),
+			c("quoted value", `blend(50 "screen")`, &dslResult{"screen 50%", nil}, false),
+			c("value from variable", `m: "multiply" blend(20 m)`, &dslResult{"multiply 20%", nil}, false),
+			c("variable shadows value", `screen: "multiply" blend(20 screen)`, &dslResult{"multiply 20%", nil}, false),
+			c("invalid named value", `blend(mode=overlay)`, nil, true),
+			c("invalid positional value", `blend(50 overlay)`, nil, true),
+			c("invalid quoted value", `blend(50 "overlay")`, nil, true),
+		}
+		createTestLanguage()
+		for _, tt := range tests {
+			dsl.restoreState()
+			t.Run(tt.name, func(t *testing.T) {
+				got, err := dsl.run(tt.script, "", nil, false)
+				testResult(t, tt.name, tt.want, tt.wantErr, got, err)
+			})
+		}
+
+		t.Run("error lists choices", func(t *testing.T) {
+			dsl.restoreState()
+			_, err := dsl.run(`blend(mode=overlay)`, "", nil, false)
+			if err == nil || !strings.Contains(err.Error(), "normal, multiply, screen") {
+				t.Errorf("error = %v, want it to list the choices", err)
+			}
+			_, err = dsl.run(`blend(50 overlay)`, "", nil, false)
+			if err == nil || !strings.Contains(err.Error(), "normal, multiply, screen") {
+				t.Errorf("positional error = %v, want it to list the choices", err)
+			}
+		})
+
+		t.Run("completion", func(t *testing.T) {
+			c := &paramCompleter{funcValues: map[string]map[string][]string{"blend": {"mode": {"normal", "multiply", "screen"}}}}
+			got, length, ok := c.completeValue("x: blend(50 mode=mu")
+			if !ok || length != 2 || len(got) != 1 || string(got[0]) != "ltiply" {
+				t.Errorf("completeValue() = %q, %d, %v, want [ltiply], 2, true", got, length, ok)
+			}
+		})
+	})
+}
+
+func TestContext(t *testing.T) {
+	t.Run("Context", func(t *testing.T) {
+		createTestLanguage()
+
+		t.Run("progress", func(t *testing.T) {
+			dsl.restoreState()
+			reports := []string{}
+			dsl.setProgressHandler(func(fn string, done, total float64) {
+				reports = append(reports, fmt.Sprintf("%s %v/%v", fn, done, total))
+			})
+			defer dsl.setProgressHandler(nil)
+			got, err := dsl.run(`steps(2)`, "", nil, false)
+			testResult(t, "progress", &dslResult{2, nil}, false, got, err)
+			if want := []string{"steps 1/2", "steps 2/2"}; !reflect.DeepEqual(reports, want) {
+				t.Errorf("progress reports = %v, want %v", reports, want)
+			}
+		})
+
+		t.Run("canceled", func(t *testing.T) {
+			dsl.restoreState()
+			ctx, cancel := context.WithCancel(context.Background())
+			cancel()
+			_, err := dsl.runContext(ctx, `steps(2)`, "", nil, false)
+			if err != context.Canceled {
+				t.Errorf("runContext() error = %v, want %v", err, context.Canceled)
+			}
+		})
+
+		t.Run("background", func(t *testing.T) {
+			dsl.restoreState()
+			got, err := dsl.run(`steps(3)`, "", nil, false)
+			testResult(t, "background", &dslResult{3, nil}, false, got, err)
+		})
 	})
 }
 
@@ -1,22 +1,144 @@
-package main
+package parser
 
-import "reflect"
+import (
+	"fmt"
+	"image"
+	"image/color"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+)
 
 type dslFnMeta struct {
-	name    string
-	desc    string
-	params  []dslParamMeta
-	returns []dslParamMeta
+	name     string
+	desc     string
+	params   []dslParamMeta
+	returns  []dslParamMeta
+	examples []dslExample
+	doc      dslDocMeta
+	aliases  []string // other names the function can be called by
+}
+
+// dslDocMeta holds the annotations of functions and variables that only
+// affect the documentation and the warnings shown when they are used.
+type dslDocMeta struct {
+	category    string // groups the function or variable in docs, help and completion
+	since       string // version that introduced it
+	deprecated  bool
+	deprecation string // what to use instead, e.g. "use blur instead"
+}
+
+// groupByCategory groups names by the category returned for them. Categories and
+// the names in each category are sorted, names without a category come first.
+func groupByCategory(names []string, category func(name string) string) (categories []string, groups map[string][]string) {
+	groups = map[string][]string{}
+	for _, name := range names {
+		c := category(name)
+		if _, ok := groups[c]; !ok {
+			categories = append(categories, c)
+		}
+		groups[c] = append(groups[c], name)
+	}
+	sort.Strings(categories)
+	for _, c := range categories {
+		sort.Strings(groups[c])
+	}
+	return categories, groups
+}
+
+// warning returns the message shown when a deprecated function or variable is used.
+func (d *dslDocMeta) warning(kind, name string) string {
+	msg := fmt.Sprintf("%s %s is deprecated", kind, name)
+	if d.deprecation != "" {
+		msg += ": " + d.deprecation
+	}
+	return msg
+}
+
+// dslExample is a usage example of a function, e.g. `blur(img radius=3) => image`.
+type dslExample struct {
+	expr   string // the script to run
+	result string // the expected value or type of the result, empty if any result is fine
+}
+
+// Expr returns the script of the example, it's used by the templates.
+func (ex dslExample) Expr() string { return ex.expr }
+
+// Result returns the expected result of the example, it's used by the templates.
+func (ex dslExample) Result() string { return ex.result }
+
+// matches returns true if value is the expected result of the example.
+// The expected result can be the value itself (`add(1 2) => 3`), its Go type
+// (`*image.NRGBA`, `NRGBA`) or one of the kinds image, color, int, float,
+// string, bool, slice, map and tuple.
+func (ex *dslExample) matches(value any) bool {
+	want := strings.TrimSpace(ex.result)
+	if want == "" {
+		return true
+	}
+	got := fmt.Sprint(value)
+	switch v := value.(type) {
+	case Tuple:
+		got = v.String()
+	case Map:
+		got = v.String()
+	case string:
+		if want == strconv.Quote(v) {
+			return true
+		}
+	}
+	if want == got {
+		return true
+	}
+
+	typ := fmt.Sprintf("%T", value)
+	if want == typ || want == strings.TrimPrefix(typ, "*") || want == typ[strings.LastIndex(typ, ".")+1:] {
+		return true
+	}
+	switch strings.ToLower(want) {
+	case "image":
+		_, ok := value.(image.Image)
+		return ok
+	case "color":
+		_, ok := value.(color.Color)
+		return ok
+	case "tuple":
+		_, ok := value.(Tuple)
+		return ok
+	}
+	switch reflect.ValueOf(value).Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return want == "int"
+	case reflect.Float32, reflect.Float64:
+		return want == "float"
+	case reflect.String:
+		return want == "string"
+	case reflect.Bool:
+		return want == "bool"
+	case reflect.Slice:
+		return want == "slice"
+	case reflect.Map:
+		return want == "map"
+	}
+	return false
 }
 
 type dslParamMeta struct {
-	name string
-	typ  string
-	min  any
-	max  any
-	def  any
-	unit string
-	desc string
+	name       string
+	typ        string
+	min        any // minimum value, of the elements for slices or "WxH" for images
+	max        any // maximum value, of the elements for slices or "WxH" for images
+	minLen     any // minimum length of slices and strings
+	maxLen     any // maximum length of slices and strings
+	def        any
+	unit       string
+	desc       string
+	variadic   bool                    // collects all remaining positional arguments, typ is the element type
+	values     []string                // allowed values, scripts can pass them as bare identifiers
+	validators []func(value any) error // custom checks, see dslFnRegistry.addValidator
+	fields     []dslParamMeta          // fields of a struct parameter, passed as Options
 }
 
 type dslFnType struct {
@@ -24,6 +146,82 @@ type dslFnType struct {
 	data func(...any) (any, error)
 }
 
+// optionsParam returns the index of the struct parameter that has a field
+// with the given name, or -1 if there is none.
+func (meta *dslFnMeta) optionsParam(field string) int {
+	for i := range meta.params {
+		if meta.params[i].field(field) != nil {
+			return i
+		}
+	}
+	return -1
+}
+
+// dslDocParam is a parameter as listed in the docs, see dslFnMeta.docParams.
+type dslDocParam struct {
+	dslParamMeta
+	field bool // whether it's the field of a struct parameter
+}
+
+// docParams returns the parameters for the docs, struct parameters are
+// followed by their fields, named like `opts.radius`.
+func (meta *dslFnMeta) docParams() []dslDocParam {
+	params := []dslDocParam{}
+	for _, param := range meta.params {
+		if len(param.fields) > 0 && param.def == nil {
+			param.def = Options{}
+		}
+		params = append(params, dslDocParam{dslParamMeta: param})
+		for _, f := range param.fields {
+			f.name = param.name + "." + f.name
+			params = append(params, dslDocParam{dslParamMeta: f, field: true})
+		}
+	}
+	return params
+}
+
+// positionalParam returns the parameter receiving the i-th positional argument,
+// or nil if there is none.
+func (meta *dslFnMeta) positionalParam(i int) *dslParamMeta {
+	last := len(meta.params) - 1
+	if last >= 0 && i >= last && meta.params[last].variadic {
+		return &meta.params[last]
+	}
+	if i > last {
+		return nil
+	}
+	return &meta.params[i]
+}
+
+// defaults returns the arguments of a call before any are given: the
+// default of every parameter, variadic parameters start empty.
+func (meta *dslFnMeta) defaults() []any {
+	args := make([]any, len(meta.params))
+	for i, param := range meta.params {
+		if !param.variadic {
+			args[i] = param.def
+		}
+	}
+	return args
+}
+
+// fill sets the positional arguments of a call of the function name,
+// a trailing variadic parameter collects the rest.
+func (meta *dslFnMeta) fill(name string, ordered, args []any) error {
+	last := len(meta.params) - 1
+	for i, arg := range args {
+		if last >= 0 && i >= last && meta.params[last].variadic {
+			ordered[last] = args[last:]
+			break
+		}
+		if i >= len(ordered) {
+			return errors.PSR_PARAM_TOO_MANY(name)
+		}
+		ordered[i] = arg
+	}
+	return nil
+}
+
 func (fn *dslFnType) validate(args ...any) error {
 	if len(args) != len(fn.meta.params) {
 		if len(args) < len(fn.meta.params) {
@@ -34,85 +232,226 @@ func (fn *dslFnType) validate(args ...any) error {
 	}
 
 	for i, param := range fn.meta.params {
-		arg := args[i]
-		switch param.typ {
-		case "int":
-			val, ok := arg.(int)
-			if !ok {
-				return errors.REG_VALIDATION_WRONG_TYPE("parameter", param.name, "int", arg)
-			}
-			if min, ok := param.min.(int); ok && val < min {
-				return errors.REG_VALIDATION_OUT_OF_BOUNDS("parameter", param.name, param.min, param.max, val)
-			}
-			if max, ok := param.max.(int); ok && val > max {
-				return errors.REG_VALIDATION_OUT_OF_BOUNDS("parameter", param.name, param.min, param.max, val)
-			}
-		case "float":
-			val, ok := arg.(float64)
-			if !ok {
-				return errors.REG_VALIDATION_WRONG_TYPE("parameter", param.name, "float64", arg)
+		if param.variadic {
+			// the length limits the number of values passed to a variadic parameter
+			values, _ := args[i].([]any)
+			if err := validateLimits("parameter", param.name, nil, nil, param.minLen, param.maxLen, values); err != nil {
+				return err
 			}
-			if min, ok := param.min.(float64); ok && val < min {
-				return errors.REG_VALIDATION_OUT_OF_BOUNDS("parameter", param.name, param.min, param.max, val)
-			}
-			if max, ok := param.max.(float64); ok && val > max {
-				return errors.REG_VALIDATION_OUT_OF_BOUNDS("parameter", param.name, param.min, param.max, val)
-			}
-		case "bool":
-			_, ok := arg.(bool)
-			if !ok {
-				return errors.REG_VALIDATION_WRONG_TYPE("parameter", param.name, "bool", arg)
-			}
-		case "string":
-			val, ok := arg.(string)
-			if !ok {
-				return errors.REG_VALIDATION_WRONG_TYPE("parameter", param.name, "string", arg)
-			}
-			if min, ok := param.min.(int); ok && len(val) < min {
-				return errors.REG_VALIDATION_OUT_OF_BOUNDS_LENGTH("parameter", param.name, param.min, param.max, val)
+			for _, v := range values {
+				if err := param.validate(v); err != nil {
+					return err
+				}
 			}
-			if max, ok := param.max.(int); ok && len(val) > max {
-				return errors.REG_VALIDATION_OUT_OF_BOUNDS_LENGTH("parameter", param.name, param.min, param.max, val)
+			continue
+		}
+		if err := param.validate(args[i]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// validate checks an argument that has been converted to the parameter type
+// against the limits of the parameter (see validateLimits), its allowed values
+// and its custom validators.
+func (param *dslParamMeta) validate(arg any) error {
+	if opts, ok := arg.(Options); ok {
+		for _, f := range param.fields {
+			if v, ok := opts[f.name]; ok {
+				f.name = param.name + "." + f.name
+				if err := f.validate(v); err != nil {
+					return err
+				}
 			}
+		}
+	}
+	if err := validateLimits("parameter", param.name, param.min, param.max, param.minLen, param.maxLen, arg); err != nil {
+		return err
+	}
+	if len(param.values) > 0 && !param.allows(fmt.Sprint(arg)) {
+		return errors.REG_VALIDATION_NOT_ALLOWED("parameter", param.name, param.values, arg)
+	}
+	for _, validator := range param.validators {
+		if err := validator(arg); err != nil {
+			return errors.REG_VALIDATION_FAILED("parameter", param.name, err)
+		}
+	}
+	return nil
+}
 
+// field returns the field of a struct parameter with the given name,
+// or nil if there is none.
+func (param *dslParamMeta) field(name string) *dslParamMeta {
+	for i := range param.fields {
+		if param.fields[i].name == name {
+			return &param.fields[i]
 		}
 	}
 	return nil
 }
 
-func (f *dslFnType) call(vars *dslVarRegistry, args ...any) (any, error) {
+// options converts the argument of a struct parameter to Options. Fields that
+// aren't set take their default, the others are converted to the field type.
+func (param *dslParamMeta) options(vars *dslVarRegistry, arg any) (Options, error) {
+	opts := Options{}
+	for _, f := range param.fields {
+		if f.def != nil {
+			opts[f.name] = f.def
+		}
+	}
+	switch v := vars.resolve(arg).(type) {
+	case nil:
+	case Options:
+		for name, value := range v {
+			if param.field(name) == nil {
+				return nil, errors.PSR_PARAM_UNKNOWN(param.name + "." + name)
+			}
+			opts[name] = value
+		}
+	default:
+		return nil, errors.PSR_OPTIONS_WRONG_TYPE(param.name, v)
+	}
+	for _, f := range param.fields {
+		v, ok := opts[f.name]
+		if !ok || f.typ == "" || f.typ == "any" {
+			continue
+		}
+		converted, err := f.cast(vars.resolve(v))
+		if err != nil {
+			return nil, err
+		}
+		opts[f.name] = converted
+	}
+	return opts, nil
+}
+
+// length returns the length limits of the parameter, e.g. "1..10" or "1..",
+// or an empty string if the length isn't limited.
+func (param *dslParamMeta) length() string {
+	if param.minLen == nil && param.maxLen == nil {
+		return ""
+	}
+	res := ".."
+	if param.minLen != nil {
+		res = fmt.Sprint(param.minLen) + res
+	}
+	if param.maxLen != nil {
+		res += fmt.Sprint(param.maxLen)
+	}
+	return res
+}
+
+// bounds returns the value limits of the parameter like length, e.g.
+// "1..4096" or "0..", or an empty string if the value isn't limited.
+func (param *dslParamMeta) bounds() string {
+	if param.min == nil && param.max == nil {
+		return ""
+	}
+	res := ".."
+	if param.min != nil {
+		res = fmt.Sprint(param.min) + res
+	}
+	if param.max != nil {
+		res += fmt.Sprint(param.max)
+	}
+	return res
+}
+
+// allows returns true if the parameter has no restrictions on its values
+// or if value is one of the allowed values.
+func (param *dslParamMeta) allows(value string) bool {
+	if len(param.values) == 0 {
+		return true
+	}
+	for _, v := range param.values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
+
+// spread flattens the values collected for a variadic parameter.
+// Slices are expanded into their elements so that `sum({1 2 3})`
+// behaves the same as `sum(1 2 3)`.
+func (param *dslParamMeta) spread(vars *dslVarRegistry, value any) []any {
+	var values []any
+	switch v := value.(type) {
+	case nil:
+		return []any{}
+	case []any:
+		values = v
+	default:
+		values = []any{v}
+	}
+
+	res := make([]any, 0, len(values))
+	for _, v := range values {
+		v = vars.resolve(v)
+		rv := reflect.ValueOf(v)
+		if rv.Kind() == reflect.Slice && !strings.HasPrefix(param.typ, "[]") {
+			for i := 0; i < rv.Len(); i++ {
+				res = append(res, rv.Index(i).Interface())
+			}
+			continue
+		}
+		res = append(res, v)
+	}
+	return res
+}
+
+// cast converts the argument to the parameter type.
+func (param *dslParamMeta) cast(arg any) (any, error) {
+	if param.typ == "" || param.typ == "any" {
+		return arg, nil
+	}
+	// Check if types already match exactly before casting
+	argType := reflect.TypeOf(arg)
+	if argType != nil && argType.String() == param.typ {
+		// Types match exactly, no conversion needed
+		return arg, nil
+	}
+	return dsl.castInRange(arg, param.typ)
+}
+
+func (f *dslFnType) call(vars *dslVarRegistry, args ...any) (res any, err error) {
 	// Make a copy of args to avoid modifying the original
 	callArgs := make([]any, len(args))
 	copy(callArgs, args)
 
 	// Handle variable references and type conversions
 	for i, arg := range callArgs {
-		if str, ok := arg.(string); ok {
-			// Check if it's a variable reference
-			if vars.has(str) {
-				// Get the variable value in a thread-safe way
-				varVal := vars.get(str)
-				if varVal != nil {
-					callArgs[i] = varVal.get()
+		param := f.meta.params[i]
+		if param.variadic {
+			values := param.spread(vars, arg)
+			for j, v := range values {
+				converted, err := param.cast(v)
+				if err != nil {
+					return nil, err
 				}
+				values[j] = converted
 			}
+			callArgs[i] = values
+			continue
 		}
 
-		// Handle type conversions
-		if f.meta.params[i].typ != "" && f.meta.params[i].typ != "any" {
-			// Check if types already match exactly before casting
-			argType := reflect.TypeOf(callArgs[i])
-			if argType != nil && argType.String() == f.meta.params[i].typ {
-				// Types match exactly, no conversion needed
-				continue
+		if len(param.fields) > 0 {
+			opts, err := param.options(vars, arg)
+			if err != nil {
+				return nil, err
 			}
-			converted, err := dsl.cast(callArgs[i], f.meta.params[i].typ)
+			callArgs[i] = opts
+			continue
+		}
+
+		// Handle type conversions
+		if param.typ != "" && param.typ != "any" {
+			converted, err := param.cast(vars.resolve(arg))
 			if err != nil {
 				return nil, err
 			}
 			callArgs[i] = converted
-		} else {
-			callArgs[i] = arg
 		}
 	}
 
@@ -121,6 +460,16 @@ func (f *dslFnType) call(vars *dslVarRegistry, args ...any) (any, error) {
 		return nil, err
 	}
 
-	// Call the function
+	// Call the function, function values passed as callbacks without an
+	// error result report their errors by panicking, see Func.as
+	defer func() {
+		if r := recover(); r != nil {
+			fe, ok := r.(dslFuncError)
+			if !ok {
+				panic(r)
+			}
+			res, err = nil, fe.err
+		}
+	}()
 	return f.data(callArgs...)
 }
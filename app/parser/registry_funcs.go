@@ -1,4 +1,4 @@
-package main
+package parser
 
 import (
 	"sort"
@@ -6,9 +6,10 @@ import (
 )
 
 type dslFnRegistry struct {
-	mu    *sync.Mutex
-	data  map[string]*dslFnType
-	state *dslRegistryState
+	mu      *sync.Mutex
+	data    map[string]*dslFnType
+	aliases map[string]string // maps aliases to the names of the functions
+	state   *dslRegistryState
 }
 
 func (r *dslFnRegistry) storeState() {
@@ -24,6 +25,11 @@ func (r *dslFnRegistry) restoreState() {
 	for _, name := range toRemove {
 		delete(r.data, name)
 	}
+	for alias, name := range r.aliases {
+		if _, ok := r.data[name]; !ok {
+			delete(r.aliases, alias)
+		}
+	}
 	r.state.reset()
 }
 
@@ -44,10 +50,68 @@ func (r *dslFnRegistry) register(name, description string, parameters []dslParam
 	}
 }
 
+// addValidator adds a custom check to a parameter of the function with the
+// given name. validator receives the argument converted to the parameter type,
+// its error is reported to the script.
+func (r *dslFnRegistry) addValidator(name, param string, validator func(value any) error) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	fn, ok := r.data[name]
+	if !ok {
+		return errors.REG_INVALID("validator", name+"."+param, "unknown function")
+	}
+	for i := range fn.meta.params {
+		if fn.meta.params[i].name == param {
+			fn.meta.params[i].validators = append(fn.meta.params[i].validators, validator)
+			return nil
+		}
+	}
+	return errors.REG_INVALID("validator", name+"."+param, "unknown parameter")
+}
+
+// addExamples adds usage examples to the function with the given name.
+func (r *dslFnRegistry) addExamples(name string, examples ...dslExample) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if fn, ok := r.data[name]; ok {
+		fn.meta.examples = append(fn.meta.examples, examples...)
+	}
+}
+
+// document sets the category, version and deprecation of the function with the given name.
+func (r *dslFnRegistry) document(name string, doc dslDocMeta) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if fn, ok := r.data[name]; ok {
+		fn.meta.doc = doc
+	}
+}
+
+// alias makes the function with the given name callable by the aliases as well.
+func (r *dslFnRegistry) alias(name string, aliases ...string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	fn, ok := r.data[name]
+	if !ok {
+		return
+	}
+	if r.aliases == nil {
+		r.aliases = map[string]string{}
+	}
+	for _, alias := range aliases {
+		r.aliases[alias] = name
+		fn.meta.aliases = append(fn.meta.aliases, alias)
+	}
+}
+
+// get returns the function with the given name or alias, or nil if there is none.
 func (r *dslFnRegistry) get(name string) *dslFnType {
 	r.mu.Lock()
 	defer r.mu.Unlock()
 	fn, ok := r.data[name]
+	if !ok && r.aliases[name] != "" {
+		fn, ok = r.data[r.aliases[name]]
+	}
 
 	if !ok {
 		return nil
@@ -65,3 +129,14 @@ func (r *dslFnRegistry) names() []string {
 	sort.Strings(names)
 	return names
 }
+
+// byCategory returns the sorted categories and the sorted names of the functions in each of them.
+func (r *dslFnRegistry) byCategory() (categories []string, groups map[string][]string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	names := make([]string, 0, len(r.data))
+	for name := range r.data {
+		names = append(names, name)
+	}
+	return groupByCategory(names, func(name string) string { return r.data[name].meta.doc.category })
+}
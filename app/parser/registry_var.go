@@ -1,13 +1,17 @@
-package main
+package parser
+
+import "reflect"
 
 type dslMetaVar struct {
-	name string
-	typ  string
-	min  any
-	max  any
-	def  any
-	unit string
-	desc string
+	name     string
+	typ      string
+	min      any
+	max      any
+	def      any
+	unit     string
+	desc     string
+	readOnly bool // constants can be read but not assigned by scripts
+	doc      dslDocMeta
 }
 
 type dslMetaVarType struct {
@@ -17,46 +21,22 @@ type dslMetaVarType struct {
 	set  func(any) error
 }
 
+// cast converts a value assigned by a script to the type of the variable.
+func (v *dslMetaVarType) cast(value any) (any, error) {
+	if v.meta.typ == "" || v.meta.typ == "any" || value == nil {
+		return value, nil
+	}
+	if reflect.TypeOf(value).String() == v.meta.typ {
+		return value, nil
+	}
+	return dsl.castInRange(value, v.meta.typ)
+}
+
+// validate checks the type of the value and that it's within the limits of
+// the variable, see validateLimits.
 func (v *dslMetaVarType) validate(value any) error {
-	switch v.meta.typ {
-	case "int":
-		val, ok := value.(int)
-		if !ok {
-			return errors.REG_VALIDATION_WRONG_TYPE("variable", v.meta.name, "int", value)
-		}
-		if v.meta.min != nil && val < v.meta.min.(int) {
-			return errors.REG_VALIDATION_OUT_OF_BOUNDS("variable", v.meta.name, v.meta.min, v.meta.max, val)
-		}
-		if v.meta.max != nil && val > v.meta.max.(int) {
-			return errors.REG_VALIDATION_OUT_OF_BOUNDS("variable", v.meta.name, v.meta.min, v.meta.max, val)
-		}
-	case "float":
-		val, ok := value.(float64)
-		if !ok {
-			return errors.REG_VALIDATION_WRONG_TYPE("variable", v.meta.name, "float64", value)
-		}
-		if v.meta.min != nil && val < v.meta.min.(float64) {
-			return errors.REG_VALIDATION_OUT_OF_BOUNDS("variable", v.meta.name, v.meta.min, v.meta.max, val)
-		}
-		if v.meta.max != nil && val > v.meta.max.(float64) {
-			return errors.REG_VALIDATION_OUT_OF_BOUNDS("variable", v.meta.name, v.meta.min, v.meta.max, val)
-		}
-	case "bool":
-		_, ok := value.(bool)
-		if !ok {
-			return errors.REG_VALIDATION_WRONG_TYPE("variable", v.meta.name, "bool", value)
-		}
-	case "string":
-		val, ok := value.(string)
-		if !ok {
-			return errors.REG_VALIDATION_WRONG_TYPE("variable", v.meta.name, "string", value)
-		}
-		if v.meta.min != nil && len(val) < v.meta.min.(int) {
-			return errors.REG_VALIDATION_OUT_OF_BOUNDS_LENGTH("variable", v.meta.name, v.meta.min, v.meta.max, val)
-		}
-		if v.meta.max != nil && len(val) > v.meta.max.(int) {
-			return errors.REG_VALIDATION_OUT_OF_BOUNDS_LENGTH("variable", v.meta.name, v.meta.min, v.meta.max, val)
-		}
+	if v.meta.typ != "" && v.meta.typ != "any" && value != nil && reflect.TypeOf(value).String() != v.meta.typ {
+		return errors.REG_VALIDATION_WRONG_TYPE("variable", v.meta.name, v.meta.typ, value)
 	}
-	return nil
+	return validateLimits("variable", v.meta.name, v.meta.min, v.meta.max, nil, nil, value)
 }
@@ -1,4 +1,4 @@
-package main
+package parser
 
 import (
 	"fmt"
@@ -35,37 +35,59 @@ func (r *dslVarRegistry) restoreState() {
 	r.state.reset()
 }
 
-func (r *dslVarRegistry) register(name, typ, unit, description string, min, max, def any, fnGet func() any, fnSet func(any)) {
+// register adds a variable to the registry.
+// Variables without a setter (fnSet is nil) are read-only constants.
+// Values are converted to typ and validated before fnSet is called.
+func (r *dslVarRegistry) register(name, typ, unit, description string, min, max, def any, fnGet func() any, fnSet func(any) error) {
 	r.mu.Lock()
 	defer r.mu.Unlock()
 	r.state.add(name, def)
 	// Create a local copy of the variable for the closure
 	varRef := &dslMetaVarType{
 		meta: dslMetaVar{
-			name: name,
-			desc: description,
-			typ:  typ,
-			min:  min,
-			max:  max,
-			def:  def,
-			unit: unit,
+			name:     name,
+			desc:     description,
+			typ:      typ,
+			min:      min,
+			max:      max,
+			def:      def,
+			unit:     unit,
+			readOnly: fnSet == nil,
 		},
 		get: fnGet,
 	}
 
 	// Set up Set method without nested locking
 	varRef.set = func(a any) error {
+		if varRef.meta.readOnly {
+			return errors.REG_VAR_READ_ONLY(name)
+		}
+		converted, err := varRef.cast(a)
+		if err != nil {
+			return errors.REG_VAR_ASSIGN(name, a, err)
+		}
 		// Validate without acquiring the lock
-		if err := varRef.validate(a); err != nil {
+		if err := varRef.validate(converted); err != nil {
 			return err
 		}
-		fnSet(a)
+		if err := fnSet(converted); err != nil {
+			return errors.REG_VAR_ASSIGN(name, a, err)
+		}
 		return nil
 	}
 
 	r.data[name] = varRef
 }
 
+// document sets the category, version and deprecation of the variable with the given name.
+func (r *dslVarRegistry) document(name string, doc dslDocMeta) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if v, ok := r.data[name]; ok {
+		v.meta.doc = doc
+	}
+}
+
 func (r *dslVarRegistry) has(name string) bool {
 	r.mu.Lock()
 	_, exists := r.data[name]
@@ -79,6 +101,19 @@ func (r *dslVarRegistry) get(name string) *dslMetaVarType {
 	return r.data[name]
 }
 
+// resolve returns the value of the variable if arg is the name of one,
+// otherwise arg is returned unchanged.
+func (r *dslVarRegistry) resolve(arg any) any {
+	str, ok := arg.(string)
+	if !ok || !r.has(str) {
+		return arg
+	}
+	if v := r.get(str); v != nil {
+		return v.get()
+	}
+	return arg
+}
+
 func (r *dslVarRegistry) set(name string, value any) error {
 	r.mu.Lock()
 	defer r.mu.Unlock()
@@ -114,3 +149,14 @@ func (r *dslVarRegistry) names() []string {
 	sort.Strings(names)
 	return names
 }
+
+// byCategory returns the sorted categories and the sorted names of the variables in each of them.
+func (r *dslVarRegistry) byCategory() (categories []string, groups map[string][]string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	names := make([]string, 0, len(r.data))
+	for name := range r.data {
+		names = append(names, name)
+	}
+	return groupByCategory(names, func(name string) string { return r.data[name].meta.doc.category })
+}
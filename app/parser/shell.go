@@ -1,4 +1,4 @@
-package main
+package parser
 
 import (
 	"bytes"
@@ -17,10 +17,45 @@ import (
 
 type paramCompleter struct {
 	prefixCompleter readline.PrefixCompleterInterface
-	funcParams      map[string][]string // Maps function names to their parameter lists
+	funcParams      map[string][]string            // Maps function names to their parameter lists
+	funcValues      map[string]map[string][]string // Maps function names to the allowed values of their parameters
+}
+
+// completeValue completes the value of a named argument with a list of allowed values,
+// i.e. `blend(mode=mu` completes to `blend(mode=multiply`.
+func (c *paramCompleter) completeValue(line string) ([][]rune, int, bool) {
+	start := strings.LastIndexAny(line, "( ")
+	if start < 0 {
+		return nil, 0, false
+	}
+	name, prefix, ok := strings.Cut(line[start+1:], "=")
+	if !ok {
+		return nil, 0, false
+	}
+	funcName := line[:strings.LastIndex(line, "(")]
+	if i := strings.LastIndexAny(funcName, "( "); i >= 0 {
+		funcName = funcName[i+1:]
+	}
+	values, exists := c.funcValues[funcName][name]
+	if !exists {
+		return nil, 0, false
+	}
+	var completions [][]rune
+	for _, v := range values {
+		if strings.HasPrefix(v, prefix) {
+			completions = append(completions, []rune(v[len(prefix):]))
+		}
+	}
+	return completions, len([]rune(prefix)), true
 }
 
 func (c *paramCompleter) Do(line []rune, pos int) ([][]rune, int) {
+	if strings.Contains(string(line[:pos]), "(") {
+		if completions, length, ok := c.completeValue(string(line[:pos])); ok {
+			return completions, length
+		}
+	}
+
 	// Get the original completions
 	completions, length := c.prefixCompleter.Do(line, pos)
 
@@ -108,22 +143,35 @@ func (dsl *dslCollection) shell() {
 	debugMode := false
 
 	// Create template data
+	type shellParam struct {
+		Name     string
+		Type     string
+		Default  any
+		Variadic bool
+	}
+	type shellVar struct {
+		Name        string
+		Description string
+		Deprecated  bool
+	}
+	type shellFunc struct {
+		Name        string
+		Description string
+		Deprecated  bool
+		Params      []shellParam
+	}
 	type templateData struct {
 		Name      string
 		Version   string
 		Variables []struct {
-			Name        string
-			Description string
+			Category  string
+			Variables []shellVar
 		}
 		Functions []struct {
-			Name        string
-			Description string
-			Params      []struct {
-				Name    string
-				Type    string
-				Default any
-			}
+			Category  string
+			Functions []shellFunc
 		}
+		Examples []dslExample
 	}
 
 	data := templateData{
@@ -131,45 +179,60 @@ func (dsl *dslCollection) shell() {
 		Version: dsl.version,
 	}
 
-	// Add variables
-	for name, v := range dsl.vars.data {
-		data.Variables = append(data.Variables, struct {
-			Name        string
-			Description string
-		}{
-			Name:        name,
-			Description: v.meta.desc,
-		})
+	// Show the first example of each function, up to 10 in total
+	for _, name := range dsl.funcs.names() {
+		if fn := dsl.funcs.get(name); fn != nil && len(fn.meta.examples) > 0 && len(data.Examples) < 10 {
+			data.Examples = append(data.Examples, fn.meta.examples[0])
+		}
 	}
 
-	// Add functions
-	for name, fn := range dsl.funcs.data {
-		funcData := struct {
-			Name        string
-			Description string
-			Params      []struct {
-				Name    string
-				Type    string
-				Default any
+	// Add variables
+	categories, groups := dsl.vars.byCategory()
+	for _, category := range categories {
+		group := struct {
+			Category  string
+			Variables []shellVar
+		}{Category: category}
+		for _, name := range groups[category] {
+			if v := dsl.vars.get(name); v != nil {
+				group.Variables = append(group.Variables, shellVar{
+					Name:        name,
+					Description: v.meta.desc,
+					Deprecated:  v.meta.doc.deprecated,
+				})
 			}
-		}{
-			Name:        name,
-			Description: fn.meta.desc,
 		}
+		data.Variables = append(data.Variables, group)
+	}
 
-		for _, param := range fn.meta.params {
-			funcData.Params = append(funcData.Params, struct {
-				Name    string
-				Type    string
-				Default any
-			}{
-				Name:    param.name,
-				Type:    param.typ,
-				Default: param.def,
-			})
+	// Add functions
+	categories, groups = dsl.funcs.byCategory()
+	for _, category := range categories {
+		group := struct {
+			Category  string
+			Functions []shellFunc
+		}{Category: category}
+		for _, name := range groups[category] {
+			fn := dsl.funcs.get(name)
+			if fn == nil {
+				continue
+			}
+			funcData := shellFunc{
+				Name:        name,
+				Description: fn.meta.desc,
+				Deprecated:  fn.meta.doc.deprecated,
+			}
+			for _, param := range fn.meta.params {
+				funcData.Params = append(funcData.Params, shellParam{
+					Name:     param.name,
+					Type:     param.typ,
+					Default:  param.def,
+					Variadic: param.variadic,
+				})
+			}
+			group.Functions = append(group.Functions, funcData)
 		}
-
-		data.Functions = append(data.Functions, funcData)
+		data.Functions = append(data.Functions, group)
 	}
 
 	// Parse and execute template
@@ -196,29 +259,42 @@ func (dsl *dslCollection) shell() {
 	// Create the base prefix completer
 	prefixCompleter := readline.NewPrefixCompleter()
 
-	// Add variable names to completer
-	varNames := make([]string, 0, len(dsl.vars.data))
-	for name := range dsl.vars.data {
-		varNames = append(varNames, name)
+	// Add variable names to completer, grouped by category
+	varNames := []string{}
+	categories, groups = dsl.vars.byCategory()
+	for _, category := range categories {
+		varNames = append(varNames, groups[category]...)
 	}
-	sort.Strings(varNames)
 	for _, name := range varNames {
 		prefixCompleter.Children = append(prefixCompleter.Children, readline.PcItem(name))
 	}
 
 	// Add function names to completer with parameter completion
 	funcParams := make(map[string][]string)
-	funcNames := make([]string, 0, len(dsl.funcs.data))
-	for name := range dsl.funcs.data {
-		funcNames = append(funcNames, name)
+	funcValues := make(map[string]map[string][]string)
+	funcNames := []string{}
+	categories, groups = dsl.funcs.byCategory()
+	for _, category := range categories {
+		for _, name := range groups[category] {
+			funcNames = append(funcNames, name)
+			funcNames = append(funcNames, dsl.funcs.get(name).meta.aliases...)
+		}
 	}
-	sort.Strings(funcNames)
 	for _, name := range funcNames {
-		fn := dsl.funcs.data[name]
+		fn := dsl.funcs.get(name)
 		// Store the parameter names for this function
-		paramNames := make([]string, len(fn.meta.params))
-		for i, param := range fn.meta.params {
-			paramNames[i] = param.name
+		// fields of struct parameters can be passed as named arguments, too
+		paramNames := make([]string, 0, len(fn.meta.params))
+		for _, param := range fn.meta.params {
+			for _, p := range append([]dslParamMeta{param}, param.fields...) {
+				paramNames = append(paramNames, p.name)
+				if len(p.values) > 0 {
+					if funcValues[name] == nil {
+						funcValues[name] = make(map[string][]string)
+					}
+					funcValues[name][p.name] = p.values
+				}
+			}
 		}
 		funcParams[name] = paramNames
 
@@ -228,8 +304,14 @@ func (dsl *dslCollection) shell() {
 			if i > 0 {
 				paramString += " "
 			}
+			if param.variadic {
+				paramString += param.name + "..."
+				continue
+			}
 			paramString += param.name + "="
-			if param.def != nil {
+			if len(param.fields) > 0 && param.def == nil {
+				paramString += "()"
+			} else if param.def != nil {
 				switch v := param.def.(type) {
 				case string:
 					// Escape any double quotes in the string and wrap in quotes
@@ -249,6 +331,7 @@ func (dsl *dslCollection) shell() {
 	completer := &paramCompleter{
 		prefixCompleter: prefixCompleter,
 		funcParams:      funcParams,
+		funcValues:      funcValues,
 	}
 
 	// Create readline instance with basic configuration
@@ -327,6 +410,21 @@ func (dsl *dslCollection) shell() {
 			}
 			continue
 		}
+		if strings.HasPrefix(input, "export-script-md ") {
+			path := strings.TrimSpace(strings.TrimPrefix(input, "export-script-md"))
+			script, err := os.ReadFile(path)
+			if err != nil {
+				fmt.Printf("\x1b[31mError: could not read script: %v\x1b[0m\n", err)
+				continue
+			}
+			filename := strings.TrimSuffix(path, filepath.Ext(path)) + ".md"
+			if err := flo.File(filename).StoreString(dsl.docScript(string(script), "markdown")); err != nil {
+				fmt.Printf("\x1b[31mError: could not generate script documentation: %v\x1b[0m\n", err)
+			} else {
+				fmt.Printf("\x1b[32mScript documentation exported to %s\x1b[0m\n", filename)
+			}
+			continue
+		}
 		if input == "export-vscode-extension" {
 			filename, _ := filepath.Abs(fmt.Sprintf("%s.vsix", dsl.id))
 			if err := dsl.exportVSCodeExtension(filename); err != nil {
@@ -342,8 +440,13 @@ func (dsl *dslCollection) shell() {
 
 			// Create template data
 			type SearchResult struct {
-				Query     string
-				Found     bool
+				Query       string
+				Found       bool
+				Definitions []struct {
+					Signature   string
+					Kind        string
+					Description string
+				}
 				Variables []struct {
 					Name        string
 					Type        string
@@ -361,6 +464,10 @@ func (dsl *dslCollection) shell() {
 						Min         any
 						Max         any
 						Unit        string
+						Variadic    bool
+						Values      []string
+						Length      string
+						Field       bool
 					}
 					Returns []struct {
 						Name        string
@@ -370,7 +477,15 @@ func (dsl *dslCollection) shell() {
 						Min         any
 						Max         any
 						Unit        string
+						Variadic    bool
+						Values      []string
 					}
+					Examples    []dslExample
+					Aliases     []string
+					Category    string
+					Since       string
+					Deprecated  bool
+					Deprecation string
 				}
 			}
 
@@ -378,9 +493,36 @@ func (dsl *dslCollection) shell() {
 				Query: query,
 			}
 
+			// Search the documented definitions of scripts
+			names := make([]string, 0, len(dsl.docs))
+			for name := range dsl.docs {
+				names = append(names, name)
+			}
+			sort.Strings(names)
+			for _, name := range names {
+				doc := dsl.docs[name]
+				if query == "" || strings.Contains(strings.ToLower(name+" "+doc.desc), strings.ToLower(query)) {
+					data.Definitions = append(data.Definitions, struct {
+						Signature   string
+						Kind        string
+						Description string
+					}{
+						Signature:   doc.signature(),
+						Kind:        doc.kind,
+						Description: strings.ReplaceAll(doc.desc, "\n", " "),
+					})
+					found = true
+				}
+			}
+
 			// Search variables
-			for name, v := range dsl.vars.data {
-				if query == "" || strings.Contains(strings.ToLower(name), strings.ToLower(query)) {
+			for _, name := range dsl.vars.names() {
+				v := dsl.vars.get(name)
+				if v != nil && (query == "" || strings.Contains(strings.ToLower(name), strings.ToLower(query))) {
+					desc := v.meta.desc
+					if doc, ok := dsl.docs[name]; ok && desc == "" {
+						desc = strings.ReplaceAll(doc.desc, "\n", " ") // variables of scripts are documented by doc comments
+					}
 					data.Variables = append(data.Variables, struct {
 						Name        string
 						Type        string
@@ -389,7 +531,7 @@ func (dsl *dslCollection) shell() {
 					}{
 						Name:        name,
 						Type:        v.meta.typ,
-						Description: v.meta.desc,
+						Description: desc,
 						Default:     v.meta.def,
 					})
 					found = true
@@ -397,8 +539,9 @@ func (dsl *dslCollection) shell() {
 			}
 
 			// Search functions
-			for name, fn := range dsl.funcs.data {
-				if query == "" || strings.Contains(strings.ToLower(name), strings.ToLower(query)) {
+			for _, name := range dsl.funcs.names() {
+				fn := dsl.funcs.get(name)
+				if fn != nil && (query == "" || strings.Contains(strings.ToLower(strings.Join(append([]string{name}, fn.meta.aliases...), " ")), strings.ToLower(query))) {
 					funcData := struct {
 						Name        string
 						Description string
@@ -410,6 +553,10 @@ func (dsl *dslCollection) shell() {
 							Min         any
 							Max         any
 							Unit        string
+							Variadic    bool
+							Values      []string
+							Length      string
+							Field       bool
 						}
 						Returns []struct {
 							Name        string
@@ -419,13 +566,27 @@ func (dsl *dslCollection) shell() {
 							Min         any
 							Max         any
 							Unit        string
+							Variadic    bool
+							Values      []string
 						}
+						Examples    []dslExample
+						Aliases     []string
+						Category    string
+						Since       string
+						Deprecated  bool
+						Deprecation string
 					}{
 						Name:        name,
 						Description: fn.meta.desc,
+						Examples:    fn.meta.examples,
+						Aliases:     fn.meta.aliases,
+						Category:    fn.meta.doc.category,
+						Since:       fn.meta.doc.since,
+						Deprecated:  fn.meta.doc.deprecated,
+						Deprecation: fn.meta.doc.deprecation,
 					}
 
-					for _, p := range fn.meta.params {
+					for _, p := range fn.meta.docParams() {
 						funcData.Parameters = append(funcData.Parameters, struct {
 							Name        string
 							Type        string
@@ -434,6 +595,10 @@ func (dsl *dslCollection) shell() {
 							Min         any
 							Max         any
 							Unit        string
+							Variadic    bool
+							Values      []string
+							Length      string
+							Field       bool
 						}{
 							Name:        p.name,
 							Type:        p.typ,
@@ -442,6 +607,10 @@ func (dsl *dslCollection) shell() {
 							Min:         p.min,
 							Max:         p.max,
 							Unit:        p.unit,
+							Variadic:    p.variadic,
+							Values:      p.values,
+							Length:      p.length(),
+							Field:       p.field,
 						})
 					}
 
@@ -454,6 +623,8 @@ func (dsl *dslCollection) shell() {
 							Min         any
 							Max         any
 							Unit        string
+							Variadic    bool
+							Values      []string
 						}{
 							Name:        r.name,
 							Type:        r.typ,
@@ -534,6 +705,10 @@ func (dsl *dslCollection) shell() {
 			resStr = dsl.shellResultFillStyle(result.value.(FillStyle))
 		case TextStyle:
 			resStr = dsl.shellResultTextStyle(result.value.(TextStyle))
+		case Tuple:
+			resStr = dsl.shellResultTuple(result.value.(Tuple))
+		case Map:
+			resStr = dsl.shellResultMap(result.value.(Map))
 		// TODO: NEW TYPES: add additional types
 		default:
 			resStr = fmt.Sprint(result.value)
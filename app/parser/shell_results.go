@@ -1,4 +1,4 @@
-package main
+package parser
 
 import (
 	"fmt"
@@ -49,5 +49,7 @@ func (dsl *dslCollection) shellResultFillStyle(f FillStyle) string { return f.St
 func (dsl *dslCollection) shellResultTextStyle(t TextStyle) string { return t.String() }
 func (dsl *dslCollection) shellResultVector(v Vector) string       { return v.String() }
 func (dsl *dslCollection) shellResultText(t Text) string           { return t.String() }
+func (dsl *dslCollection) shellResultTuple(t Tuple) string         { return t.String() }
+func (dsl *dslCollection) shellResultMap(m Map) string             { return m.String() }
 
 // TODO: NEW TYPES: add additional shellResult* functions
@@ -1,7 +1,10 @@
-package main
+package parser
 
 import (
 	"fmt"
+	"strconv"
+	"strings"
+	"unicode/utf8"
 )
 
 // dslTokenizer converts source code into tokens.
@@ -24,7 +27,7 @@ func (t *dslTokenizer) lex() error {
 			return errors.TKN_ASSIGN_VALUE_MISSING()
 		case tokens.callStart, tokens.callEnd:
 			return errors.TKN_FUNC_INCOMPLETE()
-		case tokens.argRef, tokens.str, tokens.comment, tokens.integer, tokens.float, tokens.boolean, tokens.null:
+		case tokens.argRef, tokens.str, tokens.comment, tokens.integer, tokens.uinteger, tokens.float, tokens.color, tokens.boolean, tokens.null:
 			return nil
 		}
 		// this might just be a primitive, let's determine its type and return
@@ -41,9 +44,19 @@ func (t *dslTokenizer) lex() error {
 	slices := 0
 	inSlice := 0
 	indexes := 0
+	blocks := 0
 	for i, token := range t.tokens {
 		switch token.Type {
-		case tokens.forLoop:
+		case tokens.forLoop, tokens.whileLoop, tokens.breakLoop, tokens.contLoop, tokens.tryBlock, tokens.catchBlock:
+			continue
+		case tokens.blockStart:
+			blocks++
+			continue
+		case tokens.blockEnd:
+			blocks--
+			if blocks < 0 {
+				return errors.TKN_PAREN_MISMATCH()
+			}
 			continue
 		case tokens.done:
 			continue
@@ -83,10 +96,10 @@ func (t *dslTokenizer) lex() error {
 				}
 			}
 		case tokens.assign:
-			if dsl.isAssignToken(token) && dsl.isAssign(token.Value[0]) {
+			if dsl.isAssignToken(token) && dsl.isAssign(token.Value[0]) && (i == 0 || !dsl.isAnyToken(t.tokens[i-1], tokens.indexEnd, tokens.member)) {
 				return errors.TKN_ASSIGN_NAME_MISSING()
 			}
-			if !t.hasTokens() || dsl.isTerminatorToken(t.tokens[i+1]) {
+			if !t.hasTokens() || i+1 >= len(t.tokens) || dsl.isTerminatorToken(t.tokens[i+1]) {
 				return errors.TKN_ASSIGN_VALUE_MISSING()
 			}
 		}
@@ -94,7 +107,7 @@ func (t *dslTokenizer) lex() error {
 	if parens != 0 {
 		return errors.TKN_PAREN_MISMATCH()
 	}
-	if indexes != 0 {
+	if indexes != 0 || blocks != 0 {
 		return errors.TKN_PAREN_MISMATCH()
 	}
 	return nil
@@ -131,6 +144,19 @@ func (t *dslTokenizer) String() string {
 		str := token.String()
 		if str == ";" {
 			str = ";\n"
+		} else if token.Type == tokens.rangeSep {
+			str = ":"
+		} else if token.Type == tokens.member {
+			str = "." + str
+		} else if token.Type == tokens.arrow {
+			str = " => "
+		} else if token.Type == tokens.rangeOp {
+			dsl.trimLastStringRight(&res, " ")
+		} else if token.Type == tokens.defaultOp && len(res) > 0 {
+			dsl.trimLastStringRight(&res, " ")
+			str = " ?? "
+		} else if token.Type == tokens.mapKey && str != ":" {
+			str = mapKeyString(str[:len(str)-1]) + ": "
 		} else if dsl.lastCharIs(str, ':') {
 			str += " "
 		} else if dsl.lastCharIs(str, '=') {
@@ -142,13 +168,13 @@ func (t *dslTokenizer) String() string {
 			str = dsl.wrapString(str) + ` `
 		} else if dsl.isCommentToken(token) {
 			str = dsl.wrapComment(str) + ` `
-		} else if dsl.isAnyToken(token, tokens.argValue, tokens.float, tokens.integer, tokens.boolean, tokens.null) {
+		} else if dsl.isAnyToken(token, tokens.argValue, tokens.float, tokens.integer, tokens.uinteger, tokens.color, tokens.boolean, tokens.null) {
 			str = str + ` `
-		} else if dsl.isCallStartToken(token) && prev != nil && dsl.isCallEndToken(prev) {
+		} else if dsl.isCallStartToken(token) && prev != nil && dsl.isCallEndToken(prev) && !dsl.isAnyToken(t.tokens[i-1], tokens.arrow) {
 			dsl.setLastString(&res, ") ") // adds padding when two or more function calls are used in sequence as arguments (e.g. `add(sub(5 3) sub(3 5))`)
 		} else if dsl.isCallEndToken(token) && prev != nil && dsl.isNotCallStartToken(prev) {
 			dsl.trimLastStringRight(&res, " ") // removes padding after last argument
-		} else if dsl.isCallStartToken(token) && prev != nil && dsl.isAnyToken(prev, tokens.varRef, tokens.integer, tokens.float, tokens.boolean, tokens.str, tokens.comment, tokens.null, tokens.argValue) {
+		} else if dsl.isCallStartToken(token) && prev != nil && dsl.isAnyToken(prev, tokens.varRef, tokens.integer, tokens.uinteger, tokens.float, tokens.color, tokens.boolean, tokens.str, tokens.comment, tokens.null, tokens.argValue) {
 			dsl.appendLastString(&res, " ") // adds before function call
 		} else if dsl.isTerminatorToken(token) && len(res) > 0 {
 			dsl.trimLastStringRight(&res, " ")
@@ -215,11 +241,11 @@ func (t *dslTokenizer) addTokenAndSetNext(token *dslToken, typ dslTokenType) {
 	if t.hasTokens() && dsl.isTerminatorToken(token) && dsl.isTerminatorToken(dsl.getLastToken(t.tokens)) {
 		return
 	}
-	if t.hasTokens() && dsl.isCallStartToken(token) && t.state.notInInParens() && dsl.isNotTerminatorToken(dsl.getLastToken(t.tokens)) && dsl.isNotAssignToken(dsl.getLastToken(t.tokens)) {
+	if t.hasTokens() && dsl.isCallStartToken(token) && t.state.notInInParens() && dsl.isNotTerminatorToken(dsl.getLastToken(t.tokens)) && dsl.isNotAssignToken(dsl.getLastToken(t.tokens)) && !dsl.isAnyToken(dsl.getLastToken(t.tokens), tokens.arrow, tokens.defaultOp) {
 		t.addToken(*dsl.newTerminatorToken())
 	}
-	// Add terminator before for loops if needed
-	if t.hasTokens() && token.Value == "for" && dsl.isNotTerminatorToken(dsl.getLastToken(t.tokens)) && dsl.isNotAssignToken(dsl.getLastToken(t.tokens)) {
+	// Add terminator before loops and try blocks if needed
+	if t.hasTokens() && (token.Value == "for" || token.Value == "while" || token.Value == "try") && dsl.isNotTerminatorToken(dsl.getLastToken(t.tokens)) && dsl.isNotAssignToken(dsl.getLastToken(t.tokens)) {
 		t.addToken(*dsl.newTerminatorToken())
 	}
 	t.determineTokenType(token)
@@ -252,8 +278,10 @@ func (t *dslTokenizer) addCallEndToken(token *dslToken) (cont bool, err error) {
 			return false, nil
 		}
 		t.state.callEnd()
-		t.state.statementEnd()
-		t.addTokenAndSetNext(token, tokens.terminator)
+		if !t.continuesValue(t.pos + 1) {
+			t.state.statementEnd()
+		}
+		t.addTokenAndSetNext(token, tokens.invalid)
 		return true, nil
 	}
 	t.state.argValueStart()
@@ -264,6 +292,11 @@ func (t *dslTokenizer) addCallEndToken(token *dslToken) (cont bool, err error) {
 func (t *dslTokenizer) determineTokenType(token *dslToken) {
 	v := token.Value
 
+	// the text of strings and comments is never a keyword, i.e. "for" or "# try this #"
+	if dsl.isStringToken(token) || dsl.isCommentToken(token) {
+		return
+	}
+
 	// Keywords must be checked unconditionally
 	if dsl.equals(v, "for") {
 		token.Type = tokens.forLoop
@@ -273,6 +306,26 @@ func (t *dslTokenizer) determineTokenType(token *dslToken) {
 		token.Type = tokens.done
 		return
 	}
+	if dsl.equals(v, "while") {
+		token.Type = tokens.whileLoop
+		return
+	}
+	if dsl.equals(v, "break") {
+		token.Type = tokens.breakLoop
+		return
+	}
+	if dsl.equals(v, "continue") {
+		token.Type = tokens.contLoop
+		return
+	}
+	if dsl.equals(v, "try") {
+		token.Type = tokens.tryBlock
+		return
+	}
+	if dsl.equals(v, "catch") {
+		token.Type = tokens.catchBlock
+		return
+	}
 
 	if dsl.isArgValueToken(token) || dsl.isInvalidToken(token) {
 		switch {
@@ -280,7 +333,10 @@ func (t *dslTokenizer) determineTokenType(token *dslToken) {
 			token.Type = tokens.boolean
 		case dsl.equals(v, "nil"):
 			token.Type = tokens.null
-		case dsl.contains(v, "."):
+		case dsl.isHexLiteral(v):
+			token.Type = tokens.color // the parser reports colors with the wrong number of digits
+		case dsl.contains(v, ".") && (dsl.isDigit(v[0]) || v[0] == '-' || v[0] == '.'):
+			// names can contain dots as well, e.g. `img.radius`
 			token.Type = tokens.float
 		case v == "":
 			token.Type = tokens.str
@@ -288,6 +344,10 @@ func (t *dslTokenizer) determineTokenType(token *dslToken) {
 			// this might be an int, or it's a variable, so let's check
 			if dsl.onlyDigits(v) {
 				token.Type = tokens.integer
+			} else if typ, ok := dsl.numberLiteral(v); ok {
+				token.Type = typ // i.e. 0xFF, 1_000, 1e-3 or 255u8
+			} else if n := strings.TrimPrefix(v, "-"); n != "" && dsl.isDigit(n[0]) {
+				token.Type = tokens.integer // names can't start with a digit, the parser reports the malformed number, i.e. 0x or 1__0
 			} else {
 				token.Type = tokens.varRef
 			}
@@ -295,7 +355,9 @@ func (t *dslTokenizer) determineTokenType(token *dslToken) {
 	}
 }
 
-// handleString processes string literals, handling escape sequences.
+// handleString processes string literals, handling escape sequences and
+// interpolations like "size: ${w}x${h}". The parts of interpolated strings
+// are kept by the token, its value is the string as written.
 func (t *dslTokenizer) handleString() error {
 	// Start of string
 	t.state.stringStart()
@@ -304,31 +366,18 @@ func (t *dslTokenizer) handleString() error {
 	// Skip the opening quote
 	c := t.source[t.pos]
 	t.advancePos(c)
+	start := t.pos
+	parts := []string(nil)
 
 	for t.hasCharacterLeft() {
 		c := t.source[t.pos]
 
 		// If currently in an escape sequence, interpret next character
 		if t.state.inEscape() {
-			switch c {
-			case 'n':
-				t.token.append('\n')
-			case 'r':
-				t.token.append('\r')
-			case 't':
-				t.token.append('\t')
-			case '\\':
-				t.token.append('\\')
-			case '"':
-				t.token.append('"')
-			case '#':
-				t.token.append('#')
-			default:
-				// Unknown escape: treat as literal character
-				t.token.append(c)
+			if err := t.handleStringEscape(c); err != nil {
+				return err
 			}
 			t.state.escapeEnd()
-			t.advancePos(c)
 			continue
 		}
 
@@ -339,11 +388,26 @@ func (t *dslTokenizer) handleString() error {
 			continue
 		}
 
+		// Embedded expression, i.e. "${w}"
+		if dsl.isArgRef(c) && t.pos+1 < len(t.source) && dsl.isSliceStart(t.source[t.pos+1]) {
+			expr, err := t.interpolation()
+			if err != nil {
+				return err
+			}
+			parts = append(parts, t.token.Value, expr)
+			t.token.Value = ""
+			continue
+		}
+
 		// Handle closing quote if not escaped
 		if dsl.isString(c) && t.state.notInEscape() {
+			if parts != nil {
+				t.token.parts = append(parts, t.token.Value)
+				t.token.Value = t.source[start:t.pos]
+			}
 			t.state.stringEnd()
 			t.state.escapeEnd()
-			t.addTokenAndSetNext(t.token, tokens.argValue)
+			t.addStringToken()
 			t.advancePos(c)
 			return nil
 		}
@@ -357,6 +421,123 @@ func (t *dslTokenizer) handleString() error {
 	return errors.TKN_UNTERMINATED_STRING(t.pos)
 }
 
+// handleStringEscape adds the character of the escape sequence that c starts,
+// i.e. `\n`, `\x41`, `\u00e9` or `\$` for a literal dollar sign. Unknown
+// escapes are reported, so that `"C:\data"` isn't silently read as "C:data".
+func (t *dslTokenizer) handleStringEscape(c byte) error {
+	digits := 0
+	switch c {
+	case 'n':
+		t.token.append('\n')
+	case 'r':
+		t.token.append('\r')
+	case 't':
+		t.token.append('\t')
+	case 'a':
+		t.token.append('\a')
+	case 'b':
+		t.token.append('\b')
+	case 'f':
+		t.token.append('\f')
+	case 'v':
+		t.token.append('\v')
+	case '0':
+		t.token.append(0)
+	case 'x':
+		digits = 2
+	case 'u':
+		digits = 4
+	case 'U':
+		digits = 8
+	case '\\', '"', '#', '$':
+		t.token.append(c)
+	default:
+		return errors.TKN_INVALID_ESCAPE(t.pos, string(c))
+	}
+	t.advancePos(c)
+	if digits == 0 {
+		return nil
+	}
+	if t.pos+digits > len(t.source) {
+		return errors.TKN_INVALID_ESCAPE(t.pos, string(c))
+	}
+	hex := t.source[t.pos : t.pos+digits]
+	r, err := strconv.ParseUint(hex, 16, 32)
+	if err != nil || (c != 'x' && !utf8.ValidRune(rune(r))) {
+		return errors.TKN_INVALID_ESCAPE(t.pos, string(c)+hex)
+	}
+	if c == 'x' {
+		t.token.append(byte(r))
+	} else {
+		t.token.Value += string(rune(r))
+	}
+	for i := 0; i < digits; i++ {
+		t.advancePos(t.source[t.pos])
+	}
+	return nil
+}
+
+// interpolation returns the source of the expression embedded in a string at
+// the current position, i.e. `w` of "${w}", and moves past its closing brace.
+// The expression can contain braces and strings.
+func (t *dslTokenizer) interpolation() (string, error) {
+	t.advancePos(t.source[t.pos])
+	t.advancePos(t.source[t.pos])
+	start, depth, inString := t.pos, 1, false
+	for t.hasCharacterLeft() {
+		c := t.source[t.pos]
+		switch {
+		case inString && dsl.isEscape(c):
+			t.advancePos(c)
+		case dsl.isString(c):
+			inString = !inString
+		case !inString && dsl.isSliceStart(c):
+			depth++
+		case !inString && dsl.isSliceEnd(c):
+			depth--
+		}
+		if depth == 0 {
+			expr := strings.TrimSpace(t.source[start:t.pos])
+			t.advancePos(c)
+			if expr == "" {
+				return "", errors.TKN_INTERPOLATION_EMPTY(start)
+			}
+			return expr, nil
+		}
+		if t.hasCharacterLeft() {
+			t.advancePos(t.source[t.pos])
+		}
+	}
+	return "", errors.TKN_UNTERMINATED_STRING(t.pos)
+}
+
+// handleRawString processes strings delimited by backticks, they can span
+// multiple lines and have neither escapes nor interpolations.
+func (t *dslTokenizer) handleRawString() error {
+	t.token.Type = tokens.str
+	t.advancePos(t.source[t.pos])
+	for t.hasCharacterLeft() {
+		c := t.source[t.pos]
+		t.advancePos(c)
+		if dsl.isRawString(c) {
+			t.addStringToken()
+			return nil
+		}
+		t.token.append(c)
+	}
+	return errors.TKN_UNTERMINATED_STRING(t.pos)
+}
+
+// addStringToken adds the string that was just closed, including empty ones.
+func (t *dslTokenizer) addStringToken() {
+	if dsl.isEmptyToken(t.token) {
+		t.tokens = append(t.tokens, &dslToken{Type: tokens.str, Line: t.tokenStartLine, Column: t.tokenStartColumn})
+		t.token = dsl.newToken("", tokens.argValue)
+		return
+	}
+	t.addTokenAndSetNext(t.token, tokens.argValue)
+}
+
 // handleNamedArg processes named arguments in function calls, handling both the argument name
 // and its value, while maintaining proper state for argument processing.
 func (t *dslTokenizer) handleNamedArg(token *dslToken) *dslToken {
@@ -392,6 +573,237 @@ func (t *dslTokenizer) handleNamedArg(token *dslToken) *dslToken {
 	return token
 }
 
+// assignsIndex returns true if the assignment that starts at the current
+// position assigns to an index or a member, i.e. "a[2]: 5". The terminator
+// added after the index is removed, so that the assignment follows the index.
+func (t *dslTokenizer) assignsIndex() bool {
+	i := len(t.tokens) - 1
+	for i >= 0 && dsl.isTerminatorToken(t.tokens[i]) {
+		i--
+	}
+	if i < 0 || !dsl.isAnyToken(t.tokens[i], tokens.indexEnd, tokens.member) {
+		return false
+	}
+	t.tokens = t.tokens[:i+1]
+	return true
+}
+
+// rangeSeparator adds the pending token, the start of the range, and returns
+// the value of the separator at the current position. Whitespace separates the
+// parts of an index, a side of the separator that isn't directly followed by
+// an expression is marked with "_", i.e. "_:" for "a[:3]" and ":_" for "a[1:]".
+func (t *dslTokenizer) rangeSeparator() string {
+	sep := ":"
+	dsl.trimTokenSpace(t.token)
+	if dsl.isNotEmptyToken(t.token) {
+		t.addTokenAndSetNext(t.token, tokens.argValue)
+	} else if prev := t.source[t.pos-1]; dsl.isWhitespace(prev) || dsl.isIndexStart(prev) {
+		sep = "_" + sep
+	}
+	if next := t.pos + 1; next >= len(t.source) || dsl.isWhitespace(t.source[next]) || dsl.isIndexEnd(t.source[next]) {
+		sep += "_"
+	}
+	return sep
+}
+
+// continuesValue returns true if the source at position i continues the value
+// before it with an index or a member access, i.e. the `[1]` of `size(img)[1]`
+// or the `.X` of `P(1 2).X`, or turns it into the parameters of a lambda, i.e.
+// the `=> x` of `(x) => x`, so that the statement doesn't end with the value.
+func (t *dslTokenizer) continuesValue(i int) bool {
+	if i >= len(t.source) {
+		return false
+	}
+	if dsl.isIndexStart(t.source[i]) {
+		return true
+	}
+	if dsl.isMember(t.source[i]) && i+1 < len(t.source) && dsl.isNameStart(t.source[i+1]) {
+		return true
+	}
+	for i < len(t.source) && dsl.isWhitespace(t.source[i]) {
+		i++
+	}
+	return t.isArrow(i)
+}
+
+// isRangeOp returns true if the source at position i is the operator of a
+// numeric range, i.e. the `..` of `0..10`.
+func (t *dslTokenizer) isRangeOp(i int) bool {
+	return i+1 < len(t.source) && dsl.isMember(t.source[i]) && dsl.isMember(t.source[i+1]) &&
+		t.state.notInString() && t.state.inCode()
+}
+
+// handleRangeOp adds the start of the range, if it's pending, and the range operator.
+func (t *dslTokenizer) handleRangeOp(token *dslToken) {
+	dsl.trimTokenSpace(token)
+	if dsl.isNotEmptyToken(token) {
+		t.addTokenAndSetNext(token, tokens.argValue)
+	}
+	t.addTokenAndSetNext(dsl.newToken("..", tokens.rangeOp), tokens.argValue)
+	t.pos += 2
+}
+
+// isDefaultOp returns true if the source at position i is the operator that
+// gives the default of a missing argument, i.e. the `??` of `$2 ?? 10`.
+func (t *dslTokenizer) isDefaultOp(i int) bool {
+	return i+1 < len(t.source) && t.source[i] == '?' && t.source[i+1] == '?' &&
+		t.state.notInString() && t.state.inCode()
+}
+
+// handleDefaultOp adds the pending token, if any, and the default operator.
+func (t *dslTokenizer) handleDefaultOp(token *dslToken) {
+	dsl.trimTokenSpace(token)
+	if dsl.isNotEmptyToken(token) {
+		t.addTokenAndSetNext(token, tokens.argValue)
+	}
+	t.addTokenAndSetNext(dsl.newToken("??", tokens.defaultOp), tokens.argValue)
+	t.pos += 2
+}
+
+// skipWhitespace returns the position of the first character at or after i
+// that isn't a whitespace.
+func (t *dslTokenizer) skipWhitespace(i int) int {
+	for i < len(t.source) && dsl.isWhitespace(t.source[i]) {
+		i++
+	}
+	return i
+}
+
+// isBlockStart returns true if c opens the block of a try or catch, the
+// keyword is pending or added last, after catch there may be a name.
+func (t *dslTokenizer) isBlockStart(c byte, token *dslToken) bool {
+	if !dsl.isSliceStart(c) || t.state.inString() || !t.state.inCode() || t.state.inSlice() || t.state.inCall() {
+		return false
+	}
+	if dsl.equals(token.Value, "try") || dsl.equals(token.Value, "catch") {
+		return true
+	}
+	if dsl.isNotEmptyToken(token) || !t.hasTokens() {
+		return false
+	}
+	last := dsl.getLastToken(t.tokens)
+	if dsl.isAnyToken(last, tokens.tryBlock, tokens.catchBlock) {
+		return true
+	}
+	n := len(t.tokens)
+	return last.Type == tokens.varRef && n > 1 && dsl.isAnyToken(t.tokens[n-2], tokens.catchBlock)
+}
+
+// handleBlockStart adds the pending keyword, if any, and the start of the block.
+func (t *dslTokenizer) handleBlockStart(token *dslToken) {
+	if dsl.isNotEmptyToken(token) {
+		t.addTokenAndSetNext(token, tokens.invalid)
+	}
+	t.addTokenAndSetNext(dsl.newToken("{", tokens.blockStart), tokens.invalid)
+	t.addTokenAndSetNext(dsl.newTerminatorToken(), tokens.invalid)
+	t.state.blockOpen()
+	t.pos++
+}
+
+// isBlockEnd returns true if c closes the block of a try or catch.
+func (t *dslTokenizer) isBlockEnd(c byte) bool {
+	return dsl.isSliceEnd(c) && t.state.inBlock() && t.state.notInString() && t.state.inCode() &&
+		t.state.notInSlice() && t.state.notInCall() && t.state.notInIndex()
+}
+
+// handleBlockEnd adds the pending token, if any, and the end of the block,
+// the block ends the statement.
+func (t *dslTokenizer) handleBlockEnd(token *dslToken) {
+	dsl.trimTokenSpace(token)
+	if dsl.isNotEmptyToken(token) {
+		t.addTokenAndSetNext(token, tokens.invalid)
+	}
+	t.addTokenAndSetNext(dsl.newTerminatorToken(), tokens.invalid)
+	t.addTokenAndSetNext(dsl.newToken("}", tokens.blockEnd), tokens.invalid)
+	t.addTokenAndSetNext(dsl.newTerminatorToken(), tokens.invalid)
+	t.state.blockClose()
+	t.state.statementStart()
+	t.pos++
+}
+
+// isArrow returns true if the source at position i is the arrow of a lambda.
+func (t *dslTokenizer) isArrow(i int) bool {
+	return i+1 < len(t.source) && dsl.isNamedArg(t.source[i]) && dsl.isRowEnd(t.source[i+1]) &&
+		t.state.notInString() && t.state.inCode()
+}
+
+// handleArrow adds the arrow of a lambda, the expression that follows it is
+// the body of the lambda, see parseLambda.
+func (t *dslTokenizer) handleArrow(token *dslToken) {
+	dsl.trimTokenSpace(token)
+	if dsl.isNotEmptyToken(token) {
+		t.addTokenAndSetNext(token, tokens.argValue)
+	}
+	t.addTokenAndSetNext(dsl.newToken("=>", tokens.arrow), tokens.argValue)
+	t.pos += 2
+	for t.hasCharacterLeft() && dsl.isWhitespace(t.source[t.pos]) {
+		t.advancePos(t.source[t.pos])
+	}
+}
+
+// isMemberAccess returns true if the dot at the current position accesses a
+// member of the value added last, i.e. `a[0].X`, `P(1 2).X` or `r.P1.X` after
+// an index. Member accesses of variables are part of their name, see evaluateNode.
+func (t *dslTokenizer) isMemberAccess(token *dslToken) bool {
+	if !dsl.isEmptyToken(token) || !t.hasTokens() || t.pos == 0 || !t.continuesValue(t.pos) {
+		return false
+	}
+	last := dsl.getLastToken(t.tokens)
+	return !dsl.isWhitespace(t.source[t.pos-1]) && dsl.isAnyToken(last, tokens.indexEnd, tokens.callEnd, tokens.sliceEnd, tokens.member)
+}
+
+// handleMember adds the member access that starts at the current position,
+// the statement ends with it unless it's continued or part of a larger expression.
+func (t *dslTokenizer) handleMember(token *dslToken) {
+	t.pos++
+	for t.hasCharacterLeft() && dsl.isNameChar(t.source[t.pos]) {
+		c := t.source[t.pos]
+		token.append(c)
+		t.advancePos(c)
+	}
+	token.Type = tokens.member
+	t.addTokenAndSetNext(token, tokens.invalid)
+	if t.state.notInIndex() && t.state.notInCall() && t.state.notInSlice() && t.state.notInInParens() && !t.continuesValue(t.pos) {
+		t.state.statementEnd()
+		t.addTokenAndSetNext(dsl.newTerminatorToken(), tokens.terminator)
+	}
+}
+
+// handleMapKey turns the pending token, or the value added last, into the key
+// of a map literal, i.e. `{ "name": "box" size: 3 }`. A colon right after the
+// opening brace is the empty map `{:}`.
+func (t *dslTokenizer) handleMapKey(token *dslToken) error {
+	dsl.trimTokenSpace(token)
+	if dsl.isEmptyToken(token) {
+		last := dsl.getLastToken(t.tokens)
+		switch {
+		case !t.hasTokens() || last.Type == tokens.mapKey:
+			return errors.TKN_MAP_KEY_MISSING(t.pos)
+		case last.Type == tokens.sliceStart && t.hasNext() && dsl.isSliceEnd(t.source[t.pos+1]):
+			t.addTokenAndSetNext(dsl.newToken(":", tokens.mapKey), tokens.invalid)
+			return nil
+		case dsl.isAnyToken(last, tokens.str, tokens.integer, tokens.float, tokens.varRef, tokens.argValue):
+			t.tokens = t.tokens[:len(t.tokens)-1]
+			token = last
+		default:
+			return errors.TKN_MAP_KEY_MISSING(t.pos)
+		}
+	}
+	if token.Type != tokens.str {
+		// number keys are written the way indexes are converted, i.e. `1.50:` is "1.5"
+		t.determineTokenType(token)
+		if f, err := strconv.ParseFloat(token.Value, 64); err == nil && dsl.isAnyToken(token, tokens.integer, tokens.float) {
+			token.Value, _ = dsl.mapKey(f)
+		} else if i, err := dsl.parseInteger(token.Value); err == nil && token.Type == tokens.integer {
+			token.Value, _ = dsl.mapKey(float64(i)) // i.e. `0xFF:` is "255"
+		}
+	}
+	token.Type = tokens.mapKey
+	dsl.appendToken(token, ":")
+	t.addTokenAndSetNext(token, tokens.invalid)
+	return nil
+}
+
 // handleTerminator processes the end of a statement, performing validation checks
 // for unterminated strings, comments, functions, and arguments, and resetting the
 // statement state for the next statement.
@@ -415,6 +827,64 @@ func (t *dslTokenizer) handleTerminator() error {
 	return nil
 }
 
+// isColor returns true if the source at position i is a color literal, i.e.
+// `#ff8800`, that starts a new value. The hex digits must be followed by the
+// end of the value, `#ff8800 is orange#` is still a comment.
+func (t *dslTokenizer) isColor(i int, token *dslToken) bool {
+	if !dsl.isComment(t.source[i]) || t.state.inString() || !t.state.inCode() || dsl.isNotEmptyToken(token) {
+		return false
+	}
+	end := i + 1
+	for end < len(t.source) && dsl.isHexDigit(t.source[end]) {
+		end++
+	}
+	if end < len(t.source) && !strings.ContainsRune(" \t\r\n;)}]", rune(t.source[end])) {
+		return false
+	}
+	if dsl.isColorLiteral(t.source[i:end]) {
+		return true
+	}
+	// other numbers of hex digits are invalid colors (`#abc`), which the
+	// parser reports, unless the # starts a comment, i.e. `#bad idea#`
+	return end > i+1 && !strings.ContainsRune(t.source[end:], '#')
+}
+
+// handleColor adds the color literal at the current position to the pending
+// token, its type is determined when the value ends.
+func (t *dslTokenizer) handleColor(token *dslToken) {
+	t.state.assignEnd() // the color can be the value of an assignment, i.e. "c: #ff8800"
+	t.pos++             // the # is already tracked
+	token.append('#')
+	for t.hasCharacterLeft() && dsl.isHexDigit(t.source[t.pos]) {
+		token.append(t.source[t.pos])
+		t.advancePos(t.source[t.pos])
+	}
+}
+
+// isLineComment returns true if the source at position i starts a line
+// comment, i.e. `// text` or the doc comment `/// text`.
+func (t *dslTokenizer) isLineComment(i int) bool {
+	return i+1 < len(t.source) && t.source[i] == '/' && t.source[i+1] == '/' &&
+		t.state.notInString() && t.state.inCode()
+}
+
+// handleLineComment adds the pending token and the comment that ends with
+// the line, the line break is left to end the statement.
+func (t *dslTokenizer) handleLineComment(token *dslToken) {
+	dsl.trimTokenSpace(token)
+	if dsl.isNotEmptyToken(token) {
+		t.addTokenAndSetNext(token, tokens.invalid)
+	}
+	t.pos++ // the first / is already tracked
+	for t.hasCharacterLeft() && t.source[t.pos] != '\n' {
+		token.append(t.source[t.pos])
+		t.advancePos(t.source[t.pos])
+	}
+	token.Value = strings.TrimSpace(strings.TrimLeft(token.Value, "/"))
+	token.Type = tokens.comment
+	t.addTokenAndSetNext(token, tokens.invalid)
+}
+
 // handleComment processes comments delimited by # characters, handling both comment
 // start/end markers and escape sequences within comments using backslash.
 func (t *dslTokenizer) handleComment(c byte, token *dslToken) bool {
@@ -491,31 +961,48 @@ func (t *dslTokenizer) isTerminator() bool {
 }
 
 // handleArgRef processes script argument references in the format $1, $2, etc.
-// It validates that the argument number is a positive integer and creates a token
-// for the argument reference. Returns an error if the argument number is invalid
-// or if the reference appears in an invalid context (e.g., inside a string).
+// for positional arguments, $name for named arguments, $# for the number of
+// positional arguments and $@ for all of them. A following `??` gives the
+// value used if the argument is missing, i.e. `$2 ?? 10`. Returns an error if
+// nothing follows the $.
 func (t *dslTokenizer) handleArgRef() error {
 	// Skip the '$' character (already tracked in main loop)
 	t.pos++
 
-	// Collect the argument number
-	argNum := ""
-	for t.hasCharacterLeft() {
-		c := t.source[t.pos]
-		if dsl.isDigit(c) {
-			argNum += string(c)
+	// Collect the argument number, name or the # and @ of $# and $@
+	collect := func(valid func(c byte) bool) string {
+		start := t.pos
+		for t.hasCharacterLeft() && valid(t.source[t.pos]) {
+			t.advancePos(t.source[t.pos])
+		}
+		return t.source[start:t.pos]
+	}
+	ref := ""
+	if t.hasCharacterLeft() {
+		switch c := t.source[t.pos]; {
+		case dsl.isComment(c) || c == '@':
+			ref = string(c)
 			t.advancePos(c)
-		} else {
-			break
+		case dsl.isDigit(c):
+			ref = collect(dsl.isDigit)
+		case dsl.isNameStart(c):
+			ref = collect(dsl.isNameChar)
 		}
 	}
 
-	if argNum == "" {
-		return errors.TKN_INVALID_ARG_REF(t.pos, "missing number after $")
+	if ref == "" {
+		return errors.TKN_INVALID_ARG_REF(t.pos, "missing number or name after $")
 	}
 
 	t.token.Type = tokens.argRef
-	t.token.Value = "$" + argNum
+	t.token.Value = "$" + ref
+
+	if i := t.skipWhitespace(t.pos); t.isDefaultOp(i) {
+		t.addTokenAndSetNext(t.token, tokens.argValue)
+		t.pos = i
+		t.handleDefaultOp(t.token)
+		return nil
+	}
 
 	// If we're in a function call or after a variable assignment, treat this as a value
 	if t.state.notInCall() {
@@ -533,6 +1020,41 @@ func (t *dslTokenizer) handleArgRef() error {
 	return nil
 }
 
+// collectAssignNames merges the variable references preceding an assignment
+// on the same line into the assign token, so that "w h: size(img)" becomes a
+// single assignment to w and h instead of two expressions and an assignment.
+// References of a loop header on the same line aren't merged.
+func (t *dslTokenizer) collectAssignNames(token *dslToken) {
+	refs := []int{}
+	for i := len(t.tokens) - 1; i >= 0; i-- {
+		tk := t.tokens[i]
+		if dsl.isTerminatorToken(tk) {
+			continue
+		}
+		// the references are part of a loop header, i.e. "for i in 1..n x: i done"
+		if dsl.isAnyToken(tk, tokens.forLoop, tokens.whileLoop, tokens.rangeOp) || (tk.Type == tokens.varRef && (tk.Value == "in" || tk.Value == "step")) {
+			return
+		}
+		if tk.Type != tokens.varRef || tk.Line != t.state.Line {
+			// the first reference is the value of a preceding assignment (e.g. "x: y w h: ...")
+			if dsl.isAssignToken(tk) && len(refs) > 0 {
+				refs = refs[:len(refs)-1]
+			}
+			break
+		}
+		refs = append(refs, i)
+	}
+	if len(refs) == 0 {
+		return
+	}
+	names := []string{}
+	for i := len(refs) - 1; i >= 0; i-- {
+		names = append(names, t.tokens[refs[i]].Value)
+	}
+	token.Value = dsl.joinSpace(names) + " " + token.Value
+	t.tokens = t.tokens[:refs[len(refs)-1]]
+}
+
 // tokenize performs the main tokenization process.
 // It converts source code into a stream of tokens.
 func (t *dslTokenizer) tokenize() error {
@@ -546,6 +1068,14 @@ func (t *dslTokenizer) tokenize() error {
 
 	for t.hasCharacterLeft() {
 		if t.isTerminator() {
+			// the index that ended the statement is assigned to, i.e. "a[2]: 5"
+			if dsl.isAssign(t.source[t.pos]) && dsl.isEmptyToken(token) && t.assignsIndex() {
+				t.state.statementStart()
+				t.state.assignStart()
+				t.addTokenAndSetNext(dsl.newToken(":", tokens.assign), tokens.invalid)
+				t.advancePos(t.source[t.pos])
+				continue
+			}
 			if err := t.handleTerminator(); err != nil {
 				return err
 			}
@@ -579,6 +1109,20 @@ func (t *dslTokenizer) tokenize() error {
 			continue
 		}
 
+		// determine if it's a color, otherwise # starts a comment
+		// for colors, i.e. "#ff8800" or "#ff880080"
+		if t.isColor(t.pos, token) {
+			t.handleColor(token)
+			continue
+		}
+
+		// determine if it's a line comment
+		// for comments up to the end of the line, i.e. "w: 800 // the width"
+		if t.isLineComment(t.pos) {
+			t.handleLineComment(token)
+			continue
+		}
+
 		if t.handleComment(c, token) {
 			continue
 		}
@@ -592,6 +1136,16 @@ func (t *dslTokenizer) tokenize() error {
 			continue
 		}
 
+		// determine if it's a raw string
+		// for multi-line strings, i.e. `C:\path` or `line 1
+		// line 2`
+		if dsl.isRawString(c) && t.state.notInString() && t.state.inCode() {
+			if err := t.handleRawString(); err != nil {
+				return err
+			}
+			continue
+		}
+
 		if t.state.inAssign() {
 			if dsl.isWhitespace(c) {
 				t.pos++
@@ -600,6 +1154,34 @@ func (t *dslTokenizer) tokenize() error {
 			t.state.assignEnd()
 		}
 
+		// determine if it's a range operator
+		// for numeric ranges, i.e. "for i in 0..10 step 2"
+		if t.isRangeOp(t.pos) {
+			t.handleRangeOp(token)
+			continue
+		}
+
+		// determine if it's a default operator
+		// for missing arguments, i.e. "$2 ?? 10"
+		if t.isDefaultOp(t.pos) {
+			t.handleDefaultOp(token)
+			continue
+		}
+
+		// determine if it's the arrow of a lambda
+		// for function values, i.e. "(x) => mul(x 2)"
+		if t.isArrow(t.pos) {
+			t.handleArrow(token)
+			continue
+		}
+
+		// determine if it's a member access
+		// for fields of structs, i.e. "P(1 2).X" or "a[0].P1.X"
+		if dsl.isMember(c) && t.isMemberAccess(token) {
+			t.handleMember(token)
+			continue
+		}
+
 		// handle slice content (elements and rows)
 		if t.state.inSlice() {
 			// check if it's a slice end
@@ -616,7 +1198,7 @@ func (t *dslTokenizer) tokenize() error {
 				// }
 				t.addTokenAndSetNext(dsl.newToken("}", tokens.sliceEnd), tokens.invalid)
 				t.state.argValueEnd()
-				if t.state.notInSlice() && t.state.notInCall() {
+				if t.state.notInSlice() && t.state.notInCall() && !t.continuesValue(t.pos+1) {
 					t.state.statementEnd()
 					t.addTokenAndSetNext(dsl.newTerminatorToken(), tokens.terminator)
 				}
@@ -633,6 +1215,15 @@ func (t *dslTokenizer) tokenize() error {
 				t.pos++
 				continue
 			}
+
+			// check if it's a map key, i.e. `{ "name": "box" size: 3 }`
+			if dsl.isAssign(c) && t.state.notInIndex() {
+				if err := t.handleMapKey(token); err != nil {
+					return err
+				}
+				t.pos++
+				continue
+			}
 		}
 
 		// check if we're in a function call and we're waiting for arguments
@@ -683,6 +1274,14 @@ func (t *dslTokenizer) tokenize() error {
 
 		}
 
+		// determine if it's a range separator
+		// for slicing, i.e. "a[1:3]", "a[:3]" or "m[1: 0:2]"
+		if dsl.isAssign(c) && t.state.inIndex() {
+			t.addTokenAndSetNext(dsl.newToken(t.rangeSeparator(), tokens.rangeSep), tokens.invalid)
+			t.pos++
+			continue
+		}
+
 		// determine if it's a variable assignment character
 		// for variable assignments, i.e. "x: 1"
 		if dsl.isAssign(c) {
@@ -692,6 +1291,7 @@ func (t *dslTokenizer) tokenize() error {
 			}
 			t.state.assignStart()
 			token.Type = tokens.assign
+			t.collectAssignNames(token)
 			if len(t.tokens) > 0 {
 				t.addTokenAndSetNext(dsl.newTerminatorToken(), tokens.assign)
 			}
@@ -731,6 +1331,17 @@ func (t *dslTokenizer) tokenize() error {
 			continue
 		}
 
+		// determine if it's the start or the end of a block
+		// for try and catch, i.e. "try { ... } catch err { ... }"
+		if t.isBlockStart(c, token) {
+			t.handleBlockStart(token)
+			continue
+		}
+		if t.isBlockEnd(c) {
+			t.handleBlockEnd(token)
+			continue
+		}
+
 		// determine if it's a slice start character
 		// for slices, i.e. "{ 1 2 3 }"
 		if dsl.isSliceStart(c) && t.state.notInString() && t.state.inCode() && t.state.notInSlice() {
@@ -799,7 +1410,7 @@ func (t *dslTokenizer) tokenize() error {
 			t.state.argValueEnd()
 			t.state.indexClose()
 			// If we're not inside another index/call/slice and not in parens, end the statement
-			if t.state.notInIndex() && t.state.notInCall() && t.state.notInSlice() && t.state.notInInParens() {
+			if t.state.notInIndex() && t.state.notInCall() && t.state.notInSlice() && t.state.notInInParens() && !t.continuesValue(t.pos+1) {
 				t.state.statementEnd()
 				t.addTokenAndSetNext(dsl.newTerminatorToken(), tokens.terminator)
 			}
@@ -835,8 +1446,8 @@ func (t *dslTokenizer) tokenize() error {
 
 		if dsl.isWhitespace(c) {
 			t.determineTokenType(token)
-			// Add terminator before for loops if needed
-			if token.Value == "for" && dsl.isNotTerminatorToken(dsl.getLastToken(t.tokens)) && dsl.isNotAssignToken(dsl.getLastToken(t.tokens)) {
+			// Add terminator before loops and try blocks if needed
+			if (token.Value == "for" || token.Value == "while" || token.Value == "try") && t.hasTokens() && dsl.isNotTerminatorToken(dsl.getLastToken(t.tokens)) && dsl.isNotAssignToken(dsl.getLastToken(t.tokens)) {
 				t.addToken(*dsl.newTerminatorToken())
 			}
 			// Handle done keyword
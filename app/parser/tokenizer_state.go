@@ -1,4 +1,4 @@
-package main
+package parser
 
 // dslTokenizerState represents the current dslTokenizerState of the tokenizer.
 // It tracks various parsing contexts like strings, comments, and function calls.
@@ -14,6 +14,7 @@ type dslTokenizerState struct {
 	parens        int  // Nesting level of parentheses
 	slices        int  // Nesting level of slices
 	indexes       int  // Nesting level of indexes
+	blocks        int  // Nesting level of try and catch blocks
 	Line          int  // Current line number (1-based)
 	Column        int  // Current column number (1-based)
 }
@@ -57,6 +58,9 @@ func (s *dslTokenizerState) indexOpen()           { s.indexes++ }
 func (s *dslTokenizerState) indexClose()          { s.indexes-- }
 func (s *dslTokenizerState) inIndex() bool        { return s.indexes > 0 }
 func (s *dslTokenizerState) notInIndex() bool     { return s.indexes == 0 }
+func (s *dslTokenizerState) blockOpen()           { s.blocks++ }
+func (s *dslTokenizerState) blockClose()          { s.blocks-- }
+func (s *dslTokenizerState) inBlock() bool        { return s.blocks > 0 }
 
 func (dsl *dslCollection) newState() *dslTokenizerState {
 	return &dslTokenizerState{
@@ -71,6 +75,7 @@ func (dsl *dslCollection) newState() *dslTokenizerState {
 		parens:        0,
 		slices:        0,
 		indexes:       0,
+		blocks:        0,
 		Line:          1,
 		Column:        1,
 	}
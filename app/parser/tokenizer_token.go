@@ -1,4 +1,4 @@
-package main
+package parser
 
 // dslToken represents a lexical dslToken in the language.
 // It contains the dslToken's value and type.
@@ -7,6 +7,7 @@ type dslToken struct {
 	Type   dslTokenType // The token's type
 	Line   int          // Line number where token starts (1-based)
 	Column int          // Column number where token starts (1-based)
+	parts  []string     // Literal text and embedded expressions of interpolated strings, alternating
 }
 
 // String returns the token's value as a string.
@@ -16,7 +17,7 @@ func (t *dslToken) String() string {
 
 // append adds a character to the token's value.
 func (t *dslToken) append(char byte) {
-	t.Value += string(char)
+	t.Value += string([]byte{char}) // the bytes of UTF-8 characters are added one by one
 }
 
 // newToken creates a new token with the given value and type.
@@ -1,3 +1,3 @@
-package main
+package parser
 
 // TODO: NEW TYPES: add additional types as new file: types_<typename>.go
@@ -0,0 +1,33 @@
+package parser
+
+// Error is an error caught by a try block, i.e.
+// `try { ... } catch err { log(err.message err.code) }`. Errors of the
+// language have the name of their kind as code, i.e. "PSR_VAR_UNDEFINED",
+// errors of `fail` have the code they are given and other errors, i.e. the
+// ones returned by functions, have the code "ERROR".
+type Error struct {
+	Message string
+	Code    string
+}
+
+func (e Error) Error() string {
+	return e.Message
+}
+
+// newError returns err as an Error that scripts can inspect.
+func newError(err error) Error {
+	for e := err; e != nil; {
+		switch e := e.(type) {
+		case Error:
+			return e
+		case dslCodedError:
+			return Error{Message: err.Error(), Code: e.code}
+		}
+		u, ok := e.(interface{ Unwrap() error })
+		if !ok {
+			break
+		}
+		e = u.Unwrap()
+	}
+	return Error{Message: err.Error(), Code: "ERROR"}
+}
@@ -0,0 +1,91 @@
+package parser
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+)
+
+// reflectErrorType is the type of the error results of Go functions.
+var reflectErrorType = reflect.TypeOf((*error)(nil)).Elem()
+
+// Func is a function value: a reference to a registered or builtin function
+// (`map(xs double)`) or a lambda (`(x) => mul(x 2)`). Function values can be
+// assigned to variables, called like functions (`double: (x) => mul(x 2)`,
+// `double(3)`) and passed to parameters of `func` type.
+type Func struct {
+	name   string   // name of the referenced function, empty for lambdas
+	params []string // parameters of lambdas
+	fn     func(args ...any) (any, error)
+}
+
+func (f *Func) String() string {
+	if f.name != "" {
+		return f.name
+	}
+	return "(" + strings.Join(f.params, " ") + ") => ..."
+}
+
+// Call calls the function with positional arguments.
+func (f *Func) Call(args ...any) (any, error) {
+	return f.fn(args...)
+}
+
+// dslFuncError carries the error of a function value called through a Go
+// callback that can't return it, see Func.as. dslFnType.call recovers it.
+type dslFuncError struct {
+	err error
+}
+
+// as returns the function value as a Go function of type t. The arguments
+// are passed as they are, the result is converted to the results of t.
+// A function value returning a Tuple fills several results. If t doesn't
+// end in an error result, errors are returned by the call of the registered
+// function that received the callback, so such callbacks must be called
+// synchronously by that function.
+func (f *Func) as(t reflect.Type) reflect.Value {
+	return reflect.MakeFunc(t, func(in []reflect.Value) []reflect.Value {
+		args := make([]any, 0, len(in))
+		for i, v := range in {
+			if t.IsVariadic() && i == len(in)-1 {
+				for j := 0; j < v.Len(); j++ {
+					args = append(args, v.Index(j).Interface())
+				}
+				continue
+			}
+			args = append(args, v.Interface())
+		}
+
+		n := t.NumOut()
+		withErr := n > 0 && t.Out(n-1) == reflectErrorType
+		if withErr {
+			n--
+		}
+		out := make([]reflect.Value, t.NumOut())
+		res, err := f.Call(args...)
+		results := []any{res}
+		if tuple, ok := res.(Tuple); ok && n > 1 {
+			results = tuple
+		}
+		if err == nil && n > len(results) {
+			err = errors.CAST_NOT_POSSIBLE(fmt.Sprintf("%T", res), t.String())
+		}
+		for i := 0; i < n && err == nil; i++ {
+			out[i], err = dsl.castElem(results[i], t.Out(i))
+		}
+		if err != nil {
+			if !withErr {
+				panic(dslFuncError{err})
+			}
+			for i := 0; i < n; i++ {
+				out[i] = reflect.Zero(t.Out(i))
+			}
+			out[n] = reflect.ValueOf(&err).Elem()
+			return out
+		}
+		if withErr {
+			out[n] = reflect.Zero(reflectErrorType)
+		}
+		return out
+	})
+}
@@ -0,0 +1,68 @@
+package parser
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Map holds the entries of map literals, i.e. `{ name: "box" "max size": 3 1: true }`.
+// Keys are strings, number keys are stored the way indexes are converted
+// (see dslCollection.mapKey), so `m[1]` and `m["1"]` are the same entry.
+// Maps are passed to Go parameters of type `map[string]T`.
+type Map map[string]any
+
+func (m Map) String() string {
+	entries := make([]string, 0, len(m))
+	for _, key := range m.keys() {
+		entries = append(entries, mapKeyString(key)+": "+mapValueString(m[key]))
+	}
+	if len(entries) == 0 {
+		return "{:}"
+	}
+	return "{ " + strings.Join(entries, " ") + " }"
+}
+
+// keys returns the keys of m in the order loops visit them:
+// number keys in ascending order first, followed by the other keys sorted.
+func (m Map) keys() []string {
+	keys := make([]string, 0, len(m))
+	for key := range m {
+		keys = append(keys, key)
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		a, errA := strconv.ParseFloat(keys[i], 64)
+		b, errB := strconv.ParseFloat(keys[j], 64)
+		switch {
+		case errA == nil && errB == nil:
+			return a < b
+		case errA == nil || errB == nil:
+			return errA == nil
+		}
+		return keys[i] < keys[j]
+	})
+	return keys
+}
+
+// mapKeyString returns the key as written in map literals,
+// keys that can't be written bare are quoted.
+func mapKeyString(key string) string {
+	if key == "" {
+		return strconv.Quote(key)
+	}
+	for _, c := range key {
+		if !(c == '_' || c == '-' || c == '.' || c >= '0' && c <= '9' || c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z') {
+			return strconv.Quote(key)
+		}
+	}
+	return key
+}
+
+// mapValueString returns the value as written in map literals.
+func mapValueString(v any) string {
+	if s, ok := v.(string); ok {
+		return strconv.Quote(s)
+	}
+	return fmt.Sprint(v)
+}
@@ -0,0 +1,39 @@
+package parser
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// Options holds the fields of a struct parameter, keyed by the names scripts
+// use for them. Scripts pass them as a group of named arguments, i.e.
+// `blur(img opts=(radius=3 edge="clamp"))`, or flattened into the call,
+// i.e. `blur(img radius=3 edge="clamp")`.
+type Options map[string]any
+
+func (o Options) String() string {
+	names := make([]string, 0, len(o))
+	for name := range o {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	fields := make([]string, 0, len(names))
+	for _, name := range names {
+		fields = append(fields, fmt.Sprintf("%s=%v", name, o[name]))
+	}
+	return "(" + strings.Join(fields, " ") + ")"
+}
+
+// merge returns a copy of o with the fields of other added,
+// fields set in both take the value of other.
+func (o Options) merge(other Options) Options {
+	res := Options{}
+	for name, v := range o {
+		res[name] = v
+	}
+	for name, v := range other {
+		res[name] = v
+	}
+	return res
+}
@@ -0,0 +1,19 @@
+package parser
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Tuple holds the values returned by functions with more than one result,
+// e.g. `func size(img image.Image) (int, int, error)`.
+// Tuples can be indexed (`t[0]`) or destructured (`w h: size(img)`).
+type Tuple []any
+
+func (t Tuple) String() string {
+	values := make([]string, 0, len(t))
+	for _, v := range t {
+		values = append(values, fmt.Sprint(v))
+	}
+	return "(" + strings.Join(values, " ") + ")"
+}
@@ -1,4 +1,4 @@
-package main
+package parser
 
 import (
 	"fmt"
@@ -27,6 +27,205 @@ func castSelfOnly[T any](value T, targetType, typeName string) (any, error) {
 	return nil, errors.CAST_NOT_POSSIBLE(reflect.TypeOf(value).String(), targetType)
 }
 
+// castVariadic converts the values collected for a variadic parameter
+// into the typed slice expected by the Go function. The values must
+// already have been cast to T, which dslFnType.call takes care of.
+func castVariadic[T any](value any) []T {
+	values, _ := value.([]any)
+	res := make([]T, 0, len(values))
+	for _, v := range values {
+		res = append(res, v.(T))
+	}
+	return res
+}
+
+// castOption returns the field name of the Options passed to a struct
+// parameter, or the zero value of T if it isn't set. The fields must already
+// have been cast to their types, which dslParamMeta.options takes care of.
+func castOption[T any](value any, name string) T {
+	opts, _ := value.(Options)
+	v, _ := opts[name].(T)
+	return v
+}
+
+// castFunc converts the function value passed to a parameter of
+// function type into the Go function expected by the Go function.
+func castFunc[T any](value any) T {
+	var zero T
+	f, ok := value.(*Func)
+	if !ok {
+		v, _ := value.(T)
+		return v
+	}
+	return f.as(reflect.TypeOf(&zero).Elem()).Interface().(T)
+}
+
+// mapElemTypes are the element types of the `map[string]T` parameters
+// that maps can be cast to even when they are empty.
+var mapElemTypes = map[string]reflect.Type{
+	"any":       reflect.TypeOf((*any)(nil)).Elem(),
+	"bool":      reflect.TypeOf(false),
+	"string":    reflect.TypeOf(""),
+	"int":       reflect.TypeOf(int(0)),
+	"int64":     reflect.TypeOf(int64(0)),
+	"float32":   reflect.TypeOf(float32(0)),
+	"float64":   reflect.TypeOf(float64(0)),
+	"[]any":     reflect.TypeOf([]any{}),
+	"[]string":  reflect.TypeOf([]string{}),
+	"[]float64": reflect.TypeOf([]float64{}),
+}
+
+// castMap converts m to targetType, i.e. "map[string]float64",
+// by converting each of its values to the element type.
+func (dsl *dslCollection) castMap(m Map, targetType string) (any, error) {
+	elemType := strings.TrimPrefix(targetType, "map[string]")
+	typ, known := mapElemTypes[elemType]
+	values := make(map[string]any, len(m))
+	for key, v := range m {
+		converted := v
+		if t := reflect.TypeOf(v); elemType != "any" && (t == nil || t.String() != elemType) {
+			var err error
+			if converted, err = dsl.cast(v, elemType); err != nil {
+				return nil, err
+			}
+		}
+		if !known {
+			// other element types, i.e. "*image.NRGBA", are those of the values
+			typ, known = reflect.TypeOf(converted), true
+		}
+		values[key] = converted
+	}
+	if !known {
+		return nil, errors.CAST_NOT_POSSIBLE("empty map", targetType)
+	}
+	res := reflect.MakeMapWithSize(reflect.MapOf(reflect.TypeOf(""), typ), len(values))
+	for key, v := range values {
+		rv := reflect.ValueOf(v)
+		if !rv.IsValid() {
+			rv = reflect.Zero(typ)
+		}
+		if !rv.Type().AssignableTo(typ) {
+			return nil, errors.CAST_NOT_POSSIBLE(rv.Type().String(), elemType)
+		}
+		res.SetMapIndex(reflect.ValueOf(key), rv)
+	}
+	return res.Interface(), nil
+}
+
+// toMap returns value as Map if it's a Map or a Go map with string keys,
+// i.e. the `map[string]float64` returned by a function.
+func (dsl *dslCollection) toMap(value any) (Map, bool) {
+	if m, ok := value.(Map); ok {
+		return m, true
+	}
+	rv := reflect.ValueOf(value)
+	if !rv.IsValid() || rv.Kind() != reflect.Map || rv.Type().Key().Kind() != reflect.String {
+		return nil, false
+	}
+	m := make(Map, rv.Len())
+	iter := rv.MapRange()
+	for iter.Next() {
+		m[iter.Key().String()] = iter.Value().Interface()
+	}
+	return m, true
+}
+
+// castElem converts value to an element of type typ, i.e. to assign it to
+// an element of a slice.
+func (dsl *dslCollection) castElem(value any, typ reflect.Type) (reflect.Value, error) {
+	rv := reflect.ValueOf(value)
+	if !rv.IsValid() {
+		switch typ.Kind() {
+		case reflect.Interface, reflect.Pointer, reflect.Slice, reflect.Map:
+			return reflect.Zero(typ), nil
+		}
+		return reflect.Value{}, errors.NIL_CAST()
+	}
+	if rv.Type().AssignableTo(typ) {
+		return rv, nil
+	}
+	r, err := dsl.castInRange(value, typ.String())
+	if err != nil {
+		return reflect.Value{}, err
+	}
+	if rv = reflect.ValueOf(r); !rv.IsValid() || !rv.Type().AssignableTo(typ) {
+		return reflect.Value{}, errors.CAST_NOT_POSSIBLE(reflect.TypeOf(value).String(), typ.String())
+	}
+	return rv, nil
+}
+
+// mapKey converts the index of a map to its key, numbers are formatted
+// without trailing zeros so that `m[1]`, `m[1.0]` and `m["1"]` are the same entry.
+func (dsl *dslCollection) mapKey(index any) (string, error) {
+	switch v := index.(type) {
+	case string:
+		return v, nil
+	case int, int8, int16, int32, int64, uint, uint8, uint16, uint32, uint64:
+		return fmt.Sprint(v), nil
+	case float32, float64:
+		f, _ := dsl.toFloat64(v)
+		return strconv.FormatFloat(f, 'f', -1, 64), nil
+	}
+	return "", errors.PSR_MAP_KEY_INVALID(index)
+}
+
+// castAs converts a value to T, typ is the name of T used by the language,
+// e.g. "float64" or "*image.NRGBA". Generated setters use it to assign values.
+func castAs[T any](value any, typ string) (T, error) {
+	if v, ok := value.(T); ok {
+		return v, nil
+	}
+	var zero T
+	if value == nil {
+		return zero, errors.NIL_CAST()
+	}
+	r, err := dsl.castInRange(value, typ)
+	if err != nil {
+		return zero, err
+	}
+	v, ok := r.(T)
+	if !ok {
+		return zero, errors.CAST_NOT_POSSIBLE(reflect.TypeOf(value).String(), typ)
+	}
+	return v, nil
+}
+
+// castInRange converts a value like cast, but reports numbers outside the
+// range of an integer or float32 target instead of saturating them, i.e. 300
+// or -1 for uint8. Fractions of floats are still truncated.
+func (dsl *dslCollection) castInRange(value any, targetType string) (any, error) {
+	res, err := dsl.cast(value, targetType)
+	if err != nil {
+		return nil, err
+	}
+	if !fitsRange(value, res) {
+		return nil, errors.CAST_OUT_OF_RANGE(value, targetType)
+	}
+	return res, nil
+}
+
+// fitsRange returns false if the number value was saturated when it was cast
+// to res, values that aren't numbers always fit.
+func fitsRange(value, res any) bool {
+	rv, rr := reflect.ValueOf(value), reflect.ValueOf(res)
+	if numberKind(rv) == reflect.Invalid || numberKind(rr) == reflect.Invalid {
+		return true
+	}
+	f := numberFloat(rv)
+	if numberKind(rr) == reflect.Float64 {
+		// only float32 can overflow, infinity stays infinity
+		return rr.Kind() != reflect.Float32 || math.IsInf(f, 0) || math.Abs(f) <= math.MaxFloat32
+	}
+	if numberKind(rv) == reflect.Float64 {
+		if math.IsNaN(f) || math.IsInf(f, 0) {
+			return false
+		}
+		value = math.Trunc(f)
+	}
+	c, ok := compareNumbers(value, res)
+	return ok && c == 0
+}
+
 // cast attempts to convert a value to the target type
 func (dsl *dslCollection) cast(value any, targetType string) (any, error) {
 	if value == nil {
@@ -68,12 +267,20 @@ func (dsl *dslCollection) cast(value any, targetType string) (any, error) {
 		}
 	}
 
+	// Handle map types before the main switch
+	if strings.HasPrefix(targetType, "map[string]") {
+		if m, ok := dsl.toMap(value); ok {
+			return dsl.castMap(m, targetType)
+		}
+		return nil, errors.CAST_NOT_POSSIBLE(reflect.TypeOf(value).String(), targetType)
+	}
+
 	// Validate input type
 	switch value := value.(type) {
 	// These types are supported
 	case *image.NRGBA, *image.RGBA, *image.RGBA64, *image.NRGBA64:
 		return dsl.castImage(value, targetType)
-	case color.RGBA, color.RGBA64:
+	case color.RGBA, color.RGBA64, color.NRGBA, color.NRGBA64:
 		return dsl.castColor(value, targetType)
 	case Point:
 		return castSelfOnly(value, targetType, "Point")
@@ -97,6 +304,21 @@ func (dsl *dslCollection) cast(value any, targetType string) (any, error) {
 		return castSelfOnly(value, targetType, "FillStyle")
 	case TextStyle:
 		return castSelfOnly(value, targetType, "TextStyle")
+	case Tuple:
+		return castSelfOnly(value, targetType, "Tuple")
+	case Map:
+		return castSelfOnly(value, targetType, "Map")
+	case Error:
+		if targetType == "string" {
+			return value.Message, nil
+		}
+		return castSelfOnly(value, targetType, "Error")
+	case *Func:
+		// converted to the Go function by castFunc or reflectValue
+		if strings.HasPrefix(targetType, "func(") {
+			return value, nil
+		}
+		return castSelfOnly(value, targetType, "Func")
 		// TODO: NEW TYPES: add additional types
 	case bool, int, int8, int16, int32, int64, uint, uint8, uint16, uint32, uint64, float32, float64, string:
 	default:
@@ -174,6 +396,10 @@ func (dsl *dslCollection) castToType(value any, targetType string) (any, error)
 			switch v := value.(type) {
 			case bool, int, int8, int16, int32, int64, uint, uint8, uint16, uint32, uint64, float32, float64:
 				return fmt.Sprintf("%v", v), nil
+			case error:
+				return v.Error(), nil
+			case fmt.Stringer:
+				return v.String(), nil
 			}
 		}
 
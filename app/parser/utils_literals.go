@@ -0,0 +1,146 @@
+package parser
+
+import (
+	"image/color"
+	"strconv"
+	"strings"
+)
+
+// unsignedSuffixes are the suffixes of unsigned numbers, i.e. `255u8`, and
+// the bit size they must fit.
+var unsignedSuffixes = []struct {
+	suffix string
+	bits   int
+}{
+	{"u8", 8},
+	{"u16", 16},
+	{"u32", 32},
+	{"u64", 64},
+	{"u", strconv.IntSize},
+}
+
+// numberLiteral returns the token type of the number v, i.e. `0xFF`, `0b1010`,
+// `1_000_000`, `1e-3` or `255u8`. Numbers that are too large for their type
+// are still numbers, the parser reports them.
+func (dsl *dslCollection) numberLiteral(v string) (dslTokenType, bool) {
+	s := strings.TrimPrefix(v, "-")
+	if s == "" || !dsl.isDigit(s[0]) {
+		return tokens.invalid, false
+	}
+	if body, _, ok := dsl.unsignedSuffix(v); ok {
+		if _, err := dsl.parseInteger(body); err == nil || isRangeError(err) {
+			return tokens.uinteger, true
+		}
+		return tokens.invalid, false
+	}
+	if _, err := dsl.parseInteger(v); err == nil || isRangeError(err) {
+		return tokens.integer, true
+	}
+	if _, err := strconv.ParseFloat(v, 64); err == nil || isRangeError(err) {
+		return tokens.float, true
+	}
+	return tokens.invalid, false
+}
+
+// parseInteger parses decimal, hexadecimal (`0xFF`), binary (`0b1010`) and
+// octal (`0o17`) integers, digits can be separated by underscores. Leading
+// zeros don't make a number octal, `012` is 12.
+func (dsl *dslCollection) parseInteger(v string) (int64, error) {
+	s := strings.TrimPrefix(v, "-")
+	if len(s) > 1 && s[0] == '0' && strings.ContainsRune("xXbBoO", rune(s[1])) {
+		return strconv.ParseInt(v, 0, 64)
+	}
+	if strings.HasPrefix(s, "_") || strings.HasSuffix(s, "_") || strings.Contains(s, "__") {
+		return 0, strconv.ErrSyntax
+	}
+	return strconv.ParseInt(strings.ReplaceAll(v, "_", ""), 10, 64)
+}
+
+// parseUnsigned parses a number with an unsigned suffix, the value has the
+// type of the suffix, i.e. `255u8` is an uint8 and `1u` an uint.
+func (dsl *dslCollection) parseUnsigned(v string) (any, error) {
+	body, bits, ok := dsl.unsignedSuffix(v)
+	if !ok || strings.HasPrefix(body, "-") {
+		return nil, errors.PSR_NUMBER_INVALID(v)
+	}
+	n, err := dsl.parseUint(body, bits)
+	if err != nil {
+		return nil, errors.PSR_NUMBER_INVALID(v)
+	}
+	switch v[len(body):] {
+	case "u8":
+		return uint8(n), nil
+	case "u16":
+		return uint16(n), nil
+	case "u32":
+		return uint32(n), nil
+	case "u64":
+		return n, nil
+	}
+	return uint(n), nil
+}
+
+// parseUint parses the digits of an unsigned number like parseInteger, the
+// number must fit into the given number of bits.
+func (dsl *dslCollection) parseUint(v string, bits int) (uint64, error) {
+	if len(v) > 1 && v[0] == '0' && strings.ContainsRune("xXbBoO", rune(v[1])) {
+		return strconv.ParseUint(v, 0, bits)
+	}
+	if _, err := dsl.parseInteger(v); err != nil && !isRangeError(err) {
+		return 0, err
+	}
+	return strconv.ParseUint(strings.ReplaceAll(v, "_", ""), 10, bits)
+}
+
+// unsignedSuffix splits v into the number and the bit size of its unsigned
+// suffix, i.e. `0xFFu8` into `0xFF` and 8.
+func (dsl *dslCollection) unsignedSuffix(v string) (body string, bits int, ok bool) {
+	for _, u := range unsignedSuffixes {
+		if strings.HasSuffix(v, u.suffix) && len(v) > len(u.suffix) {
+			return v[:len(v)-len(u.suffix)], u.bits, true
+		}
+	}
+	return v, 0, false
+}
+
+// isRangeError returns true if err is returned by strconv for a number that
+// is syntactically valid but too large.
+func isRangeError(err error) bool {
+	e, ok := err.(*strconv.NumError)
+	return ok && e.Err == strconv.ErrRange
+}
+
+// isColorLiteral returns true if v is a color, i.e. `#ff8800` or `#ff880080`.
+func (dsl *dslCollection) isColorLiteral(v string) bool {
+	return (len(v) == 7 || len(v) == 9) && dsl.isHexLiteral(v)
+}
+
+// isHexLiteral returns true if v is a # followed by hex digits, i.e. the
+// color `#ff8800` or the invalid color `#abc`.
+func (dsl *dslCollection) isHexLiteral(v string) bool {
+	if len(v) < 2 || !dsl.isComment(v[0]) {
+		return false
+	}
+	for i := 1; i < len(v); i++ {
+		if !dsl.isHexDigit(v[i]) {
+			return false
+		}
+	}
+	return true
+}
+
+// parseColor returns the color of a color literal, the hex digits are the
+// non-premultiplied red, green, blue and, optionally, alpha components.
+func (dsl *dslCollection) parseColor(v string) (color.NRGBA, error) {
+	if !dsl.isColorLiteral(v) {
+		return color.NRGBA{}, errors.PSR_COLOR_INVALID(v)
+	}
+	n, err := strconv.ParseUint(v[1:], 16, 32)
+	if err != nil {
+		return color.NRGBA{}, errors.PSR_COLOR_INVALID(v)
+	}
+	if len(v) == 7 {
+		n = n<<8 | 0xff
+	}
+	return color.NRGBA{R: uint8(n >> 24), G: uint8(n >> 16), B: uint8(n >> 8), A: uint8(n)}, nil
+}
@@ -1,4 +1,4 @@
-package main
+package parser
 
 import (
 	"strings"
@@ -86,10 +86,14 @@ func (dsl *dslCollection) trimLastStringRight(strs *[]string, cutset string) {
 func (dsl *dslCollection) isWhitespace(c byte) bool {
 	return c == ' ' || c == '\t' || c == '\n' || c == '\r'
 }
+func (dsl *dslCollection) isHexDigit(c byte) bool {
+	return dsl.isDigit(c) || (c >= 'a' && c <= 'f') || (c >= 'A' && c <= 'F')
+}
 func (dsl *dslCollection) isDigit(c byte) bool      { return c >= '0' && c <= '9' }
 func (dsl *dslCollection) isCallStart(c byte) bool  { return c == '(' }
 func (dsl *dslCollection) isCallEnd(c byte) bool    { return c == ')' }
 func (dsl *dslCollection) isString(c byte) bool     { return c == '"' }
+func (dsl *dslCollection) isRawString(c byte) bool  { return c == '`' }
 func (dsl *dslCollection) isAssign(c byte) bool     { return c == ':' }
 func (dsl *dslCollection) isNamedArg(c byte) bool   { return c == '=' }
 func (dsl *dslCollection) isTerminator(c byte) bool { return c == ';' }
@@ -104,3 +108,8 @@ func (dsl *dslCollection) isIndexStart(c byte) bool { return c == '[' }
 func (dsl *dslCollection) isIndexEnd(c byte) bool   { return c == ']' }
 func (dsl *dslCollection) isRowStart(c byte) bool   { return c == '<' }
 func (dsl *dslCollection) isRowEnd(c byte) bool     { return c == '>' }
+func (dsl *dslCollection) isMember(c byte) bool     { return c == '.' }
+func (dsl *dslCollection) isNameStart(c byte) bool {
+	return (c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z') || c == '_'
+}
+func (dsl *dslCollection) isNameChar(c byte) bool { return dsl.isNameStart(c) || dsl.isDigit(c) }
@@ -0,0 +1,161 @@
+package parser
+
+import (
+	"fmt"
+	"image"
+	"math"
+	"reflect"
+	"strconv"
+	"strings"
+)
+
+// compareNumbers compares two numbers of any width and returns -1, 0 or 1.
+// ok is false if either value isn't a number.
+func compareNumbers(a, b any) (cmp int, ok bool) {
+	ra, rb := reflect.ValueOf(a), reflect.ValueOf(b)
+	ka, kb := numberKind(ra), numberKind(rb)
+	if ka == reflect.Invalid || kb == reflect.Invalid {
+		return 0, false
+	}
+
+	switch {
+	case ka == reflect.Int && kb == reflect.Int:
+		return compare(ra.Int(), rb.Int()), true
+	case ka == reflect.Uint && kb == reflect.Uint:
+		return compare(ra.Uint(), rb.Uint()), true
+	case ka == reflect.Int && kb == reflect.Uint:
+		if ra.Int() < 0 {
+			return -1, true
+		}
+		return compare(uint64(ra.Int()), rb.Uint()), true
+	case ka == reflect.Uint && kb == reflect.Int:
+		if rb.Int() < 0 {
+			return 1, true
+		}
+		return compare(ra.Uint(), uint64(rb.Int())), true
+	}
+	fa, fb := numberFloat(ra), numberFloat(rb)
+	if math.IsNaN(fa) || math.IsNaN(fb) {
+		return 0, false
+	}
+	return compare(fa, fb), true
+}
+
+// numberKind returns reflect.Int, reflect.Uint or reflect.Float64 for numbers
+// of any width, and reflect.Invalid for everything else.
+func numberKind(v reflect.Value) reflect.Kind {
+	switch v.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return reflect.Int
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		return reflect.Uint
+	case reflect.Float32, reflect.Float64:
+		return reflect.Float64
+	}
+	return reflect.Invalid
+}
+
+// numberFloat returns the value of a number of any width as float64.
+func numberFloat(v reflect.Value) float64 {
+	switch numberKind(v) {
+	case reflect.Int:
+		return float64(v.Int())
+	case reflect.Uint:
+		return float64(v.Uint())
+	}
+	return v.Float()
+}
+
+func compare[T int64 | uint64 | float64](a, b T) int {
+	switch {
+	case a < b:
+		return -1
+	case a > b:
+		return 1
+	}
+	return 0
+}
+
+// validateRange checks that value is within min and max, either of which can
+// be nil. Numbers of any width are compared by value, strings by their length.
+// typ and name describe what is validated for the error, e.g. "variable" and "size".
+func validateRange(typ, name string, min, max, value any) error {
+	if str, ok := value.(string); ok {
+		if c, ok := compareNumbers(len(str), min); ok && c < 0 {
+			return errors.REG_VALIDATION_OUT_OF_BOUNDS_LENGTH(typ, name, min, max, len(str))
+		}
+		if c, ok := compareNumbers(len(str), max); ok && c > 0 {
+			return errors.REG_VALIDATION_OUT_OF_BOUNDS_LENGTH(typ, name, min, max, len(str))
+		}
+		return nil
+	}
+	if c, ok := compareNumbers(value, min); ok && c < 0 {
+		return errors.REG_VALIDATION_OUT_OF_BOUNDS(typ, name, min, max, value)
+	}
+	if c, ok := compareNumbers(value, max); ok && c > 0 {
+		return errors.REG_VALIDATION_OUT_OF_BOUNDS(typ, name, min, max, value)
+	}
+	return nil
+}
+
+// validateLimits checks a value against the limits of a parameter or variable:
+//   - numbers of any width must be within min and max
+//   - strings must have a length within min and max as well as minLen and maxLen
+//   - slices must have a length within minLen and maxLen, their elements
+//     (of nested slices, too) must be within min and max
+//   - images must have a size within min and max, given as "WxH"
+//
+// Limits that are nil are not checked.
+func validateLimits(typ, name string, min, max, minLen, maxLen, value any) error {
+	rv := reflect.ValueOf(value)
+	if rv.Kind() == reflect.Pointer && rv.IsNil() {
+		return nil
+	}
+	if img, ok := value.(image.Image); ok {
+		return validateSize(typ, name, min, max, img)
+	}
+	if rv.Kind() == reflect.String || rv.Kind() == reflect.Slice {
+		if c, ok := compareNumbers(rv.Len(), minLen); ok && c < 0 {
+			return errors.REG_VALIDATION_OUT_OF_BOUNDS_LENGTH(typ, name, minLen, maxLen, rv.Len())
+		}
+		if c, ok := compareNumbers(rv.Len(), maxLen); ok && c > 0 {
+			return errors.REG_VALIDATION_OUT_OF_BOUNDS_LENGTH(typ, name, minLen, maxLen, rv.Len())
+		}
+	}
+	if rv.Kind() == reflect.Slice {
+		for i := 0; i < rv.Len(); i++ {
+			if err := validateLimits(typ, fmt.Sprintf("%s[%d]", name, i), min, max, nil, nil, rv.Index(i).Interface()); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	return validateRange(typ, name, min, max, value)
+}
+
+// validateSize checks that the size of img is within min and max, given as "WxH".
+func validateSize(typ, name string, min, max any, img image.Image) error {
+	size := img.Bounds().Size()
+	if w, h, ok := parseSize(min); ok && (size.X < w || size.Y < h) {
+		return errors.REG_VALIDATION_OUT_OF_BOUNDS_SIZE(typ, name, min, max, fmt.Sprintf("%dx%d", size.X, size.Y))
+	}
+	if w, h, ok := parseSize(max); ok && (size.X > w || size.Y > h) {
+		return errors.REG_VALIDATION_OUT_OF_BOUNDS_SIZE(typ, name, min, max, fmt.Sprintf("%dx%d", size.X, size.Y))
+	}
+	return nil
+}
+
+// parseSize parses a size given as "WxH", ok is false if size isn't one.
+func parseSize(size any) (w, h int, ok bool) {
+	str, isStr := size.(string)
+	if !isStr {
+		return 0, 0, false
+	}
+	ws, hs, found := strings.Cut(strings.ToLower(strings.TrimSpace(str)), "x")
+	if !found {
+		return 0, 0, false
+	}
+	w, errW := strconv.Atoi(ws)
+	h, errH := strconv.Atoi(hs)
+	return w, h, errW == nil && errH == nil
+}
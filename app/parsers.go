@@ -22,12 +22,25 @@ func parseParam(value string, types map[string]string) metaParam {
 		return metaParam{}
 	}
 
+	// variadic parameters are annotated as `name...`
+	variadic := strings.HasSuffix(parts[0], "...")
+	parts[0] = strings.TrimSuffix(parts[0], "...")
+
 	// we determine the type from the first part
 	typ := types[parts[0]]
 	if typ == "" {
 		typ = "any"
 	}
+	if strings.HasPrefix(typ, "...") {
+		variadic = true
+		typ = strings.TrimPrefix(typ, "...")
+	}
+	param := parseParamParts(line, parts, typ)
+	param.variadic = variadic
+	return param
+}
 
+func parseParamParts(line string, parts []string, typ string) metaParam {
 	if typ == "error" {
 		return metaParam{
 			name: strings.TrimSpace(parts[0]),
@@ -59,12 +72,19 @@ func parseParam(value string, types map[string]string) metaParam {
 			}
 		}
 
-		return metaParam{
+		param := metaParam{
 			name: strings.TrimSpace(parts[0]),
 			typ:  strings.TrimSpace(typ),
 			def:  parseValue(parts[1]),
 			desc: strings.TrimSpace(strings.Join(parts[2:], " ")),
 		}
+		// an optional length range can precede the default, e.g. `name 1..64 "default"`
+		if startQuote > len(parts[0]) {
+			if r := strings.TrimSpace(line[len(parts[0]):startQuote]); r != "" {
+				param.minLen, param.maxLen = parseRange(strings.TrimPrefix(r, "#"))
+			}
+		}
+		return param
 	}
 
 	if len(parts) < 5 {
@@ -82,16 +102,13 @@ func parseParam(value string, types map[string]string) metaParam {
 		desc: strings.TrimSpace(strings.Join(parts[4:], " ")),
 	}
 
-	// parse min/max/default
-	if parts[2] != "" {
-		if parts[2] == "-" {
-			param.min = nil
-			param.max = nil
-		} else {
-			e := strings.Split(parts[2], "..")
-			if len(e) == 2 {
-				param.min = parseValue(e[0])
-				param.max = parseValue(e[1])
+	// parse min/max and the length range, e.g. `0..1`, `#1..10,0..1` or `1x1..8192x8192`
+	if parts[2] != "" && parts[2] != "-" {
+		for _, r := range strings.Split(parts[2], ",") {
+			if strings.HasPrefix(r, "#") {
+				param.minLen, param.maxLen = parseRange(r[1:])
+			} else {
+				param.min, param.max = parseRange(r)
 			}
 		}
 	}
@@ -99,6 +116,22 @@ func parseParam(value string, types map[string]string) metaParam {
 	return param
 }
 
+// parseRange parses a range given as `min..max`, either side can be omitted
+// to leave it unbounded.
+func parseRange(s string) (min, max any) {
+	lo, hi, found := strings.Cut(strings.TrimSpace(s), "..")
+	if !found {
+		return nil, nil
+	}
+	if strings.TrimSpace(lo) != "" {
+		min = parseValue(lo)
+	}
+	if strings.TrimSpace(hi) != "" {
+		max = parseValue(hi)
+	}
+	return min, max
+}
+
 func parseValue(s string) any {
 	s = strings.TrimSpace(s)
 	if s == "" {